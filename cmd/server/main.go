@@ -1,18 +1,36 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/TrailBlazors/realtime-chat-railway/internal/api"
 	"github.com/TrailBlazors/realtime-chat-railway/internal/chat"
 	"github.com/TrailBlazors/realtime-chat-railway/internal/config"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/health"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/invite"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/metrics"
 	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/oidc"
 	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/tlsconfig"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/tracing"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/webhook"
 	"github.com/gorilla/mux"
 )
 
+// certCheckInterval is how often the TLS certificate files are checked for
+// changes.
+const certCheckInterval = time.Minute
+
 func main() {
 	// Setup structured logging
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
@@ -20,18 +38,32 @@ func main() {
 	}))
 	slog.SetDefault(logger)
 
-	// Load configuration
-	cfg := config.Load()
+	// Load configuration (CONFIG_FILE, overridden by the environment)
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
 	chat.InitClient(cfg)
 
+	// Tracing (OTEL_EXPORTER_OTLP_ENDPOINT configures the OTLP exporter)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TracesExporter)
+	if err != nil {
+		slog.Error("invalid tracing configuration", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
 	// Initialize store
 	var messageStore store.Store
+	var redisStore *store.RedisStore
 	if cfg.RedisURL != "" {
-		redisStore, err := store.NewRedisStore(cfg.RedisURL, cfg.MessageTTL, cfg.MaxMessages)
+		rs, err := store.NewRedisStore(cfg.RedisURL, cfg.MessageTTL, cfg.MaxMessages)
 		if err != nil {
 			slog.Warn("failed to connect to Redis, falling back to no-op store", "error", err)
 			messageStore = store.NewNoOpStore()
 		} else {
+			redisStore = rs
 			messageStore = redisStore
 		}
 	} else {
@@ -39,36 +71,224 @@ func main() {
 	}
 	defer messageStore.Close()
 
+	// Room metadata, invites, moderation state and webhooks live in Redis
+	// when available
+	memoryStore := store.NewMemoryStore()
+	var roomStore store.RoomStore = memoryStore
+	var inviteStore store.InviteStore = memoryStore
+	var moderationStore store.ModerationStore = memoryStore
+	var webhookStore store.WebhookStore = memoryStore
+	var incomingStore store.IncomingWebhookStore = memoryStore
+	if redisStore != nil {
+		roomStore = redisStore
+		inviteStore = redisStore
+		moderationStore = redisStore
+		webhookStore = redisStore
+		incomingStore = redisStore
+	}
+
+	if cfg.InviteSecret == "" {
+		slog.Warn("INVITE_SECRET not set, invite links will not survive a restart")
+	}
+	invites := invite.NewManager(middleware.NewSigner(cfg.InviteSecret), inviteStore, roomStore)
+
 	// Initialize hub with store
 	hub := chat.NewHub(messageStore)
+	hub.SetRoomStore(roomStore)
+	hub.SetInvites(invites)
+	moderation := chat.NewModeration(hub, moderationStore)
+	hub.SetModeration(moderation)
+	webhooks := webhook.NewDispatcher(webhookStore)
+	hub.SetWebhooks(webhooks)
+	hub.SetMaxConnections(cfg.MaxConnections)
+	hub.SetConnectionCaps(cfg.MaxConnectionsPerIP, cfg.MaxConnectionsPerUser)
+	flood := chat.NewFloodControl(floodPolicy(cfg))
+	hub.SetFloodControl(flood)
+	go webhooks.Run(context.Background())
 	go hub.Run()
 
 	// Initialize middleware
-	rateLimiter := middleware.NewRateLimiter(cfg.RateLimit)
-	auth := middleware.NewAuth(cfg.AuthToken)
+	// Each route class has its own token bucket per client
+	wsLimiter := middleware.NewPolicyLimiter(middleware.Policy{
+		Name: middleware.PolicyWebSocket, Limit: cfg.WSRateLimit, Period: time.Minute, Burst: cfg.WSRateLimitBurst,
+	})
+	staticLimiter := middleware.NewPolicyLimiter(middleware.Policy{
+		Name: middleware.PolicyStatic, Limit: cfg.StaticRateLimit, Period: time.Minute, Burst: cfg.StaticRateLimitBurst,
+	})
+	rateLimiter := middleware.NewPolicyLimiter(middleware.Policy{
+		Name: middleware.PolicyAPI, Limit: cfg.RateLimit, Period: time.Minute, Burst: cfg.RateLimitBurst,
+	})
+	if cfg.RateLimitStore == "redis" {
+		if redisStore == nil {
+			slog.Warn("RATE_LIMIT_STORE=redis requires a reachable REDIS_URL, limiting locally")
+		} else {
+			for _, limiter := range []*middleware.RateLimiter{wsLimiter, staticLimiter, rateLimiter} {
+				limiter.SetStore(redisStore)
+			}
+			flood.SetStore(redisStore)
+		}
+	}
+	var authenticators []middleware.Authenticator
+	var keyRegistry *middleware.KeyRegistry
+	if cfg.APIKeysEnabled() {
+		var keyStore store.KeyStore
+		switch cfg.APIKeysStore {
+		case "file":
+			keyStore = store.NewFileKeyStore(cfg.APIKeysFile)
+		case "redis":
+			if redisStore == nil {
+				slog.Error("API_KEYS_STORE=redis requires a reachable REDIS_URL")
+				os.Exit(1)
+			}
+			keyStore = redisStore
+		default:
+			slog.Warn("API keys are kept in memory and will not survive a restart")
+			keyStore = store.NewMemoryKeyStore()
+		}
+		keyRegistry = middleware.NewKeyRegistry(keyStore)
+		authenticators = append(authenticators, keyRegistry)
+	}
+	var jwtValidator *middleware.JWTValidator
+	if cfg.JWTEnabled() {
+		jwtValidator, err = middleware.NewJWTValidator(cfg.JWTSecret, cfg.JWTJWKSFile, cfg.JWTIssuer, cfg.JWTAudience)
+		if err != nil {
+			slog.Error("invalid JWT configuration", "error", err)
+			os.Exit(1)
+		}
+		authenticators = append(authenticators, jwtValidator)
+	}
+	var oidcProvider *oidc.Provider
+	if cfg.OIDCEnabled() {
+		if cfg.SessionSecret == "" {
+			slog.Warn("SESSION_SECRET not set, sessions will not survive a restart")
+		}
+		signer := middleware.NewSigner(cfg.SessionSecret)
+		sessions := middleware.NewSessions(signer, time.Duration(cfg.SessionTTL)*time.Hour,
+			strings.HasPrefix(cfg.OIDCRedirectURL, "https://"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		provider, err := oidc.NewProvider(ctx, oidc.Config{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+		}, signer, sessions)
+		cancel()
+		if err != nil {
+			slog.Error("failed to initialize OIDC", "error", err)
+			os.Exit(1)
+		}
+		oidcProvider = provider
+		authenticators = append(authenticators, sessions)
+	}
+	if cfg.AdminToken != "" {
+		authenticators = append(authenticators, middleware.NewAdminToken(cfg.AdminToken))
+	}
+	auth := middleware.NewAuth(cfg.AuthToken, authenticators...)
+
+	// Client IPs are resolved once, from proxy headers set by trusted
+	// proxies only, for the network policy, rate limiting, bans and logs
+	proxies, err := middleware.NewTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		slog.Error("invalid TRUSTED_PROXIES", "error", err)
+		os.Exit(1)
+	}
+	netPolicy, err := middleware.NewNetworkPolicy(cfg.NetworkAllow, cfg.NetworkDeny)
+	if err != nil {
+		slog.Error("invalid network policy", "error", err)
+		os.Exit(1)
+	}
 
 	// Setup router
 	r := mux.NewRouter()
 
 	// WebSocket endpoint (with rate limiting and auth)
-	r.HandleFunc("/ws", rateLimiter.MiddlewareFunc(auth.MiddlewareFunc(
+	r.HandleFunc("/ws", wsLimiter.MiddlewareFunc(auth.MiddlewareFunc(
 		func(w http.ResponseWriter, r *http.Request) {
 			chat.ServeWs(hub, w, r)
 		},
 	)))
 
-	// Health check (no auth required)
-	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status": "ok",
-			"rooms":  hub.GetRoomCount(),
-		})
+	// Long-poll fallback transport (same rate limiting and auth as /ws)
+	longPoll := chat.NewLongPoll(hub)
+	r.HandleFunc("/poll", wsLimiter.MiddlewareFunc(auth.MiddlewareFunc(longPoll.ServeHTTP)))
+
+	// SSO login for the web client
+	if oidcProvider != nil {
+		r.HandleFunc("/auth/login", rateLimiter.MiddlewareFunc(oidcProvider.Login))
+		r.HandleFunc("/auth/callback", rateLimiter.MiddlewareFunc(oidcProvider.Callback))
+		r.HandleFunc("/auth/logout", rateLimiter.MiddlewareFunc(oidcProvider.Logout))
+		r.HandleFunc("/auth/me", rateLimiter.MiddlewareFunc(oidcProvider.Me))
+	}
+
+	// REST API
+	apiRouter := r.PathPrefix("/api").Subrouter()
+	apiRouter.Use(rateLimiter.Middleware, auth.Middleware)
+	incoming := webhook.NewIncoming(incomingStore)
+	api.NewRoomsHandler(roomStore, hub, webhooks, incoming).Register(apiRouter)
+	api.NewInvitesHandler(roomStore, invites).Register(apiRouter)
+	moderationHandler := api.NewModerationHandler(roomStore, moderation)
+	moderationHandler.Register(apiRouter)
+	webhooksHandler := api.NewWebhooksHandler(roomStore, webhooks)
+	webhooksHandler.Register(apiRouter)
+	incomingHandler := api.NewIncomingWebhooksHandler(roomStore, incoming, hub)
+	incomingHandler.Register(apiRouter)
+
+	// Incoming webhooks (the token in the URL authenticates the request)
+	hooks := r.NewRoute().Subrouter()
+	hooks.Use(rateLimiter.Middleware)
+	incomingHandler.RegisterHooks(hooks)
+
+	// Admin API (requires a key with the admin scope)
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(rateLimiter.Middleware, auth.Middleware, func(next http.Handler) http.Handler {
+		return middleware.RequireScope(middleware.ScopeAdmin, next.ServeHTTP)
 	})
+	if keyRegistry != nil {
+		api.NewKeysHandler(keyRegistry).Register(admin)
+	}
+	moderationHandler.RegisterAdmin(admin)
+	webhooksHandler.RegisterAdmin(admin)
+	api.NewAdminHandler(hub, wsLimiter, rateLimiter, staticLimiter).RegisterAdmin(admin)
+	api.NewNetworkPolicyHandler(netPolicy).RegisterAdmin(admin)
+
+	// Liveness and readiness probes (no auth required)
+	checker := health.NewChecker()
+	checker.AddLiveness("hub", hub.Probe)
+	checker.AddReadiness("store", func(ctx context.Context) error {
+		if redisStore != nil {
+			return redisStore.Ping(ctx)
+		}
+		if cfg.RedisURL != "" {
+			return errors.New("redis is unreachable, messages are not persisted")
+		}
+		return nil
+	})
+	checker.AddReadiness("connections", hub.CheckCapacity)
+	r.HandleFunc("/livez", checker.Livez).Methods(http.MethodGet)
+	r.HandleFunc("/readyz", checker.Readyz).Methods(http.MethodGet)
+	r.HandleFunc("/health", checker.Livez).Methods(http.MethodGet) // liveness, as before /livez existed
+
+	// Prometheus metrics, on their own port when one is set, which should
+	// only be reachable from the private network; otherwise for admins
+	var metricsServer *http.Server
+	if cfg.MetricsPort != "" {
+		metricsRouter := mux.NewRouter()
+		metricsRouter.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{Addr: ":" + cfg.MetricsPort, Handler: metricsRouter}
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("metrics server failed", "error", err)
+				os.Exit(1)
+			}
+		}()
+	} else {
+		r.Handle("/metrics", rateLimiter.Middleware(auth.Middleware(
+			middleware.RequireScope(middleware.ScopeAdmin, metrics.Handler().ServeHTTP))))
+	}
 
 	// Static files (apply rate limiting)
-	r.PathPrefix("/").Handler(rateLimiter.Middleware(
+	r.PathPrefix("/").Handler(staticLimiter.Middleware(
 		http.FileServer(http.Dir("./web/static")),
 	))
 
@@ -76,11 +296,183 @@ func main() {
 		"port", cfg.Port,
 		"auth_enabled", cfg.AuthEnabled(),
 		"rate_limit", cfg.RateLimit,
+		"ws_rate_limit", cfg.WSRateLimit,
+		"message_rate_limit", cfg.MessageRateLimit,
+		"rate_limit_store", cfg.RateLimitStore,
 		"allowed_origins", cfg.AllowedOrigins,
+		"trusted_proxies", cfg.TrustedProxies,
+		"traces_exporter", cfg.TracesExporter,
+		"tls", cfg.TLSEnabled(),
+		"tls_client_auth", cfg.TLSClientAuth,
+		"http_redirect_port", cfg.HTTPRedirectPort,
+		"metrics_port", cfg.MetricsPort,
 	)
 
-	if err := http.ListenAndServe(":"+cfg.Port, r); err != nil {
-		slog.Error("server failed", "error", err)
-		os.Exit(1)
+	// Browsers on allowed origins may call the HTTP endpoints too
+	cors := middleware.NewCORS(cfg.AllowedOrigins)
+	handler := proxies.Middleware(netPolicy.Middleware(cors.Middleware(r)))
+	server := &http.Server{Addr: ":" + cfg.Port, Handler: handler}
+
+	// Native TLS, for deployments without a TLS-terminating proxy. The
+	// certificate is reloaded when its files change
+	var cert *tlsconfig.Certificate
+	var redirect *http.Server
+	if cfg.TLSEnabled() {
+		server.TLSConfig, cert, err = tlsconfig.New(tlsconfig.Options{
+			CertFile:     cfg.TLSCertFile,
+			KeyFile:      cfg.TLSKeyFile,
+			MinVersion:   cfg.TLSMinVersion,
+			CipherSuites: cfg.TLSCipherSuites,
+			ClientCAFile: cfg.TLSClientCAFile,
+			ClientAuth:   cfg.TLSClientAuth,
+		})
+		if err != nil {
+			slog.Error("invalid TLS configuration", "error", err)
+			os.Exit(1)
+		}
+		go cert.Watch(context.Background(), certCheckInterval)
+
+		if cfg.HTTPRedirectPort != "" {
+			redirect = &http.Server{Addr: ":" + cfg.HTTPRedirectPort, Handler: tlsconfig.Redirect(cfg.Port)}
+			go func() {
+				if err := redirect.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					slog.Error("HTTPS redirect server failed", "error", err)
+					os.Exit(1)
+				}
+			}()
+		}
+	}
+	go func() {
+		var err error
+		if cfg.TLSEnabled() {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	// On SIGHUP, reload the configuration and apply what can change without
+	// dropping connections; an invalid configuration is not applied at all
+	live := &liveSettings{
+		hub: hub, flood: flood, cors: cors, netPolicy: netPolicy, auth: auth, keys: keyRegistry, jwt: jwtValidator,
+		api: rateLimiter, ws: wsLimiter, static: staticLimiter, cert: cert,
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		current := cfg
+		for range hup {
+			next, err := config.Load()
+			if err != nil {
+				slog.Error("configuration not reloaded", "error", err)
+				continue
+			}
+			merged, restart := current.Reload(next)
+			if len(restart) > 0 {
+				slog.Warn("some changed settings only take effect after a restart", "settings", restart)
+			}
+			live.apply(current, merged)
+			current = merged
+			slog.Info("configuration reloaded", "file", merged.File)
+		}
+	}()
+
+	// On SIGTERM, fail readiness first so that load balancers stop sending
+	// traffic, then stop accepting connections
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+
+	slog.Info("draining", "delay_seconds", cfg.DrainDelay)
+	checker.Drain()
+	time.Sleep(time.Duration(cfg.DrainDelay) * time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if redirect != nil {
+		redirect.Shutdown(ctx)
+	}
+	if metricsServer != nil {
+		metricsServer.Shutdown(ctx)
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Warn("shutdown did not complete", "error", err)
+	}
+	slog.Info("server stopped")
+}
+
+// liveSettings holds the components whose settings SIGHUP reloads.
+type liveSettings struct {
+	hub             *chat.Hub
+	flood           *chat.FloodControl
+	api, ws, static *middleware.RateLimiter
+	cors            *middleware.CORS
+	netPolicy       *middleware.NetworkPolicy
+	auth            *middleware.Auth
+	keys            *middleware.KeyRegistry  // nil without API keys
+	jwt             *middleware.JWTValidator // nil without JWT
+	cert            *tlsconfig.Certificate   // nil without TLS
+}
+
+// apply applies the reloadable settings of cfg, replacing prev. API keys,
+// the JWKS file and the TLS certificate are read again even when their
+// settings did not change. The network lists are only replaced when they
+// changed, so that edits made through the admin API survive a reload.
+func (l *liveSettings) apply(prev, cfg *config.Config) {
+	chat.Reload(cfg)
+	l.cors.SetPatterns(cfg.AllowedOrigins)
+	if !slices.Equal(prev.NetworkAllow, cfg.NetworkAllow) || !slices.Equal(prev.NetworkDeny, cfg.NetworkDeny) {
+		if err := l.netPolicy.Reload(cfg.NetworkAllow, cfg.NetworkDeny); err != nil {
+			slog.Error("network policy not reloaded", "error", err)
+		}
+	}
+
+	l.api.SetPolicy(middleware.Policy{
+		Name: middleware.PolicyAPI, Limit: cfg.RateLimit, Period: time.Minute, Burst: cfg.RateLimitBurst,
+	})
+	l.ws.SetPolicy(middleware.Policy{
+		Name: middleware.PolicyWebSocket, Limit: cfg.WSRateLimit, Period: time.Minute, Burst: cfg.WSRateLimitBurst,
+	})
+	l.static.SetPolicy(middleware.Policy{
+		Name: middleware.PolicyStatic, Limit: cfg.StaticRateLimit, Period: time.Minute, Burst: cfg.StaticRateLimitBurst,
+	})
+	l.flood.SetPolicy(floodPolicy(cfg))
+	l.hub.SetMaxConnections(cfg.MaxConnections)
+	l.hub.SetConnectionCaps(cfg.MaxConnectionsPerIP, cfg.MaxConnectionsPerUser)
+
+	if cfg.AuthToken != "" {
+		if err := l.auth.SetToken(cfg.AuthToken); err != nil {
+			slog.Error("AUTH_TOKEN not reloaded", "error", err)
+		}
+	}
+	if l.keys != nil {
+		if err := l.keys.Reload(context.Background()); err != nil {
+			slog.Error("API keys not reloaded", "error", err)
+		}
+	}
+	if l.jwt != nil {
+		if err := l.jwt.Reload(cfg.JWTSecret, cfg.JWTJWKSFile, cfg.JWTIssuer, cfg.JWTAudience); err != nil {
+			slog.Error("JWT keys not reloaded", "error", err)
+		}
+	}
+	if l.cert != nil {
+		if err := l.cert.Reload(); err != nil {
+			slog.Error("TLS certificate not reloaded", "error", err)
+		}
+	}
+}
+
+func floodPolicy(cfg *config.Config) chat.FloodPolicy {
+	return chat.FloodPolicy{
+		ConnectionRate:  cfg.MessageRateLimit,
+		ConnectionBurst: cfg.MessageRateLimitBurst,
+		UserRate:        cfg.UserMessageRateLimit,
+		UserBurst:       cfg.UserMessageRateLimitBurst,
+		Warnings:        cfg.FloodWarnings,
+		MuteDuration:    time.Duration(cfg.FloodMuteDuration) * time.Second,
 	}
 }
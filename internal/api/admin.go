@@ -0,0 +1,136 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/chat"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/gorilla/mux"
+)
+
+const maxAnnouncementLength = 1000
+
+type closeRoomRequest struct {
+	Reason string `json:"reason"`
+}
+
+type announcementRequest struct {
+	Room    string `json:"room"` // empty announces to every room
+	Content string `json:"content"`
+}
+
+// AdminHandler serves the live state of the server to administrators:
+// rooms and their connections, announcements and rate-limited visitors.
+type AdminHandler struct {
+	hub      *chat.Hub
+	limiters []*middleware.RateLimiter
+}
+
+func NewAdminHandler(hub *chat.Hub, limiters ...*middleware.RateLimiter) *AdminHandler {
+	return &AdminHandler{hub: hub, limiters: limiters}
+}
+
+// RegisterAdmin adds the routes to r, which must already require the admin
+// scope.
+func (h *AdminHandler) RegisterAdmin(r *mux.Router) {
+	r.HandleFunc("/rooms", h.rooms).Methods(http.MethodGet)
+	r.HandleFunc("/rooms/{room}", h.room).Methods(http.MethodGet)
+	r.HandleFunc("/rooms/{room}/close", h.closeRoom).Methods(http.MethodPost)
+	r.HandleFunc("/connections/{id}", h.disconnect).Methods(http.MethodDelete)
+	r.HandleFunc("/announcements", h.announce).Methods(http.MethodPost)
+	r.HandleFunc("/ratelimit/visitors", h.visitors).Methods(http.MethodGet)
+}
+
+func (h *AdminHandler) rooms(w http.ResponseWriter, r *http.Request) {
+	rooms := h.hub.Rooms()
+	connections := 0
+	for _, room := range rooms {
+		connections += len(room.Connections)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"rooms":       rooms,
+		"connections": connections,
+	})
+}
+
+func (h *AdminHandler) room(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["room"]
+	for _, room := range h.hub.Rooms() {
+		if room.Name == name {
+			writeJSON(w, http.StatusOK, room)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "room has no connected clients")
+}
+
+// closeRoom disconnects everyone in the room. The body, with a reason for
+// the clients, is optional.
+func (h *AdminHandler) closeRoom(w http.ResponseWriter, r *http.Request) {
+	var req closeRoomRequest
+	if r.ContentLength != 0 && !decodeBody(w, r, &req) {
+		return
+	}
+
+	room := mux.Vars(r)["room"]
+	n := h.hub.CloseRoom(room, req.Reason)
+	slog.Info("room closed", "room", room, "disconnected", n, "by", adminName(r))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"disconnected": n})
+}
+
+// disconnect closes one connection, with an optional ?reason=.
+func (h *AdminHandler) disconnect(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if !h.hub.Disconnect(id, r.URL.Query().Get("reason")) {
+		writeError(w, http.StatusNotFound, "connection not found")
+		return
+	}
+	slog.Info("connection closed", "id", id, "by", adminName(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) announce(w http.ResponseWriter, r *http.Request) {
+	var req announcementRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	req.Content = strings.TrimSpace(req.Content)
+	if req.Content == "" {
+		writeError(w, http.StatusBadRequest, "content is required")
+		return
+	}
+	if utf8.RuneCountInString(req.Content) > maxAnnouncementLength {
+		writeError(w, http.StatusBadRequest, "announcement is too long")
+		return
+	}
+
+	rooms := h.hub.Announce(strings.TrimSpace(req.Room), req.Content)
+	slog.Info("announcement sent", "rooms", len(rooms), "by", adminName(r))
+	if rooms == nil {
+		rooms = []string{}
+	}
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"rooms": rooms})
+}
+
+// visitors lists the clients tracked by every policy, busiest first.
+func (h *AdminHandler) visitors(w http.ResponseWriter, r *http.Request) {
+	visitors := []middleware.Visitor{}
+	for _, limiter := range h.limiters {
+		visitors = append(visitors, limiter.Visitors()...)
+	}
+	sort.SliceStable(visitors, func(i, j int) bool { return visitors[i].Requests > visitors[j].Requests })
+	writeJSON(w, http.StatusOK, map[string]interface{}{"visitors": visitors})
+}
+
+// adminName identifies the administrator behind r in logs.
+func adminName(r *http.Request) string {
+	if c, ok := callerFrom(r); ok {
+		return c.name()
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/chat"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/gorilla/mux"
+)
+
+type idleBot struct{ chat.BaseBot }
+
+func (idleBot) Name() string { return "idler" }
+
+func TestAdminHandler(t *testing.T) {
+	hub := chat.NewHub(store.NewNoOpStore())
+	go hub.Run()
+	if err := hub.AddBot(idleBot{}, "lobby"); err != nil {
+		t.Fatal(err)
+	}
+	limiter := middleware.NewRateLimiter(60)
+	limiter.Allow("10.0.0.1")
+
+	r := mux.NewRouter()
+	NewAdminHandler(hub, limiter).RegisterAdmin(r.PathPrefix("/admin").Subrouter())
+
+	rec := serve(r, asAdmin(httptest.NewRequest("GET", "/admin/rooms", nil)))
+	var rooms struct {
+		Rooms       []chat.RoomSummary `json:"rooms"`
+		Connections int                `json:"connections"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &rooms)
+	if rec.Code != http.StatusOK || rooms.Connections != 1 || len(rooms.Rooms) != 1 {
+		t.Fatalf("unexpected rooms %d %s", rec.Code, rec.Body)
+	}
+	conn := rooms.Rooms[0].Connections[0]
+	if conn.Username != "idler" || conn.Transport != chat.TransportHosted || !conn.Bot {
+		t.Errorf("unexpected connection %+v", conn)
+	}
+
+	if rec := serve(r, asAdmin(httptest.NewRequest("GET", "/admin/rooms/lobby", nil))); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 for lobby, got %d", rec.Code)
+	}
+	if rec := serve(r, asAdmin(httptest.NewRequest("GET", "/admin/rooms/empty", nil))); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an empty room, got %d", rec.Code)
+	}
+
+	rec = serve(r, asAdmin(httptest.NewRequest("POST", "/admin/announcements", strings.NewReader(`{"content":"  "}`))))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("empty announcement: expected 400, got %d", rec.Code)
+	}
+	rec = serve(r, asAdmin(httptest.NewRequest("POST", "/admin/announcements", strings.NewReader(`{"content":"hello"}`))))
+	if rec.Code != http.StatusAccepted || !strings.Contains(rec.Body.String(), `"lobby"`) {
+		t.Errorf("expected announcement to lobby, got %d %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(r, asAdmin(httptest.NewRequest("GET", "/admin/ratelimit/visitors", nil)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"ip":"10.0.0.1"`) {
+		t.Errorf("unexpected visitors %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := serve(r, asAdmin(httptest.NewRequest("DELETE", "/admin/connections/nope", nil))); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown connection: expected 404, got %d", rec.Code)
+	}
+	if rec := serve(r, asAdmin(httptest.NewRequest("DELETE", "/admin/connections/"+conn.ID, nil))); rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+
+	rec = serve(r, asAdmin(httptest.NewRequest("POST", "/admin/rooms/lobby/close", nil)))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/chat"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/webhook"
+	"github.com/gorilla/mux"
+)
+
+type incomingWebhookView struct {
+	ID        string    `json:"id"`
+	Room      string    `json:"room"`
+	Name      string    `json:"name"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newIncomingWebhookView(w store.IncomingWebhook) incomingWebhookView {
+	return incomingWebhookView{
+		ID:        w.ID,
+		Room:      w.Room,
+		Name:      w.Name,
+		CreatedBy: w.CreatedBy,
+		CreatedAt: w.CreatedAt,
+	}
+}
+
+type incomingWebhookRequest struct {
+	Name string `json:"name"` // display name of the posted messages
+}
+
+// IncomingWebhooksHandler lets room owners create incoming webhooks and
+// serves the secret URLs external systems post to.
+type IncomingWebhooksHandler struct {
+	rooms    store.RoomStore
+	incoming *webhook.Incoming
+	hub      *chat.Hub
+}
+
+func NewIncomingWebhooksHandler(rooms store.RoomStore, incoming *webhook.Incoming, hub *chat.Hub) *IncomingWebhooksHandler {
+	return &IncomingWebhooksHandler{rooms: rooms, incoming: incoming, hub: hub}
+}
+
+func (h *IncomingWebhooksHandler) Register(r *mux.Router) {
+	r.HandleFunc("/rooms/{room}/incoming-webhooks", h.list).Methods(http.MethodGet)
+	r.HandleFunc("/rooms/{room}/incoming-webhooks", h.create).Methods(http.MethodPost)
+	r.HandleFunc("/rooms/{room}/incoming-webhooks/{id}", h.delete).Methods(http.MethodDelete)
+}
+
+// RegisterHooks adds the endpoint external systems post to. The token in
+// the URL is the credential, so r must not require authentication.
+func (h *IncomingWebhooksHandler) RegisterHooks(r *mux.Router) {
+	r.HandleFunc("/hooks/{id}/{token}", h.post).Methods(http.MethodPost)
+}
+
+// authorize checks that the caller owns the room in the URL.
+func (h *IncomingWebhooksHandler) authorize(w http.ResponseWriter, r *http.Request) (*store.Room, caller, bool) {
+	c, ok := requireCaller(w, r)
+	if !ok {
+		return nil, c, false
+	}
+	room, ok := loadRoom(w, r, h.rooms)
+	if !ok {
+		return nil, c, false
+	}
+	if room.Role(c.username) != store.RoleOwner && !c.admin {
+		writeError(w, http.StatusForbidden, "only the room owner can manage webhooks")
+		return nil, c, false
+	}
+	return room, c, true
+}
+
+func (h *IncomingWebhooksHandler) list(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	hooks, err := h.incoming.List(r.Context(), room.Name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list webhooks")
+		return
+	}
+	views := make([]incomingWebhookView, 0, len(hooks))
+	for _, hook := range hooks {
+		views = append(views, newIncomingWebhookView(hook))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"webhooks": views})
+}
+
+func (h *IncomingWebhooksHandler) create(w http.ResponseWriter, r *http.Request) {
+	room, c, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	var req incomingWebhookRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	token, hook, err := h.incoming.Create(r.Context(), room.Name, req.Name, c.name())
+	if errors.Is(err, webhook.ErrInvalid) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create webhook")
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"webhook": newIncomingWebhookView(hook),
+		"url":     "/hooks/" + hook.ID + "/" + token,
+	})
+}
+
+func (h *IncomingWebhooksHandler) delete(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.incoming.Delete(r.Context(), room.Name, mux.Vars(r)["id"])
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to delete webhook")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// post injects a message into the webhook's room. Messages are always
+// flagged as sent by a bot and carry the webhook's name; a name given in
+// the payload is prefixed like a bot's, so that it cannot pass for a user.
+func (h *IncomingWebhooksHandler) post(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	hook, err := h.incoming.Authenticate(r.Context(), vars["id"], vars["token"])
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load webhook")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	post, err := webhook.ParsePost(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	username := hook.Name
+	if post.Username != "" {
+		username = middleware.BotPrefix + post.Username
+	}
+	h.hub.BroadcastMessage(chat.Message{
+		Type:     "message",
+		Username: username,
+		Content:  post.Text,
+		Room:     hook.Room,
+		Time:     time.Now().Format(time.RFC3339),
+		Bot:      true,
+	})
+	slog.Debug("incoming webhook posted", "webhook", hook.ID, "room", hook.Room)
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/chat"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/webhook"
+	"github.com/gorilla/mux"
+)
+
+// savedMessages is a message store that hands saved messages to the test.
+type savedMessages chan store.Message
+
+func (s savedMessages) SaveMessage(ctx context.Context, msg store.Message) error {
+	s <- msg
+	return nil
+}
+
+func (s savedMessages) GetRecentMessages(ctx context.Context, room string, limit int) ([]store.Message, error) {
+	return nil, nil
+}
+
+func (s savedMessages) Close() error { return nil }
+
+func TestIncomingWebhooksHandler(t *testing.T) {
+	saved := make(savedMessages, 10)
+	hub := chat.NewHub(saved)
+	go hub.Run()
+
+	s := store.NewMemoryStore()
+	incoming := webhook.NewIncoming(s)
+	h := NewIncomingWebhooksHandler(s, incoming, hub)
+	r := mux.NewRouter()
+	sub := r.PathPrefix("/api").Subrouter()
+	NewRoomsHandler(s, hub, webhook.NewDispatcher(s), incoming).Register(sub)
+	h.Register(sub)
+	h.RegisterHooks(r)
+
+	serve(r, asUser(httptest.NewRequest("POST", "/api/rooms", strings.NewReader(`{"name":"ops"}`)), "alice"))
+
+	rec := serve(r, asUser(httptest.NewRequest("POST", "/api/rooms/ops/incoming-webhooks",
+		strings.NewReader(`{"name":"CI"}`)), "mallory"))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a non-owner, got %d", rec.Code)
+	}
+
+	rec = serve(r, asUser(httptest.NewRequest("POST", "/api/rooms/ops/incoming-webhooks",
+		strings.NewReader(`{"name":"CI"}`)), "alice"))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	var created struct {
+		Webhook incomingWebhookView `json:"webhook"`
+		URL     string              `json:"url"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	if !strings.HasPrefix(created.URL, "/hooks/"+created.Webhook.ID+"/") {
+		t.Fatalf("unexpected response %s", rec.Body)
+	}
+
+	// Posting needs the token but no other credentials
+	rec = serve(r, httptest.NewRequest("POST", "/hooks/"+created.Webhook.ID+"/wrong", strings.NewReader(`{"text":"x"}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a wrong token, got %d", rec.Code)
+	}
+	rec = serve(r, httptest.NewRequest("POST", created.URL, strings.NewReader(`{"content":""}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an empty message, got %d", rec.Code)
+	}
+
+	rec = serve(r, httptest.NewRequest("POST", created.URL, strings.NewReader(`{"content":"build #12 passed"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	// A name from the payload cannot pass for the room owner
+	rec = serve(r, httptest.NewRequest("POST", created.URL, strings.NewReader(`{"username":"alice","text":"shipped"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	for _, want := range []store.Message{
+		{Type: "message", Username: "CI", Content: "build #12 passed", Room: "ops", Bot: true},
+		{Type: "message", Username: "bot:alice", Content: "shipped", Room: "ops", Bot: true},
+	} {
+		select {
+		case msg := <-saved:
+			msg.Time = ""
+			if msg != want {
+				t.Errorf("got %+v, want %+v", msg, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("message was not broadcast")
+		}
+	}
+
+	rec = serve(r, asUser(httptest.NewRequest("DELETE", "/api/rooms/ops/incoming-webhooks/"+created.Webhook.ID, nil), "alice"))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	rec = serve(r, httptest.NewRequest("POST", created.URL, strings.NewReader(`{"content":"late"}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after delete, got %d", rec.Code)
+	}
+}
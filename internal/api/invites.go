@@ -0,0 +1,193 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/invite"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/gorilla/mux"
+)
+
+const defaultInviteTTL = 24 * time.Hour
+
+// inviteView is an invite as shown to room moderators. The token is only
+// returned when the invite is created.
+type inviteView struct {
+	ID        string            `json:"id"`
+	Room      string            `json:"room"`
+	CreatedBy string            `json:"created_by"`
+	MaxUses   int               `json:"max_uses"`
+	Uses      []store.InviteUse `json:"uses"`
+	Revoked   bool              `json:"revoked"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	CreatedAt time.Time         `json:"created_at"`
+	Expired   bool              `json:"expired"`
+}
+
+func newInviteView(inv *store.Invite) inviteView {
+	uses := inv.Uses
+	if uses == nil {
+		uses = []store.InviteUse{}
+	}
+	return inviteView{
+		ID:        inv.ID,
+		Room:      inv.Room,
+		CreatedBy: inv.CreatedBy,
+		MaxUses:   inv.MaxUses,
+		Uses:      uses,
+		Revoked:   inv.Revoked,
+		ExpiresAt: inv.ExpiresAt,
+		CreatedAt: inv.CreatedAt,
+		Expired:   time.Now().After(inv.ExpiresAt),
+	}
+}
+
+type createInviteRequest struct {
+	ExpiresIn int `json:"expires_in"` // seconds; defaults to a day
+	MaxUses   int `json:"max_uses"`   // 0 allows unlimited uses
+}
+
+type acceptInviteRequest struct {
+	Token string `json:"token"`
+}
+
+// InvitesHandler serves room invite links under /api. Owners, moderators
+// and admins mint and revoke invites; anyone holding one may accept it.
+type InvitesHandler struct {
+	rooms   store.RoomStore
+	invites *invite.Manager
+}
+
+func NewInvitesHandler(rooms store.RoomStore, invites *invite.Manager) *InvitesHandler {
+	return &InvitesHandler{rooms: rooms, invites: invites}
+}
+
+func (h *InvitesHandler) Register(r *mux.Router) {
+	r.HandleFunc("/rooms/{room}/invites", h.list).Methods(http.MethodGet)
+	r.HandleFunc("/rooms/{room}/invites", h.create).Methods(http.MethodPost)
+	r.HandleFunc("/rooms/{room}/invites/{id}", h.revoke).Methods(http.MethodDelete)
+	r.HandleFunc("/invites/accept", h.accept).Methods(http.MethodPost)
+}
+
+// moderate loads the room in the URL and checks that the caller may manage
+// its invites.
+func (h *InvitesHandler) moderate(w http.ResponseWriter, r *http.Request) (*store.Room, caller, bool) {
+	c, ok := requireCaller(w, r)
+	if !ok {
+		return nil, c, false
+	}
+	room, ok := loadRoom(w, r, h.rooms)
+	if !ok {
+		return nil, c, false
+	}
+	if !room.IsModerator(c.username) && !c.admin {
+		writeError(w, http.StatusForbidden, "only owners and moderators can manage invites")
+		return nil, c, false
+	}
+	return room, c, true
+}
+
+func (h *InvitesHandler) list(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.moderate(w, r)
+	if !ok {
+		return
+	}
+
+	invites, err := h.invites.List(r.Context(), room.Name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list invites")
+		return
+	}
+
+	views := make([]inviteView, 0, len(invites))
+	for _, inv := range invites {
+		views = append(views, newInviteView(inv))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"invites": views})
+}
+
+func (h *InvitesHandler) create(w http.ResponseWriter, r *http.Request) {
+	room, c, ok := h.moderate(w, r)
+	if !ok {
+		return
+	}
+
+	var req createInviteRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.ExpiresIn < 0 {
+		writeError(w, http.StatusBadRequest, "expires_in must not be negative")
+		return
+	}
+	ttl := time.Duration(req.ExpiresIn) * time.Second
+	if ttl == 0 {
+		ttl = defaultInviteTTL
+	}
+
+	token, inv, err := h.invites.Create(r.Context(), room.Name, c.username, ttl, req.MaxUses)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	link := "/chat.html?" + url.Values{"room": {room.Name}, "invite": {token}}.Encode()
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"invite": newInviteView(inv),
+		"token":  token,
+		"url":    link,
+	})
+}
+
+func (h *InvitesHandler) revoke(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.moderate(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.invites.Revoke(r.Context(), room.Name, mux.Vars(r)["id"])
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "invite not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to revoke invite")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// accept redeems an invite for the caller, making them a room member.
+func (h *InvitesHandler) accept(w http.ResponseWriter, r *http.Request) {
+	c, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+	if c.username == "" {
+		writeError(w, http.StatusBadRequest, "a username is required to accept an invite")
+		return
+	}
+
+	var req acceptInviteRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	room, err := h.invites.Redeem(r.Context(), req.Token, c.username)
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, newRoomView(room, c))
+	case errors.Is(err, store.ErrInviteExpired), errors.Is(err, store.ErrInviteRevoked),
+		errors.Is(err, store.ErrInviteExhausted):
+		writeError(w, http.StatusGone, err.Error())
+	case errors.Is(err, store.ErrInviteUsed):
+		writeError(w, http.StatusForbidden, "invite already used")
+	case errors.Is(err, invite.ErrInvalid), errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusForbidden, "invalid invite")
+	default:
+		writeError(w, http.StatusInternalServerError, "failed to accept invite")
+	}
+}
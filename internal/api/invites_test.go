@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/chat"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/invite"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/webhook"
+	"github.com/gorilla/mux"
+)
+
+func TestInvitesHandler_CreateAcceptRevoke(t *testing.T) {
+	s := store.NewMemoryStore()
+	r := mux.NewRouter()
+	sub := r.PathPrefix("/api").Subrouter()
+	NewRoomsHandler(s, chat.NewHub(store.NewNoOpStore()), webhook.NewDispatcher(s), webhook.NewIncoming(s)).Register(sub)
+	NewInvitesHandler(s, invite.NewManager(middleware.NewSigner("test-secret"), s, s)).Register(sub)
+
+	serve(r, asUser(httptest.NewRequest("POST", "/api/rooms",
+		strings.NewReader(`{"name":"ops","visibility":"private"}`)), "alice"))
+
+	// Only owners and moderators mint invites
+	rec := serve(r, asUser(httptest.NewRequest("POST", "/api/rooms/ops/invites", strings.NewReader(`{}`)), "mallory"))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+
+	rec = serve(r, asUser(httptest.NewRequest("POST", "/api/rooms/ops/invites",
+		strings.NewReader(`{"expires_in":3600,"max_uses":5}`)), "alice"))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	var created struct {
+		Invite inviteView `json:"invite"`
+		Token  string     `json:"token"`
+		URL    string     `json:"url"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	if created.Token == "" || !strings.Contains(created.URL, "invite=") || created.Invite.MaxUses != 5 {
+		t.Fatalf("unexpected response %s", rec.Body)
+	}
+
+	rec = serve(r, asUser(httptest.NewRequest("POST", "/api/invites/accept",
+		strings.NewReader(`{"token":"`+created.Token+`"}`)), "bob"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var view roomView
+	json.Unmarshal(rec.Body.Bytes(), &view)
+	if view.Role != store.RoleMember {
+		t.Errorf("expected bob to join as member, got %+v", view)
+	}
+
+	// Usage is visible to the owner
+	rec = serve(r, asUser(httptest.NewRequest("GET", "/api/rooms/ops/invites", nil), "alice"))
+	var list struct {
+		Invites []inviteView `json:"invites"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if len(list.Invites) != 1 || len(list.Invites[0].Uses) != 1 || list.Invites[0].Uses[0].Username != "bob" {
+		t.Errorf("unexpected invite list %s", rec.Body)
+	}
+
+	rec = serve(r, asUser(httptest.NewRequest("DELETE", "/api/rooms/ops/invites/"+created.Invite.ID, nil), "alice"))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	rec = serve(r, asUser(httptest.NewRequest("POST", "/api/invites/accept",
+		strings.NewReader(`{"token":"`+created.Token+`"}`)), "carol"))
+	if rec.Code != http.StatusGone {
+		t.Errorf("expected 410 for a revoked invite, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/gorilla/mux"
+)
+
+// keyView is an API key as shown to admins; the hash is never returned.
+type keyView struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	Rooms     []string   `json:"rooms,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	Expired   bool       `json:"expired"`
+}
+
+func newKeyView(k store.APIKey) keyView {
+	v := keyView{
+		Name:      k.Name,
+		Scopes:    k.Scopes,
+		Rooms:     k.Rooms,
+		CreatedAt: k.CreatedAt,
+		Expired:   k.Expired(time.Now()),
+	}
+	if !k.ExpiresAt.IsZero() {
+		v.ExpiresAt = &k.ExpiresAt
+	}
+	return v
+}
+
+type createKeyRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	Rooms     []string `json:"rooms"`
+	ExpiresIn int      `json:"expires_in"` // seconds; 0 never expires
+}
+
+// KeysHandler serves /admin/keys. Rotation is done by creating a new key,
+// moving clients over and revoking the old one.
+type KeysHandler struct {
+	registry *middleware.KeyRegistry
+}
+
+func NewKeysHandler(registry *middleware.KeyRegistry) *KeysHandler {
+	return &KeysHandler{registry: registry}
+}
+
+// Register adds the key routes to r, which must already require the admin
+// scope.
+func (h *KeysHandler) Register(r *mux.Router) {
+	r.HandleFunc("/keys", h.list).Methods(http.MethodGet)
+	r.HandleFunc("/keys", h.create).Methods(http.MethodPost)
+	r.HandleFunc("/keys/{name}", h.revoke).Methods(http.MethodDelete)
+}
+
+func (h *KeysHandler) list(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.registry.List(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list keys")
+		return
+	}
+
+	views := make([]keyView, 0, len(keys))
+	for _, k := range keys {
+		views = append(views, newKeyView(k))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": views})
+}
+
+func (h *KeysHandler) create(w http.ResponseWriter, r *http.Request) {
+	var req createKeyRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.ExpiresIn < 0 {
+		writeError(w, http.StatusBadRequest, "expires_in must not be negative")
+		return
+	}
+
+	secret, key, err := h.registry.Create(r.Context(), req.Name, req.Scopes, req.Rooms,
+		time.Duration(req.ExpiresIn)*time.Second)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"key":   newKeyView(key),
+		"token": secret,
+	})
+}
+
+func (h *KeysHandler) revoke(w http.ResponseWriter, r *http.Request) {
+	err := h.registry.Revoke(r.Context(), mux.Vars(r)["name"])
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "key not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to revoke key")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/gorilla/mux"
+)
+
+func TestKeysHandler(t *testing.T) {
+	registry := middleware.NewKeyRegistry(store.NewMemoryKeyStore())
+	r := mux.NewRouter()
+	NewKeysHandler(registry).Register(r.PathPrefix("/admin").Subrouter())
+
+	// Create
+	req := httptest.NewRequest("POST", "/admin/keys",
+		strings.NewReader(`{"name":"ci","scopes":["write"],"expires_in":3600}`))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var created struct {
+		Token string  `json:"token"`
+		Key   keyView `json:"key"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	if !strings.HasPrefix(created.Token, "ck_") {
+		t.Errorf("expected a ck_ token, got %q", created.Token)
+	}
+	if created.Key.ExpiresAt == nil {
+		t.Error("expected an expiry")
+	}
+
+	// The new key authenticates
+	authReq := httptest.NewRequest("GET", "/?token="+created.Token, nil)
+	if _, err := registry.Authenticate(authReq); err != nil {
+		t.Errorf("created key rejected: %v", err)
+	}
+
+	// List never returns hashes or secrets
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/keys", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "hash") || strings.Contains(rec.Body.String(), created.Token) {
+		t.Error("list should not expose hashes or secrets")
+	}
+
+	// Revoke
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("DELETE", "/admin/keys/ci", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("DELETE", "/admin/keys/ci", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+
+	// Invalid request
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/keys", strings.NewReader(`{"name":"x"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without scopes, got %d", rec.Code)
+	}
+}
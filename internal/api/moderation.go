@@ -0,0 +1,257 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/chat"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+type moderationRequest struct {
+	Username string `json:"username"`
+	IP       string `json:"ip"` // bans only
+	Reason   string `json:"reason"`
+	Duration int    `json:"duration"` // seconds; 0 is permanent
+}
+
+// ModerationHandler serves kicks, bans, mutes and the audit log. Room
+// routes are open to the room's owner and moderators; global routes are
+// registered on the admin router.
+type ModerationHandler struct {
+	rooms store.RoomStore
+	mod   *chat.Moderation
+}
+
+func NewModerationHandler(rooms store.RoomStore, mod *chat.Moderation) *ModerationHandler {
+	return &ModerationHandler{rooms: rooms, mod: mod}
+}
+
+func (h *ModerationHandler) Register(r *mux.Router) {
+	r.HandleFunc("/rooms/{room}/kick", h.kick).Methods(http.MethodPost)
+	r.HandleFunc("/rooms/{room}/bans", h.ban).Methods(http.MethodPost)
+	r.HandleFunc("/rooms/{room}/mutes", h.mute).Methods(http.MethodPost)
+	r.HandleFunc("/rooms/{room}/sanctions", h.sanctions).Methods(http.MethodGet)
+	r.HandleFunc("/rooms/{room}/sanctions/{id}", h.lift).Methods(http.MethodDelete)
+	r.HandleFunc("/rooms/{room}/audit", h.audit).Methods(http.MethodGet)
+}
+
+// RegisterAdmin adds the global routes to r, which must already require
+// the admin scope.
+func (h *ModerationHandler) RegisterAdmin(r *mux.Router) {
+	r.HandleFunc("/bans", h.ban).Methods(http.MethodPost)
+	r.HandleFunc("/mutes", h.mute).Methods(http.MethodPost)
+	r.HandleFunc("/sanctions", h.sanctions).Methods(http.MethodGet)
+	r.HandleFunc("/sanctions/{id}", h.lift).Methods(http.MethodDelete)
+	r.HandleFunc("/audit", h.audit).Methods(http.MethodGet)
+}
+
+// authorize checks that the caller may moderate the room in the URL and
+// act against target. Moderators cannot act against the owner or other
+// moderators. Global routes have no room and are admin-only.
+func (h *ModerationHandler) authorize(w http.ResponseWriter, r *http.Request, target string) (caller, bool) {
+	c, ok := requireCaller(w, r)
+	if !ok {
+		return c, false
+	}
+	name, scoped := mux.Vars(r)["room"]
+	if c.admin {
+		return c, true
+	}
+	if !scoped {
+		writeError(w, http.StatusForbidden, "global moderation requires the admin scope")
+		return c, false
+	}
+
+	room, err := h.rooms.GetRoom(r.Context(), name)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusInternalServerError, "failed to load room")
+		return c, false
+	}
+	if room == nil || !room.IsModerator(c.username) {
+		writeError(w, http.StatusForbidden, "only owners and moderators can moderate this room")
+		return c, false
+	}
+	if target != "" && target != c.username && room.IsModerator(target) && room.Role(c.username) != store.RoleOwner {
+		writeError(w, http.StatusForbidden, "moderators cannot act against other moderators")
+		return c, false
+	}
+	return c, true
+}
+
+func (h *ModerationHandler) action(w http.ResponseWriter, r *http.Request) (chat.Action, bool) {
+	var req moderationRequest
+	if !decodeBody(w, r, &req) {
+		return chat.Action{}, false
+	}
+	if req.Duration < 0 {
+		writeError(w, http.StatusBadRequest, "duration must not be negative")
+		return chat.Action{}, false
+	}
+
+	c, ok := h.authorize(w, r, req.Username)
+	if !ok {
+		return chat.Action{}, false
+	}
+	return chat.Action{
+		Actor:    c.name(),
+		Room:     mux.Vars(r)["room"],
+		Username: req.Username,
+		IP:       req.IP,
+		Reason:   req.Reason,
+		Duration: time.Duration(req.Duration) * time.Second,
+	}, true
+}
+
+func (h *ModerationHandler) kick(w http.ResponseWriter, r *http.Request) {
+	a, ok := h.action(w, r)
+	if !ok {
+		return
+	}
+
+	n, err := h.mod.Kick(r.Context(), a)
+	if errors.Is(err, chat.ErrNoTarget) {
+		writeError(w, http.StatusBadRequest, "username is required")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to kick user")
+		return
+	}
+	if n == 0 {
+		writeError(w, http.StatusNotFound, "user is not connected to this room")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"disconnected": n})
+}
+
+func (h *ModerationHandler) ban(w http.ResponseWriter, r *http.Request) {
+	a, ok := h.action(w, r)
+	if !ok {
+		return
+	}
+	s, err := h.mod.Ban(r.Context(), a)
+	writeSanction(w, s, err)
+}
+
+func (h *ModerationHandler) mute(w http.ResponseWriter, r *http.Request) {
+	a, ok := h.action(w, r)
+	if !ok {
+		return
+	}
+	if a.IP != "" {
+		writeError(w, http.StatusBadRequest, "mutes apply to usernames only")
+		return
+	}
+	s, err := h.mod.Mute(r.Context(), a)
+	writeSanction(w, s, err)
+}
+
+func writeSanction(w http.ResponseWriter, s store.Sanction, err error) {
+	if errors.Is(err, chat.ErrNoTarget) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to store sanction")
+		return
+	}
+	writeJSON(w, http.StatusCreated, s)
+}
+
+// sanctions lists the bans and mutes in force in the room, or everywhere on
+// the admin route.
+func (h *ModerationHandler) sanctions(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r, ""); !ok {
+		return
+	}
+
+	room, scoped := mux.Vars(r)["room"]
+	list := make([]store.Sanction, 0)
+	for _, s := range h.mod.Active(r.Context()) {
+		if !scoped || s.Room == room {
+			list = append(list, s)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"sanctions": list})
+}
+
+func (h *ModerationHandler) lift(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.authorize(w, r, "")
+	if !ok {
+		return
+	}
+
+	// Room moderators may only lift their own room's sanctions
+	id := mux.Vars(r)["id"]
+	room, scoped := mux.Vars(r)["room"]
+	if scoped {
+		found := false
+		for _, s := range h.mod.Active(r.Context()) {
+			found = found || (s.ID == id && s.Room == room)
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, "sanction not found")
+			return
+		}
+	}
+
+	_, err := h.mod.Lift(r.Context(), c.name(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "sanction not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to lift sanction")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// audit returns the newest entries of the audit log, oldest first. The room
+// route shows only that room's entries.
+func (h *ModerationHandler) audit(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r, ""); !ok {
+		return
+	}
+
+	limit := defaultAuditLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		limit = min(n, maxAuditLimit)
+	}
+
+	room, scoped := mux.Vars(r)["room"]
+	fetch := limit
+	if scoped {
+		fetch = maxAuditLimit
+	}
+	entries, err := h.mod.Audit(r.Context(), fetch)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load audit log")
+		return
+	}
+
+	if scoped {
+		filtered := make([]store.AuditEntry, 0)
+		for _, e := range entries {
+			if e.Room == room {
+				filtered = append(filtered, e)
+			}
+		}
+		entries = filtered[max(len(filtered)-limit, 0):]
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"entries": entries})
+}
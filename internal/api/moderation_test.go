@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/chat"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/gorilla/mux"
+)
+
+func asAdmin(req *http.Request) *http.Request {
+	return req.WithContext(middleware.WithIdentity(req.Context(),
+		&middleware.Identity{KeyName: "ops", Scopes: []string{middleware.ScopeAdmin}}))
+}
+
+func TestModerationHandler(t *testing.T) {
+	s := store.NewMemoryStore()
+	s.PutRoom(context.Background(), &store.Room{
+		Name:       "lobby",
+		Visibility: store.VisibilityPublic,
+		Members:    map[string]string{"alice": store.RoleOwner, "bob": store.RoleModerator, "carl": store.RoleModerator},
+	})
+
+	mod := chat.NewModeration(chat.NewHub(store.NewNoOpStore()), s)
+	h := NewModerationHandler(s, mod)
+	r := mux.NewRouter()
+	h.Register(r.PathPrefix("/api").Subrouter())
+	h.RegisterAdmin(r.PathPrefix("/admin").Subrouter())
+
+	ban := `{"username":"troll","reason":"spam","duration":3600}`
+
+	rec := serve(r, asUser(httptest.NewRequest("POST", "/api/rooms/lobby/bans", strings.NewReader(ban)), "mallory"))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("non-moderator: expected 403, got %d", rec.Code)
+	}
+	rec = serve(r, asUser(httptest.NewRequest("POST", "/api/rooms/lobby/mutes",
+		strings.NewReader(`{"username":"carl"}`)), "bob"))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("moderator muting a moderator: expected 403, got %d", rec.Code)
+	}
+	rec = serve(r, asUser(httptest.NewRequest("POST", "/admin/bans", strings.NewReader(ban)), "bob"))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("global ban without admin: expected 403, got %d", rec.Code)
+	}
+
+	rec = serve(r, asUser(httptest.NewRequest("POST", "/api/rooms/lobby/bans", strings.NewReader(ban)), "bob"))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	var sanction store.Sanction
+	json.Unmarshal(rec.Body.Bytes(), &sanction)
+	if sanction.Room != "lobby" || sanction.By != "bob" || sanction.ExpiresAt.IsZero() {
+		t.Errorf("unexpected sanction %+v", sanction)
+	}
+
+	rec = serve(r, asAdmin(httptest.NewRequest("POST", "/admin/bans", strings.NewReader(`{"ip":"10.0.0.9"}`))))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("global ban: expected 201, got %d", rec.Code)
+	}
+
+	// The room lists only its own sanctions
+	rec = serve(r, asUser(httptest.NewRequest("GET", "/api/rooms/lobby/sanctions", nil), "alice"))
+	var list struct {
+		Sanctions []store.Sanction `json:"sanctions"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if len(list.Sanctions) != 1 {
+		t.Errorf("expected 1 room sanction, got %d", len(list.Sanctions))
+	}
+
+	rec = serve(r, asUser(httptest.NewRequest("DELETE", "/api/rooms/lobby/sanctions/"+sanction.ID, nil), "alice"))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+
+	rec = serve(r, asAdmin(httptest.NewRequest("GET", "/admin/audit", nil)))
+	var audit struct {
+		Entries []store.AuditEntry `json:"entries"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &audit)
+	if len(audit.Entries) != 3 || audit.Entries[1].Actor != "key:ops" || audit.Entries[2].Action != "unban" {
+		t.Errorf("unexpected audit log %s", rec.Body)
+	}
+
+	rec = serve(r, asUser(httptest.NewRequest("GET", "/api/rooms/lobby/audit", nil), "bob"))
+	json.Unmarshal(rec.Body.Bytes(), &audit)
+	if len(audit.Entries) != 2 {
+		t.Errorf("expected 2 room entries, got %d", len(audit.Entries))
+	}
+
+	rec = serve(r, asUser(httptest.NewRequest("POST", "/api/rooms/lobby/kick",
+		strings.NewReader(`{"username":"nobody"}`)), "bob"))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("kicking an absent user: expected 404, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/gorilla/mux"
+)
+
+type networkPolicyView struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// NetworkPolicyHandler lets administrators view and replace the IP allow
+// and deny lists without a restart.
+type NetworkPolicyHandler struct {
+	policy *middleware.NetworkPolicy
+}
+
+func NewNetworkPolicyHandler(policy *middleware.NetworkPolicy) *NetworkPolicyHandler {
+	return &NetworkPolicyHandler{policy: policy}
+}
+
+// RegisterAdmin adds the routes to r, which must already require the admin
+// scope.
+func (h *NetworkPolicyHandler) RegisterAdmin(r *mux.Router) {
+	r.HandleFunc("/network-policy", h.get).Methods(http.MethodGet)
+	r.HandleFunc("/network-policy", h.put).Methods(http.MethodPut)
+}
+
+func (h *NetworkPolicyHandler) view() networkPolicyView {
+	allow, deny := h.policy.Lists()
+	return networkPolicyView{Allow: allow, Deny: deny}
+}
+
+func (h *NetworkPolicyHandler) get(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.view())
+}
+
+// put replaces both lists. An administrator cannot lock themselves out:
+// lists that would reject the request's own address are refused.
+func (h *NetworkPolicyHandler) put(w http.ResponseWriter, r *http.Request) {
+	var req networkPolicyView
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	check, err := middleware.NewNetworkPolicy(req.Allow, req.Deny)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if ip := middleware.ClientIP(r); !check.Allowed(ip) {
+		writeError(w, http.StatusConflict, "the lists would reject your own address "+ip)
+		return
+	}
+
+	if err := h.policy.Reload(req.Allow, req.Deny); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	view := h.view()
+	slog.Info("network policy updated", "allow", view.Allow, "deny", view.Deny, "by", adminName(r))
+	writeJSON(w, http.StatusOK, view)
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/gorilla/mux"
+)
+
+func TestNetworkPolicyHandler(t *testing.T) {
+	policy, _ := middleware.NewNetworkPolicy(nil, nil)
+	r := mux.NewRouter()
+	NewNetworkPolicyHandler(policy).RegisterAdmin(r.PathPrefix("/admin").Subrouter())
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/admin/network-policy", strings.NewReader(body))
+		req.RemoteAddr = "192.0.2.1:1234"
+		return serve(r, asAdmin(req))
+	}
+
+	rec := put(`{"allow":["192.0.2.0/24"],"deny":["192.0.2.66"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if policy.Allowed("198.51.100.1") || !policy.Allowed("192.0.2.9") {
+		t.Error("the new lists should be in force")
+	}
+
+	rec = serve(r, asAdmin(httptest.NewRequest("GET", "/admin/network-policy", nil)))
+	var view networkPolicyView
+	json.Unmarshal(rec.Body.Bytes(), &view)
+	if len(view.Allow) != 1 || view.Deny[0] != "192.0.2.66/32" {
+		t.Errorf("unexpected lists %+v", view)
+	}
+
+	if rec := put(`{"deny":["not-a-cidr"]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid CIDR, got %d", rec.Code)
+	}
+	if rec := put(`{"deny":["192.0.2.0/24"]}`); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 for lists rejecting the caller, got %d", rec.Code)
+	}
+}
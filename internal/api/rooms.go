@@ -0,0 +1,453 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/chat"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/webhook"
+	"github.com/gorilla/mux"
+)
+
+type roomView struct {
+	Name       string            `json:"name"`
+	Visibility string            `json:"visibility"`
+	Topic      string            `json:"topic,omitempty"`
+	SlowMode   int               `json:"slow_mode,omitempty"` // seconds
+	Role       string            `json:"role,omitempty"`      // the caller's role
+	Members    map[string]string `json:"members,omitempty"`   // shown to members and admins
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+type roomRequest struct {
+	Name       string  `json:"name"`
+	Visibility string  `json:"visibility"`
+	Password   *string `json:"password"`
+	Topic      *string `json:"topic"`
+	SlowMode   *int    `json:"slow_mode"` // seconds; 0 disables
+	Owner      string  `json:"owner"`     // admins only
+}
+
+type memberRequest struct {
+	Role string `json:"role"`
+}
+
+// caller is the principal behind an API request.
+type caller struct {
+	username string
+	keyName  string
+	admin    bool
+}
+
+// name identifies the caller in audit records.
+func (c caller) name() string {
+	if c.username != "" {
+		return c.username
+	}
+	return "key:" + c.keyName
+}
+
+func callerFrom(r *http.Request) (caller, bool) {
+	id, ok := middleware.IdentityFromContext(r.Context())
+	if !ok {
+		return caller{}, false
+	}
+	c := caller{username: id.Username, keyName: id.KeyName, admin: id.HasScope(middleware.ScopeAdmin)}
+	return c, c.username != "" || c.admin
+}
+
+// requireCaller writes a 401 and returns false when the request has no
+// user identity to act as.
+func requireCaller(w http.ResponseWriter, r *http.Request) (caller, bool) {
+	c, ok := callerFrom(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "a user identity is required")
+	}
+	return c, ok
+}
+
+// RoomsHandler serves /api/rooms, where owners and moderators manage room
+// access control. Webhooks belong to the room and the owner who created
+// them, so it deletes them with the room and when that owner steps down.
+type RoomsHandler struct {
+	rooms    store.RoomStore
+	hub      *chat.Hub
+	webhooks *webhook.Dispatcher
+	incoming *webhook.Incoming
+}
+
+func NewRoomsHandler(rooms store.RoomStore, hub *chat.Hub, webhooks *webhook.Dispatcher, incoming *webhook.Incoming) *RoomsHandler {
+	return &RoomsHandler{rooms: rooms, hub: hub, webhooks: webhooks, incoming: incoming}
+}
+
+func (h *RoomsHandler) Register(r *mux.Router) {
+	r.HandleFunc("/rooms", h.list).Methods(http.MethodGet)
+	r.HandleFunc("/rooms", h.create).Methods(http.MethodPost)
+	r.HandleFunc("/rooms/{room}", h.get).Methods(http.MethodGet)
+	r.HandleFunc("/rooms/{room}", h.update).Methods(http.MethodPatch)
+	r.HandleFunc("/rooms/{room}", h.delete).Methods(http.MethodDelete)
+	r.HandleFunc("/rooms/{room}/members/{username}", h.setMember).Methods(http.MethodPut)
+	r.HandleFunc("/rooms/{room}/members/{username}", h.removeMember).Methods(http.MethodDelete)
+}
+
+func newRoomView(room *store.Room, c caller) roomView {
+	v := roomView{
+		Name:       room.Name,
+		Visibility: room.Visibility,
+		Topic:      room.Topic,
+		SlowMode:   room.SlowMode,
+		Role:       room.Role(c.username),
+		CreatedAt:  room.CreatedAt,
+	}
+	if v.Role != "" || c.admin {
+		v.Members = room.Members
+	}
+	return v
+}
+
+func (h *RoomsHandler) list(w http.ResponseWriter, r *http.Request) {
+	c, _ := callerFrom(r)
+
+	rooms, err := h.rooms.ListRooms(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list rooms")
+		return
+	}
+
+	views := make([]roomView, 0, len(rooms))
+	for _, room := range rooms {
+		if room.Visibility == store.VisibilityPrivate && room.Role(c.username) == "" && !c.admin {
+			continue
+		}
+		views = append(views, newRoomView(room, c))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"rooms": views})
+}
+
+func (h *RoomsHandler) create(w http.ResponseWriter, r *http.Request) {
+	c, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+
+	var req roomRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if req.Visibility == "" {
+		req.Visibility = store.VisibilityPublic
+	}
+
+	owner := c.username
+	if req.Owner != "" && c.admin {
+		owner = req.Owner
+	}
+	if owner == "" {
+		writeError(w, http.StatusBadRequest, "owner is required")
+		return
+	}
+
+	room := &store.Room{
+		Name:      req.Name,
+		Members:   map[string]string{owner: store.RoleOwner},
+		CreatedAt: time.Now().UTC(),
+	}
+	if !h.apply(w, room, req) {
+		return
+	}
+
+	// Rooms are created by joining them, so an unclaimed room may already
+	// have people and history; only admins may take those over
+	if !c.admin {
+		inUse, err := h.hub.RoomInUse(r.Context(), req.Name)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to create room")
+			return
+		}
+		if inUse {
+			writeError(w, http.StatusForbidden, "room is already in use; ask an admin to claim it")
+			return
+		}
+	}
+
+	err := h.rooms.CreateRoom(r.Context(), room)
+	if errors.Is(err, store.ErrExists) {
+		writeError(w, http.StatusConflict, "room already exists")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create room")
+		return
+	}
+	writeJSON(w, http.StatusCreated, newRoomView(room, c))
+}
+
+// apply copies the settable fields of req onto room.
+func (h *RoomsHandler) apply(w http.ResponseWriter, room *store.Room, req roomRequest) bool {
+	if req.Visibility != "" {
+		if !store.ValidVisibility(req.Visibility) {
+			writeError(w, http.StatusBadRequest, "visibility must be public, private, invite or password")
+			return false
+		}
+		room.Visibility = req.Visibility
+	}
+	if req.Topic != nil {
+		room.Topic = *req.Topic
+	}
+	if req.SlowMode != nil {
+		if *req.SlowMode < 0 || *req.SlowMode > store.MaxSlowMode {
+			writeError(w, http.StatusBadRequest, "slow_mode must be between 0 and 3600 seconds")
+			return false
+		}
+		room.SlowMode = *req.SlowMode
+	}
+	if req.Password != nil {
+		if err := room.SetPassword(*req.Password); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid password")
+			return false
+		}
+	}
+	if room.Visibility == store.VisibilityPassword && room.PasswordHash == "" {
+		writeError(w, http.StatusBadRequest, "password rooms need a password")
+		return false
+	}
+	if room.Visibility != store.VisibilityPassword {
+		room.PasswordHash = ""
+	}
+	return true
+}
+
+func (h *RoomsHandler) load(w http.ResponseWriter, r *http.Request) (*store.Room, bool) {
+	return loadRoom(w, r, h.rooms)
+}
+
+// loadRoom fetches the room in the URL, writing the error response on
+// failure.
+func loadRoom(w http.ResponseWriter, r *http.Request, rooms store.RoomStore) (*store.Room, bool) {
+	room, err := rooms.GetRoom(r.Context(), mux.Vars(r)["room"])
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "room not found")
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load room")
+		return nil, false
+	}
+	return room, true
+}
+
+func (h *RoomsHandler) get(w http.ResponseWriter, r *http.Request) {
+	c, _ := callerFrom(r)
+	room, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	if room.Visibility == store.VisibilityPrivate && room.Role(c.username) == "" && !c.admin {
+		writeError(w, http.StatusNotFound, "room not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, newRoomView(room, c))
+}
+
+func (h *RoomsHandler) update(w http.ResponseWriter, r *http.Request) {
+	c, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+	room, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	var req roomRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	// Moderators may change the topic and slow mode; access settings belong
+	// to the owner
+	owner := room.Role(c.username) == store.RoleOwner || c.admin
+	if !owner && !(room.IsModerator(c.username) && req.Visibility == "" && req.Password == nil) {
+		writeError(w, http.StatusForbidden, "only the room owner can change these settings")
+		return
+	}
+
+	if !h.apply(w, room, req) {
+		return
+	}
+	if err := h.rooms.PutRoom(r.Context(), room); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update room")
+		return
+	}
+	writeJSON(w, http.StatusOK, newRoomView(room, c))
+}
+
+func (h *RoomsHandler) delete(w http.ResponseWriter, r *http.Request) {
+	c, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+	room, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	if room.Role(c.username) != store.RoleOwner && !c.admin {
+		writeError(w, http.StatusForbidden, "only the room owner can delete the room")
+		return
+	}
+
+	// A room created later under the same name must not inherit them
+	if err := h.deleteWebhooks(r.Context(), room.Name, func(string) bool { return true }); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to delete the room's webhooks")
+		return
+	}
+	if err := h.rooms.DeleteRoom(r.Context(), room.Name); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to delete room")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setMember adds a member or changes a role. Owners grant any role but
+// owner; moderators add plain members.
+func (h *RoomsHandler) setMember(w http.ResponseWriter, r *http.Request) {
+	c, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+	room, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	var req memberRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.Role == "" {
+		req.Role = store.RoleMember
+	}
+	if !store.ValidRole(req.Role) {
+		writeError(w, http.StatusBadRequest, "role must be owner, moderator or member")
+		return
+	}
+
+	target := mux.Vars(r)["username"]
+	if !c.admin {
+		switch room.Role(c.username) {
+		case store.RoleOwner:
+			if req.Role == store.RoleOwner || target == c.username {
+				writeError(w, http.StatusForbidden, "ownership can only be transferred by an admin")
+				return
+			}
+		case store.RoleModerator:
+			if req.Role != store.RoleMember || room.Role(target) != "" {
+				writeError(w, http.StatusForbidden, "moderators can only add members")
+				return
+			}
+		default:
+			writeError(w, http.StatusForbidden, "only owners and moderators can manage members")
+			return
+		}
+	}
+
+	if room.Role(target) == store.RoleOwner && req.Role != store.RoleOwner && !h.revokeWebhooks(w, r, room.Name, target) {
+		return
+	}
+	if room.Members == nil {
+		room.Members = make(map[string]string)
+	}
+	room.Members[target] = req.Role
+	if err := h.rooms.PutRoom(r.Context(), room); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update room")
+		return
+	}
+	writeJSON(w, http.StatusOK, newRoomView(room, c))
+}
+
+func (h *RoomsHandler) removeMember(w http.ResponseWriter, r *http.Request) {
+	c, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+	room, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	target := mux.Vars(r)["username"]
+	targetRole := room.Role(target)
+	if targetRole == "" {
+		writeError(w, http.StatusNotFound, "not a member")
+		return
+	}
+
+	allowed := c.admin ||
+		(room.Role(c.username) == store.RoleOwner && targetRole != store.RoleOwner) ||
+		(room.Role(c.username) == store.RoleModerator && targetRole == store.RoleMember) ||
+		(target == c.username && targetRole != store.RoleOwner)
+	if !allowed {
+		writeError(w, http.StatusForbidden, "not allowed to remove this member")
+		return
+	}
+	if targetRole == store.RoleOwner && !h.revokeWebhooks(w, r, room.Name, target) {
+		return
+	}
+
+	delete(room.Members, target)
+	if err := h.rooms.PutRoom(r.Context(), room); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update room")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeWebhooks deletes the webhooks of room created by a user who is
+// about to lose ownership, writing the error response on failure.
+func (h *RoomsHandler) revokeWebhooks(w http.ResponseWriter, r *http.Request, room, username string) bool {
+	err := h.deleteWebhooks(r.Context(), room, func(createdBy string) bool { return createdBy == username })
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to revoke the former owner's webhooks")
+		return false
+	}
+	return true
+}
+
+// deleteWebhooks deletes the outgoing and incoming webhooks of room whose
+// creator matches.
+func (h *RoomsHandler) deleteWebhooks(ctx context.Context, room string, match func(createdBy string) bool) error {
+	hooks, err := h.webhooks.List(ctx, room)
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		if !match(hook.CreatedBy) {
+			continue
+		}
+		if err := h.webhooks.Delete(ctx, room, hook.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+	}
+
+	incoming, err := h.incoming.List(ctx, room)
+	if err != nil {
+		return err
+	}
+	for _, hook := range incoming {
+		if !match(hook.CreatedBy) {
+			continue
+		}
+		if err := h.incoming.Delete(ctx, room, hook.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
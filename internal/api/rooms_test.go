@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/chat"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/webhook"
+	"github.com/gorilla/mux"
+)
+
+func asUser(req *http.Request, username string) *http.Request {
+	return req.WithContext(middleware.WithIdentity(req.Context(), &middleware.Identity{Username: username}))
+}
+
+func serve(r http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func newRoomsRouter(rooms store.RoomStore) *mux.Router {
+	r := mux.NewRouter()
+	hooks := store.NewMemoryStore()
+	NewRoomsHandler(rooms, chat.NewHub(store.NewNoOpStore()), webhook.NewDispatcher(hooks), webhook.NewIncoming(hooks)).
+		Register(r.PathPrefix("/api").Subrouter())
+	return r
+}
+
+// history is a message store holding one message in each of its rooms.
+type history []string
+
+func (h history) SaveMessage(ctx context.Context, msg store.Message) error { return nil }
+
+func (h history) GetRecentMessages(ctx context.Context, room string, limit int) ([]store.Message, error) {
+	if slices.Contains(h, room) {
+		return []store.Message{{Type: "message", Room: room, Content: "hi"}}, nil
+	}
+	return nil, nil
+}
+
+func (h history) Close() error { return nil }
+
+func TestRoomsHandler_CreateRoomInUse(t *testing.T) {
+	rooms := store.NewMemoryStore()
+	r := mux.NewRouter()
+	NewRoomsHandler(rooms, chat.NewHub(history{"general"}), webhook.NewDispatcher(rooms), webhook.NewIncoming(rooms)).
+		Register(r.PathPrefix("/api").Subrouter())
+
+	// Users cannot claim a room that others already talk in
+	rec := serve(r, asUser(httptest.NewRequest("POST", "/api/rooms",
+		strings.NewReader(`{"name":"general","visibility":"private"}`)), "mallory"))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d: %s", rec.Code, rec.Body)
+	}
+
+	req := httptest.NewRequest("POST", "/api/rooms", strings.NewReader(`{"name":"general","owner":"alice"}`))
+	req = req.WithContext(middleware.WithIdentity(req.Context(), &middleware.Identity{
+		KeyName: "ops", Scopes: []string{middleware.ScopeAdmin},
+	}))
+	if rec := serve(r, req); rec.Code != http.StatusCreated {
+		t.Errorf("expected admins to claim the room, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRoomsHandler_CreateAndMembers(t *testing.T) {
+	rooms := store.NewMemoryStore()
+	r := newRoomsRouter(rooms)
+
+	// Anonymous callers cannot claim rooms
+	rec := serve(r, httptest.NewRequest("POST", "/api/rooms", strings.NewReader(`{"name":"ops"}`)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", rec.Code)
+	}
+
+	rec = serve(r, asUser(httptest.NewRequest("POST", "/api/rooms",
+		strings.NewReader(`{"name":"ops","visibility":"private"}`)), "alice"))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+
+	room, _ := rooms.GetRoom(context.Background(), "ops")
+	if room.Role("alice") != store.RoleOwner {
+		t.Errorf("creator should own the room, got %q", room.Role("alice"))
+	}
+
+	// Claiming twice conflicts
+	rec = serve(r, asUser(httptest.NewRequest("POST", "/api/rooms", strings.NewReader(`{"name":"ops"}`)), "bob"))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", rec.Code)
+	}
+
+	// Non-members cannot see or manage the private room
+	rec = serve(r, asUser(httptest.NewRequest("GET", "/api/rooms/ops", nil), "bob"))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for private room, got %d", rec.Code)
+	}
+	rec = serve(r, asUser(httptest.NewRequest("PUT", "/api/rooms/ops/members/bob", strings.NewReader(`{}`)), "bob"))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+
+	// The owner promotes bob to moderator, who may then add members only
+	rec = serve(r, asUser(httptest.NewRequest("PUT", "/api/rooms/ops/members/bob",
+		strings.NewReader(`{"role":"moderator"}`)), "alice"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	rec = serve(r, asUser(httptest.NewRequest("PUT", "/api/rooms/ops/members/carol", strings.NewReader(`{}`)), "bob"))
+	if rec.Code != http.StatusOK {
+		t.Errorf("moderator should add members, got %d", rec.Code)
+	}
+	rec = serve(r, asUser(httptest.NewRequest("PUT", "/api/rooms/ops/members/dave",
+		strings.NewReader(`{"role":"moderator"}`)), "bob"))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("moderator should not grant moderator, got %d", rec.Code)
+	}
+
+	// Members list is visible to members
+	rec = serve(r, asUser(httptest.NewRequest("GET", "/api/rooms/ops", nil), "carol"))
+	var view roomView
+	json.Unmarshal(rec.Body.Bytes(), &view)
+	if view.Role != store.RoleMember || len(view.Members) != 3 {
+		t.Errorf("unexpected view %+v", view)
+	}
+}
+
+func TestRoomsHandler_PasswordRoom(t *testing.T) {
+	rooms := store.NewMemoryStore()
+	r := newRoomsRouter(rooms)
+
+	rec := serve(r, asUser(httptest.NewRequest("POST", "/api/rooms",
+		strings.NewReader(`{"name":"club","visibility":"password"}`)), "alice"))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("password room without password should fail, got %d", rec.Code)
+	}
+
+	rec = serve(r, asUser(httptest.NewRequest("POST", "/api/rooms",
+		strings.NewReader(`{"name":"club","visibility":"password","password":"hunter2"}`)), "alice"))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "password_hash") {
+		t.Error("password hash must not be exposed")
+	}
+
+	room, _ := rooms.GetRoom(context.Background(), "club")
+	if !room.CheckPassword("hunter2") || room.CheckPassword("wrong") {
+		t.Error("password check failed")
+	}
+}
+
+func TestRoomsHandler_SlowMode(t *testing.T) {
+	rooms := store.NewMemoryStore()
+	rooms.CreateRoom(context.Background(), &store.Room{
+		Name:       "ops",
+		Visibility: store.VisibilityPublic,
+		Members:    map[string]string{"alice": store.RoleOwner, "bob": store.RoleModerator},
+	})
+	r := newRoomsRouter(rooms)
+
+	// Moderators may turn slow mode on
+	rec := serve(r, asUser(httptest.NewRequest("PATCH", "/api/rooms/ops", strings.NewReader(`{"slow_mode":30}`)), "bob"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var view roomView
+	json.Unmarshal(rec.Body.Bytes(), &view)
+	if view.SlowMode != 30 {
+		t.Errorf("expected slow mode 30, got %d", view.SlowMode)
+	}
+
+	rec = serve(r, asUser(httptest.NewRequest("PATCH", "/api/rooms/ops", strings.NewReader(`{"slow_mode":7200}`)), "alice"))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for slow mode over the maximum, got %d", rec.Code)
+	}
+	rec = serve(r, asUser(httptest.NewRequest("PATCH", "/api/rooms/ops", strings.NewReader(`{"slow_mode":0}`)), "carol"))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for non-members, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/webhook"
+	"github.com/gorilla/mux"
+)
+
+// webhookView is a webhook without its secret, which is only returned when
+// the webhook is created.
+type webhookView struct {
+	ID        string    `json:"id"`
+	Room      string    `json:"room,omitempty"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newWebhookView(hook store.Webhook) webhookView {
+	events := hook.Events
+	if events == nil {
+		events = []string{}
+	}
+	return webhookView{
+		ID:        hook.ID,
+		Room:      hook.Room,
+		URL:       hook.URL,
+		Events:    events,
+		CreatedBy: hook.CreatedBy,
+		CreatedAt: hook.CreatedAt,
+	}
+}
+
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"` // empty subscribes to every event
+}
+
+// WebhooksHandler serves outgoing webhooks. Room owners manage the
+// webhooks of their room; webhooks for every room are registered on the
+// admin router.
+type WebhooksHandler struct {
+	rooms    store.RoomStore
+	webhooks *webhook.Dispatcher
+}
+
+func NewWebhooksHandler(rooms store.RoomStore, webhooks *webhook.Dispatcher) *WebhooksHandler {
+	return &WebhooksHandler{rooms: rooms, webhooks: webhooks}
+}
+
+func (h *WebhooksHandler) Register(r *mux.Router) {
+	h.routes(r, "/rooms/{room}/webhooks")
+}
+
+// RegisterAdmin adds the routes for webhooks of every room to r, which
+// must already require the admin scope.
+func (h *WebhooksHandler) RegisterAdmin(r *mux.Router) {
+	h.routes(r, "/webhooks")
+}
+
+func (h *WebhooksHandler) routes(r *mux.Router, prefix string) {
+	r.HandleFunc(prefix, h.list).Methods(http.MethodGet)
+	r.HandleFunc(prefix, h.create).Methods(http.MethodPost)
+	r.HandleFunc(prefix+"/{id}", h.get).Methods(http.MethodGet)
+	r.HandleFunc(prefix+"/{id}", h.delete).Methods(http.MethodDelete)
+	r.HandleFunc(prefix+"/{id}/deliveries", h.deliveries).Methods(http.MethodGet)
+	r.HandleFunc(prefix+"/{id}/dead", h.deadLetters).Methods(http.MethodGet)
+	r.HandleFunc(prefix+"/{id}/dead/{delivery}", h.redeliver).Methods(http.MethodPost)
+}
+
+// authorize checks that the caller owns the room in the URL and returns
+// its name. Global routes have no room and are admin-only.
+func (h *WebhooksHandler) authorize(w http.ResponseWriter, r *http.Request) (string, caller, bool) {
+	c, ok := requireCaller(w, r)
+	if !ok {
+		return "", c, false
+	}
+	if _, scoped := mux.Vars(r)["room"]; !scoped {
+		if !c.admin {
+			writeError(w, http.StatusForbidden, "global webhooks require the admin scope")
+			return "", c, false
+		}
+		return "", c, true
+	}
+
+	room, ok := loadRoom(w, r, h.rooms)
+	if !ok {
+		return "", c, false
+	}
+	if room.Role(c.username) != store.RoleOwner && !c.admin {
+		writeError(w, http.StatusForbidden, "only the room owner can manage webhooks")
+		return "", c, false
+	}
+	return room.Name, c, true
+}
+
+func (h *WebhooksHandler) list(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	hooks, err := h.webhooks.List(r.Context(), room)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list webhooks")
+		return
+	}
+	views := make([]webhookView, 0, len(hooks))
+	for _, hook := range hooks {
+		views = append(views, newWebhookView(hook))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"webhooks": views})
+}
+
+func (h *WebhooksHandler) create(w http.ResponseWriter, r *http.Request) {
+	room, c, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	var req webhookRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	hook, err := h.webhooks.Create(r.Context(), room, req.URL, req.Events, c.name())
+	if errors.Is(err, webhook.ErrInvalid) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create webhook")
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"webhook": newWebhookView(hook),
+		"secret":  hook.Secret,
+	})
+}
+
+func (h *WebhooksHandler) get(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	hook, err := h.webhooks.Get(r.Context(), room, mux.Vars(r)["id"])
+	if !h.found(w, err) {
+		return
+	}
+	writeJSON(w, http.StatusOK, newWebhookView(*hook))
+}
+
+func (h *WebhooksHandler) delete(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	if !h.found(w, h.webhooks.Delete(r.Context(), room, mux.Vars(r)["id"])) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deliveries returns the newest delivery attempts, oldest first.
+func (h *WebhooksHandler) deliveries(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	limit := store.MaxDeliveryLog
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		limit = min(n, store.MaxDeliveryLog)
+	}
+
+	deliveries, err := h.webhooks.Deliveries(r.Context(), room, mux.Vars(r)["id"], limit)
+	if !h.found(w, err) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"deliveries": deliveries})
+}
+
+func (h *WebhooksHandler) deadLetters(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	dead, err := h.webhooks.DeadLetters(r.Context(), room, mux.Vars(r)["id"])
+	if !h.found(w, err) {
+		return
+	}
+	if dead == nil {
+		dead = []store.DeadLetter{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"dead_letters": dead})
+}
+
+// redeliver queues a dead letter again.
+func (h *WebhooksHandler) redeliver(w http.ResponseWriter, r *http.Request) {
+	room, _, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	if !h.found(w, h.webhooks.Redeliver(r.Context(), room, vars["id"], vars["delivery"])) {
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// found writes the response for a failed lookup and reports whether err
+// is nil.
+func (h *WebhooksHandler) found(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "webhook not found")
+	default:
+		writeError(w, http.StatusInternalServerError, "failed to load webhook")
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/chat"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/webhook"
+	"github.com/gorilla/mux"
+)
+
+func TestWebhooksHandler(t *testing.T) {
+	s := store.NewMemoryStore()
+	r := mux.NewRouter()
+	sub := r.PathPrefix("/api").Subrouter()
+	webhooks := webhook.NewDispatcher(s)
+	NewRoomsHandler(s, chat.NewHub(store.NewNoOpStore()), webhooks, webhook.NewIncoming(s)).Register(sub)
+	h := NewWebhooksHandler(s, webhooks)
+	h.Register(sub)
+	h.RegisterAdmin(r.PathPrefix("/admin").Subrouter())
+
+	serve(r, asUser(httptest.NewRequest("POST", "/api/rooms", strings.NewReader(`{"name":"ops"}`)), "alice"))
+	serve(r, asUser(httptest.NewRequest("PUT", "/api/rooms/ops/members/bob",
+		strings.NewReader(`{"role":"moderator"}`)), "alice"))
+
+	// Only the owner manages webhooks
+	body := `{"url":"https://hooks.example.com/chat","events":["message","moderation"]}`
+	rec := serve(r, asUser(httptest.NewRequest("POST", "/api/rooms/ops/webhooks", strings.NewReader(body)), "bob"))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a moderator, got %d", rec.Code)
+	}
+
+	rec = serve(r, asUser(httptest.NewRequest("POST", "/api/rooms/ops/webhooks",
+		strings.NewReader(`{"url":"not a url"}`)), "alice"))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad URL, got %d", rec.Code)
+	}
+
+	rec = serve(r, asUser(httptest.NewRequest("POST", "/api/rooms/ops/webhooks", strings.NewReader(body)), "alice"))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	var created struct {
+		Webhook webhookView `json:"webhook"`
+		Secret  string      `json:"secret"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	if created.Secret == "" || created.Webhook.Room != "ops" || len(created.Webhook.Events) != 2 {
+		t.Fatalf("unexpected response %s", rec.Body)
+	}
+
+	// The secret is only shown once
+	rec = serve(r, asUser(httptest.NewRequest("GET", "/api/rooms/ops/webhooks", nil), "alice"))
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), created.Secret) ||
+		!strings.Contains(rec.Body.String(), created.Webhook.ID) {
+		t.Errorf("unexpected list %s", rec.Body)
+	}
+
+	base := "/api/rooms/ops/webhooks/" + created.Webhook.ID
+	for _, path := range []string{base + "/deliveries", base + "/dead"} {
+		rec = serve(r, asUser(httptest.NewRequest("GET", path, nil), "alice"))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", path, rec.Code)
+		}
+	}
+	rec = serve(r, asUser(httptest.NewRequest("POST", base+"/dead/missing", nil), "alice"))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown dead letter, got %d", rec.Code)
+	}
+
+	// Room webhooks are not listed globally
+	rec = serve(r, asAdmin(httptest.NewRequest("GET", "/admin/webhooks", nil)))
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), created.Webhook.ID) {
+		t.Errorf("unexpected global list %s", rec.Body)
+	}
+
+	rec = serve(r, asUser(httptest.NewRequest("DELETE", base, nil), "alice"))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	rec = serve(r, asUser(httptest.NewRequest("GET", base, nil), "alice"))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after delete, got %d", rec.Code)
+	}
+}
+
+// newRoomHooksRouter serves rooms with their outgoing and incoming
+// webhooks from one memory store.
+func newRoomHooksRouter() (*mux.Router, *webhook.Dispatcher, *webhook.Incoming) {
+	s := store.NewMemoryStore()
+	webhooks, incoming := webhook.NewDispatcher(s), webhook.NewIncoming(s)
+	hub := chat.NewHub(store.NewNoOpStore())
+
+	r := mux.NewRouter()
+	sub := r.PathPrefix("/api").Subrouter()
+	NewRoomsHandler(s, hub, webhooks, incoming).Register(sub)
+	NewWebhooksHandler(s, webhooks).Register(sub)
+	in := NewIncomingWebhooksHandler(s, incoming, hub)
+	in.Register(sub)
+	in.RegisterHooks(r)
+	return r, webhooks, incoming
+}
+
+// createHooks adds an outgoing and an incoming webhook to ops as user and
+// returns the incoming one's URL.
+func createHooks(t *testing.T, r *mux.Router, user string) string {
+	t.Helper()
+	rec := serve(r, asUser(httptest.NewRequest("POST", "/api/rooms/ops/webhooks",
+		strings.NewReader(`{"url":"https://hooks.example.com/chat"}`)), user))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	rec = serve(r, asUser(httptest.NewRequest("POST", "/api/rooms/ops/incoming-webhooks",
+		strings.NewReader(`{"name":"CI"}`)), user))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	var created struct {
+		URL string `json:"url"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	return created.URL
+}
+
+// hookCreators lists the creators of the room's outgoing and incoming
+// webhooks.
+func hookCreators(t *testing.T, webhooks *webhook.Dispatcher, incoming *webhook.Incoming, room string) []string {
+	t.Helper()
+	hooks, err := webhooks.List(context.Background(), room)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := incoming.List(context.Background(), room)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var creators []string
+	for _, hook := range hooks {
+		creators = append(creators, "out:"+hook.CreatedBy)
+	}
+	for _, hook := range in {
+		creators = append(creators, "in:"+hook.CreatedBy)
+	}
+	return creators
+}
+
+func TestRoomsHandler_DeleteRemovesWebhooks(t *testing.T) {
+	r, webhooks, incoming := newRoomHooksRouter()
+
+	serve(r, asUser(httptest.NewRequest("POST", "/api/rooms", strings.NewReader(`{"name":"ops"}`)), "alice"))
+	url := createHooks(t, r, "alice")
+
+	rec := serve(r, asUser(httptest.NewRequest("DELETE", "/api/rooms/ops", nil), "alice"))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body)
+	}
+	if creators := hookCreators(t, webhooks, incoming, "ops"); len(creators) != 0 {
+		t.Errorf("expected the room's webhooks to be deleted, got %v", creators)
+	}
+	rec = serve(r, httptest.NewRequest("POST", url, strings.NewReader(`{"content":"late"}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 from the deleted room's incoming webhook, got %d", rec.Code)
+	}
+
+	// A new room of the same name starts without them
+	serve(r, asUser(httptest.NewRequest("POST", "/api/rooms", strings.NewReader(`{"name":"ops"}`)), "mallory"))
+	rec = serve(r, asUser(httptest.NewRequest("GET", "/api/rooms/ops/webhooks", nil), "mallory"))
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "hooks.example.com") {
+		t.Errorf("new owner sees the old webhooks: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRoomsHandler_OwnershipChangeRevokesWebhooks(t *testing.T) {
+	r, webhooks, incoming := newRoomHooksRouter()
+
+	serve(r, asUser(httptest.NewRequest("POST", "/api/rooms", strings.NewReader(`{"name":"ops"}`)), "alice"))
+	createHooks(t, r, "alice")
+	serve(r, asAdmin(httptest.NewRequest("PUT", "/api/rooms/ops/members/bob", strings.NewReader(`{"role":"owner"}`))))
+	url := createHooks(t, r, "bob")
+
+	// Demoting alice revokes her webhooks but keeps bob's
+	rec := serve(r, asAdmin(httptest.NewRequest("PUT", "/api/rooms/ops/members/alice", strings.NewReader(`{"role":"member"}`))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	creators := hookCreators(t, webhooks, incoming, "ops")
+	if !slices.Equal(creators, []string{"out:bob", "in:bob"}) {
+		t.Errorf("expected only bob's webhooks to remain, got %v", creators)
+	}
+
+	// Removing bob as an owner revokes his
+	rec = serve(r, asAdmin(httptest.NewRequest("DELETE", "/api/rooms/ops/members/bob", nil)))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body)
+	}
+	if creators := hookCreators(t, webhooks, incoming, "ops"); len(creators) != 0 {
+		t.Errorf("expected bob's webhooks to be revoked, got %v", creators)
+	}
+	rec = serve(r, httptest.NewRequest("POST", url, strings.NewReader(`{"content":"late"}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 from a revoked incoming webhook, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,132 @@
+// Package botclient runs a chat.Bot in a separate process. It connects to
+// the server's WebSocket endpoint with an API key that has the bot scope
+// and drives the bot with the same events as bots hosted by the hub.
+package botclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/chat"
+	"github.com/gorilla/websocket"
+)
+
+const writeWait = 10 * time.Second
+
+// Conn is a bot's connection to one room.
+type Conn struct {
+	bot  chat.Bot
+	room string
+	conn *websocket.Conn
+
+	mu sync.Mutex // serializes writes
+}
+
+// Dial connects bot to room on the server at serverURL (http, https, ws
+// or wss) and registers the bot's commands. The bot posts as the name of
+// its API key.
+func Dial(ctx context.Context, serverURL, apiKey, room string, bot chat.Bot) (*Conn, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/ws"
+	u.RawQuery = url.Values{"room": {room}}.Encode()
+
+	dialer := websocket.Dialer{
+		HandshakeTimeout: 10 * time.Second,
+		Subprotocols:     []string{chat.ProtocolJSON},
+	}
+	header := http.Header{"Authorization": {"Bearer " + apiKey}}
+	ws, resp, err := dialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		if resp != nil {
+			return nil, errors.New("connecting to " + u.Host + ": " + resp.Status)
+		}
+		return nil, err
+	}
+
+	c := &Conn{bot: bot, room: room, conn: ws}
+	for _, cmd := range bot.Commands() {
+		if err := c.write(chat.Message{Type: "register", Content: cmd.Name + " " + cmd.Usage}); err != nil {
+			ws.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Name implements chat.BotRoom.
+func (c *Conn) Name() string {
+	return c.room
+}
+
+// Say implements chat.BotRoom.
+func (c *Conn) Say(content string) error {
+	if content == "" {
+		return errors.New("empty message")
+	}
+	return c.write(chat.Message{Content: content})
+}
+
+// Run delivers room events to the bot until ctx is done or the server
+// closes the connection.
+func (c *Conn) Run(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() { c.Close() })
+	defer stop()
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		// One message per frame with chat.v1.json; splitting also copes with batches
+		for _, line := range strings.Split(string(data), "\n") {
+			var msg chat.Message
+			if err := json.Unmarshal([]byte(line), &msg); err != nil {
+				continue
+			}
+			if msg.Type == "error" {
+				slog.Warn("bot error", "bot", c.bot.Name(), "room", c.room, "error", msg.Content)
+				continue
+			}
+			chat.DispatchBotEvent(ctx, c.bot, c, msg)
+		}
+	}
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait))
+	return c.conn.Close()
+}
+
+func (c *Conn) write(msg chat.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
@@ -0,0 +1,123 @@
+package botclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/chat"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/config"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/gorilla/websocket"
+)
+
+type greeter struct {
+	chat.BaseBot
+}
+
+func (greeter) Name() string { return "greeter" }
+
+func (greeter) Commands() []chat.Command {
+	return []chat.Command{{Name: "hello"}}
+}
+
+func (greeter) OnJoin(ctx context.Context, room chat.BotRoom, username string) {
+	room.Say("welcome " + username)
+}
+
+func (greeter) OnCommand(ctx context.Context, room chat.BotRoom, cmd chat.BotCommand) {
+	room.Say("hello " + cmd.Username)
+}
+
+func TestConn_Run(t *testing.T) {
+	chat.InitClient(&config.Config{MaxMessageSize: 4096, AllowedOrigins: []string{"*"}})
+	hub := chat.NewHub(store.NewNoOpStore())
+	go hub.Run()
+
+	keys := middleware.NewKeyRegistry(store.NewMemoryKeyStore())
+	secret, _, err := keys.Create(context.Background(), "greeter", []string{middleware.ScopeBot}, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userKey, _, err := keys.Create(context.Background(), "web", []string{middleware.ScopeRead, middleware.ScopeWrite}, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := middleware.NewAuth("", keys)
+	server := httptest.NewServer(auth.MiddlewareFunc(func(w http.ResponseWriter, r *http.Request) {
+		chat.ServeWs(hub, w, r)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bot, err := Dial(ctx, server.URL, secret, "lobby", greeter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- bot.Run(ctx) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.GetClientCount("lobby") != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("bot did not join")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?room=lobby&username=alice"
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer " + userKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if msg := readMessage(t, conn); msg.Content != "welcome alice" || msg.Username != "bot:greeter" || !msg.Bot {
+		t.Errorf("expected flagged welcome from greeter, got %+v", msg)
+	}
+	conn.WriteJSON(chat.Message{Content: "/hello"})
+	if msg := readMessage(t, conn); msg.Content != "hello alice" {
+		t.Errorf("unexpected command reply %+v", msg)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
+
+func TestDial_RejectsUnknownKey(t *testing.T) {
+	keys := middleware.NewKeyRegistry(store.NewMemoryKeyStore())
+	server := httptest.NewServer(middleware.NewAuth("", keys).MiddlewareFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	if _, err := Dial(context.Background(), server.URL, "ck_unknown", "lobby", greeter{}); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+}
+
+// readMessage reads JSON frames until a chat message arrives.
+func readMessage(t *testing.T, conn *websocket.Conn) chat.Message {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for a message: %v", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			var msg chat.Message
+			if json.Unmarshal([]byte(line), &msg) == nil && msg.Type == "message" {
+				return msg
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package chat
+
+import (
+	"sort"
+	"time"
+)
+
+// Transports a client can be connected with.
+const (
+	TransportWebSocket = "websocket"
+	TransportLongPoll  = "longpoll"
+	TransportHosted    = "hosted" // in-process bot
+)
+
+// Connection describes a connected client for administrators.
+type Connection struct {
+	ID            string    `json:"id"`
+	Username      string    `json:"username"`
+	Room          string    `json:"room"`
+	Role          string    `json:"role,omitempty"`
+	Bot           bool      `json:"bot,omitempty"`
+	Transport     string    `json:"transport"`
+	Protocol      string    `json:"protocol,omitempty"`
+	RemoteAddr    string    `json:"remote_addr,omitempty"`
+	IP            string    `json:"ip,omitempty"`
+	ConnectedAt   time.Time `json:"connected_at"`
+	BytesSent     int64     `json:"bytes_sent"`
+	QueueDepth    int       `json:"queue_depth"`
+	QueueCapacity int       `json:"queue_capacity"`
+}
+
+// RoomSummary is a room with its connected clients.
+type RoomSummary struct {
+	Name        string       `json:"name"`
+	Connections []Connection `json:"connections"`
+}
+
+func (c *Client) connection() Connection {
+	conn := Connection{
+		ID:            c.id,
+		Username:      c.name(),
+		Room:          c.room,
+		Role:          c.role,
+		Bot:           c.bot,
+		Transport:     c.transport,
+		RemoteAddr:    c.remoteAddr,
+		IP:            c.ip,
+		ConnectedAt:   c.connectedAt,
+		BytesSent:     c.bytesSent.Load(),
+		QueueDepth:    len(c.send),
+		QueueCapacity: cap(c.send),
+	}
+	if c.conn != nil {
+		conn.Protocol = c.encoding().name
+	}
+	return conn
+}
+
+// Rooms returns every room with connected clients, sorted by name, with
+// its connections sorted by connect time.
+func (h *Hub) Rooms() []RoomSummary {
+	h.mu.RLock()
+	rooms := make([]RoomSummary, 0, len(h.rooms))
+	for name, clients := range h.rooms {
+		room := RoomSummary{Name: name, Connections: make([]Connection, 0, len(clients))}
+		for c := range clients {
+			room.Connections = append(room.Connections, c.connection())
+		}
+		rooms = append(rooms, room)
+	}
+	h.mu.RUnlock()
+
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].Name < rooms[j].Name })
+	for _, room := range rooms {
+		sort.Slice(room.Connections, func(i, j int) bool {
+			return room.Connections[i].ConnectedAt.Before(room.Connections[j].ConnectedAt)
+		})
+	}
+	return rooms
+}
+
+// Disconnect closes the connection with the given id and reports whether
+// it was found.
+func (h *Hub) Disconnect(id, reason string) bool {
+	clients := h.clientsMatching("", func(c *Client) bool { return c.id == id })
+	for _, c := range clients {
+		c.disconnect(withReason("you were disconnected by an administrator", reason))
+	}
+	return len(clients) > 0
+}
+
+// CloseRoom disconnects every client of room and returns how many there
+// were. Clients may join again, which opens the room anew.
+func (h *Hub) CloseRoom(room, reason string) int {
+	if room == "" {
+		return 0
+	}
+	clients := h.clientsMatching(room, func(*Client) bool { return true })
+	for _, c := range clients {
+		c.disconnect(withReason("the room was closed", reason))
+	}
+	return len(clients)
+}
+
+// Announce broadcasts a system announcement to room, or to every room
+// with connected clients when room is empty, and returns the rooms it was
+// sent to. Announcements are not persisted.
+func (h *Hub) Announce(room, content string) []string {
+	var rooms []string
+	if room != "" {
+		rooms = []string{room}
+	} else {
+		h.mu.RLock()
+		for name := range h.rooms {
+			rooms = append(rooms, name)
+		}
+		h.mu.RUnlock()
+		sort.Strings(rooms)
+	}
+
+	for _, name := range rooms {
+		h.BroadcastMessage(Message{
+			Type:    "announcement",
+			Content: content,
+			Room:    name,
+			Time:    time.Now().Format(time.RFC3339),
+		})
+	}
+	return rooms
+}
@@ -0,0 +1,108 @@
+package chat
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHub_Rooms(t *testing.T) {
+	hub, _, _, server := newModeratedServer(t)
+
+	alice := dialChat(t, server, "room=lobby&username=alice")
+	defer alice.Close()
+	readUntil(t, alice, "join")
+	bob := dialChat(t, server, "room=ops&username=bob")
+	defer bob.Close()
+	waitForClients(t, hub, "ops", 1)
+
+	rooms := hub.Rooms()
+	if len(rooms) != 2 || rooms[0].Name != "lobby" || rooms[1].Name != "ops" {
+		t.Fatalf("unexpected rooms %+v", rooms)
+	}
+	c := rooms[0].Connections[0]
+	if c.ID == "" || c.Username != "alice" || c.Transport != TransportWebSocket || c.Protocol != ProtocolJSON {
+		t.Errorf("unexpected connection %+v", c)
+	}
+	if c.RemoteAddr == "" || c.ConnectedAt.IsZero() || c.QueueCapacity != 256 {
+		t.Errorf("missing connection metadata %+v", c)
+	}
+	if c.BytesSent == 0 {
+		t.Error("the join message should count as bytes sent")
+	}
+	if rooms[1].Connections[0].ID == c.ID {
+		t.Error("connection ids should be unique")
+	}
+}
+
+func TestHub_DisconnectAndCloseRoom(t *testing.T) {
+	hub, _, _, server := newModeratedServer(t)
+
+	alice := dialChat(t, server, "room=lobby&username=alice")
+	defer alice.Close()
+	bob := dialChat(t, server, "room=lobby&username=bob")
+	defer bob.Close()
+	waitForClients(t, hub, "lobby", 2)
+
+	if hub.Disconnect("nope", "") {
+		t.Error("unknown ids should not be found")
+	}
+	var aliceID string
+	for _, c := range hub.Rooms()[0].Connections {
+		if c.Username == "alice" {
+			aliceID = c.ID
+		}
+	}
+	if !hub.Disconnect(aliceID, "maintenance") {
+		t.Fatal("expected alice's connection to be found")
+	}
+	expectClose(t, alice, "you were disconnected by an administrator: maintenance")
+	waitForClients(t, hub, "lobby", 1)
+
+	if n := hub.CloseRoom("lobby", ""); n != 1 {
+		t.Errorf("expected 1 client disconnected, got %d", n)
+	}
+	expectClose(t, bob, "the room was closed")
+	waitForClients(t, hub, "lobby", 0)
+}
+
+func TestHub_Announce(t *testing.T) {
+	hub, _, _, server := newModeratedServer(t)
+
+	alice := dialChat(t, server, "room=lobby&username=alice")
+	defer alice.Close()
+	bob := dialChat(t, server, "room=ops&username=bob")
+	defer bob.Close()
+	waitForClients(t, hub, "lobby", 1)
+	waitForClients(t, hub, "ops", 1)
+
+	if rooms := hub.Announce("", "restarting soon"); len(rooms) != 2 {
+		t.Errorf("expected both rooms, got %v", rooms)
+	}
+	for _, conn := range []*websocket.Conn{alice, bob} {
+		if msg := readUntil(t, conn, "announcement"); msg.Content != "restarting soon" {
+			t.Errorf("unexpected announcement %+v", msg)
+		}
+	}
+
+	hub.Announce("ops", "ops only")
+	if msg := readUntil(t, bob, "announcement"); msg.Content != "ops only" {
+		t.Errorf("unexpected announcement %+v", msg)
+	}
+}
+
+// expectClose reads from conn until the server closes it with reason.
+func expectClose(t *testing.T, conn *websocket.Conn, reason string) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var err error
+	for err == nil {
+		_, _, err = conn.ReadMessage()
+	}
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Text != reason {
+		t.Errorf("expected close with %q, got %v", reason, err)
+	}
+}
@@ -0,0 +1,259 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/invite"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+)
+
+// rejection is the structured response sent when a client may not join the
+// room it asked for. It is written before the WebSocket upgrade so that the
+// client sees a regular HTTP status.
+type rejection struct {
+	status  int
+	Code    string `json:"error"`
+	Message string `json:"message"`
+}
+
+func (rej *rejection) write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(rej.status)
+	json.NewEncoder(w).Encode(rej)
+}
+
+const anonymous = "anonymous"
+
+// admission is the outcome of admitting a connection request.
+type admission struct {
+	room     string
+	username string
+	ip       string
+	identity *middleware.Identity // nil when auth is disabled
+	role     string               // room role, "" for non-members
+}
+
+// admit decides whether r may join the room it asks for, applying the
+// defaults shared by every transport. When the identity carries a username
+// it is used and ?username= is ignored. An admitted request holds a
+// connection slot, which the caller must release if it does not register
+// a client.
+func admit(hub *Hub, r *http.Request) (*admission, *rejection) {
+	a := &admission{
+		room:     r.URL.Query().Get("room"),
+		username: r.URL.Query().Get("username"),
+		ip:       middleware.ClientIP(r),
+	}
+
+	if a.room == "" {
+		a.room = "general"
+	}
+
+	if id, ok := middleware.IdentityFromContext(r.Context()); ok {
+		if !id.HasScope(middleware.ScopeRead) {
+			return nil, &rejection{
+				status:  http.StatusForbidden,
+				Code:    "scope_required",
+				Message: "credentials lack the read scope",
+			}
+		}
+		if !id.CanJoin(a.room) {
+			return nil, &rejection{
+				status:  http.StatusForbidden,
+				Code:    "room_forbidden",
+				Message: "identity is not allowed to join room " + a.room,
+			}
+		}
+		if id.Username != "" {
+			a.username = id.Username
+		}
+		a.identity = id
+	}
+
+	if a.username == "" {
+		a.username = anonymous
+	}
+	if authenticatedName(a.identity) == "" && strings.HasPrefix(a.username, middleware.BotPrefix) {
+		return nil, &rejection{
+			status:  http.StatusBadRequest,
+			Code:    "username_reserved",
+			Message: "usernames starting with " + middleware.BotPrefix + " are reserved for bots",
+		}
+	}
+
+	if hub.moderation != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		ban := hub.moderation.banned(ctx, a.room, a.username, a.ip)
+		cancel()
+		if ban != nil {
+			return nil, &rejection{
+				status:  http.StatusForbidden,
+				Code:    "banned",
+				Message: sanctionNotice("you are banned", ban),
+			}
+		}
+	}
+
+	if rej := a.checkRoomACL(hub, r); rej != nil {
+		return nil, rej
+	}
+
+	// Last, so that no other rejection has to give the slot back
+	err := hub.reserveConnection(a.ip, authenticatedName(a.identity))
+	if errors.Is(err, errServerFull) {
+		return nil, &rejection{
+			status:  http.StatusServiceUnavailable,
+			Code:    "server_full",
+			Message: err.Error(),
+		}
+	}
+	if err != nil {
+		return nil, &rejection{
+			status:  http.StatusTooManyRequests,
+			Code:    "too_many_connections",
+			Message: err.Error(),
+		}
+	}
+	return a, nil
+}
+
+// authenticatedName returns the username vouched for by id, or "" when the
+// client picked its own name, which must never confer a room role.
+func authenticatedName(id *middleware.Identity) string {
+	if id == nil {
+		return ""
+	}
+	return id.Username
+}
+
+// checkRoomACL applies the room's visibility and membership rules. Roles
+// come from the authenticated username only; members-only rooms reject
+// clients without one. Admins may join any room.
+func (a *admission) checkRoomACL(hub *Hub, r *http.Request) *rejection {
+	if hub.roomStore == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	room, err := hub.roomStore.GetRoom(ctx, a.room)
+	cancel()
+
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		slog.Error("failed to load room metadata", "error", err, "room", a.room)
+		return &rejection{
+			status:  http.StatusServiceUnavailable,
+			Code:    "room_unavailable",
+			Message: "room metadata is temporarily unavailable",
+		}
+	}
+
+	name := authenticatedName(a.identity)
+	if name != "" {
+		a.role = room.Role(name)
+	}
+	if a.role != "" || (a.identity != nil && a.identity.HasScope(middleware.ScopeAdmin)) {
+		return nil
+	}
+
+	if token := r.URL.Query().Get("invite"); token != "" && room.Visibility != store.VisibilityPublic {
+		return a.redeemInvite(hub, r, token)
+	}
+
+	switch room.Visibility {
+	case store.VisibilityPrivate:
+		return &rejection{
+			status:  http.StatusForbidden,
+			Code:    "room_private",
+			Message: "room " + a.room + " is private",
+		}
+	case store.VisibilityInvite:
+		return &rejection{
+			status:  http.StatusForbidden,
+			Code:    "invite_required",
+			Message: "room " + a.room + " requires an invitation",
+		}
+	case store.VisibilityPassword:
+		password := r.Header.Get("X-Room-Password")
+		if password == "" {
+			password = r.URL.Query().Get("password")
+		}
+		if password == "" {
+			return &rejection{
+				status:  http.StatusUnauthorized,
+				Code:    "password_required",
+				Message: "room " + a.room + " is password protected",
+			}
+		}
+		if !room.CheckPassword(password) {
+			return &rejection{
+				status:  http.StatusForbidden,
+				Code:    "password_invalid",
+				Message: "wrong password for room " + a.room,
+			}
+		}
+	}
+	return nil
+}
+
+// redeemInvite admits a non-member holding an invite link to the room and
+// records them as a member, so later connections need no invite.
+func (a *admission) redeemInvite(hub *Hub, r *http.Request, token string) *rejection {
+	if hub.invites == nil {
+		return &rejection{
+			status:  http.StatusForbidden,
+			Code:    "invite_invalid",
+			Message: "invite links are not enabled",
+		}
+	}
+
+	claims, err := hub.invites.Parse(token)
+	if err == nil && claims.Room != a.room {
+		err = invite.ErrInvalid
+	}
+	if err == nil && authenticatedName(a.identity) == "" {
+		return &rejection{
+			status:  http.StatusUnauthorized,
+			Code:    "login_required",
+			Message: "sign in to accept the invite",
+		}
+	}
+	if err == nil {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		_, err = hub.invites.Redeem(ctx, token, a.username)
+		cancel()
+	}
+
+	switch {
+	case err == nil:
+		a.role = store.RoleMember
+		slog.Info("invite redeemed", "room", a.room, "username", a.username)
+		return nil
+	case errors.Is(err, store.ErrInviteExpired):
+		return &rejection{status: http.StatusForbidden, Code: "invite_expired", Message: "the invite has expired"}
+	case errors.Is(err, store.ErrInviteRevoked):
+		return &rejection{status: http.StatusForbidden, Code: "invite_revoked", Message: "the invite has been revoked"}
+	case errors.Is(err, store.ErrInviteUsed):
+		return &rejection{status: http.StatusForbidden, Code: "invite_used", Message: "you have already used this invite"}
+	case errors.Is(err, store.ErrInviteExhausted):
+		return &rejection{status: http.StatusForbidden, Code: "invite_exhausted", Message: "the invite has no uses left"}
+	case errors.Is(err, invite.ErrInvalid):
+		return &rejection{status: http.StatusForbidden, Code: "invite_invalid", Message: "the invite is not valid for room " + a.room}
+	default:
+		slog.Error("failed to redeem invite", "error", err, "room", a.room)
+		return &rejection{
+			status:  http.StatusServiceUnavailable,
+			Code:    "room_unavailable",
+			Message: "room metadata is temporarily unavailable",
+		}
+	}
+}
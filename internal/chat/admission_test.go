@@ -0,0 +1,392 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/invite"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+)
+
+func TestAdmit_Defaults(t *testing.T) {
+	adm, rej := admit(NewHub(store.NewNoOpStore()), httptest.NewRequest("GET", "/ws", nil))
+	if rej != nil {
+		t.Fatalf("unexpected rejection: %+v", rej)
+	}
+	if adm.room != "general" || adm.username != "anonymous" {
+		t.Errorf("expected general/anonymous, got %s/%s", adm.room, adm.username)
+	}
+}
+
+func TestAdmit_IdentityOverridesUsername(t *testing.T) {
+	req := httptest.NewRequest("GET", "/ws?room=ops&username=mallory", nil)
+	req = req.WithContext(middleware.WithIdentity(req.Context(), &middleware.Identity{
+		Username: "alice",
+		Rooms:    []string{"ops"},
+	}))
+
+	adm, rej := admit(NewHub(store.NewNoOpStore()), req)
+	if rej != nil {
+		t.Fatalf("unexpected rejection: %+v", rej)
+	}
+	if adm.room != "ops" || adm.username != "alice" {
+		t.Errorf("expected ops/alice, got %s/%s", adm.room, adm.username)
+	}
+}
+
+func TestAdmit_BotNamesReserved(t *testing.T) {
+	_, rej := admit(NewHub(store.NewNoOpStore()), httptest.NewRequest("GET", "/ws?username=bot:greeter", nil))
+	if rej == nil || rej.status != http.StatusBadRequest || rej.Code != "username_reserved" {
+		t.Errorf("expected username_reserved, got %+v", rej)
+	}
+}
+
+func TestAdmit_RoomNotInClaims(t *testing.T) {
+	req := httptest.NewRequest("GET", "/ws?room=secret", nil)
+	req = req.WithContext(middleware.WithIdentity(req.Context(), &middleware.Identity{
+		Username: "alice",
+		Rooms:    []string{"ops"},
+	}))
+
+	_, rej := admit(NewHub(store.NewNoOpStore()), req)
+	if rej == nil {
+		t.Fatal("expected rejection for room outside the identity's claims")
+	}
+
+	rec := httptest.NewRecorder()
+	rej.write(rec)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+
+	var body map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if body["error"] != "room_forbidden" {
+		t.Errorf("expected error room_forbidden, got %q", body["error"])
+	}
+}
+
+func TestAdmit_RequiresReadScope(t *testing.T) {
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req = req.WithContext(middleware.WithIdentity(req.Context(), &middleware.Identity{
+		Scopes:  []string{middleware.ScopeWrite},
+		KeyName: "ingest",
+	}))
+
+	if _, rej := admit(NewHub(store.NewNoOpStore()), req); rej == nil || rej.Code != "scope_required" {
+		t.Errorf("expected scope_required rejection, got %+v", rej)
+	}
+}
+
+func TestAdmit_KeyWithoutUsernameKeepsQueryName(t *testing.T) {
+	req := httptest.NewRequest("GET", "/ws?username=bob", nil)
+	req = req.WithContext(middleware.WithIdentity(req.Context(), &middleware.Identity{
+		Scopes:  []string{middleware.ScopeRead},
+		KeyName: "web",
+	}))
+
+	adm, rej := admit(NewHub(store.NewNoOpStore()), req)
+	if rej != nil {
+		t.Fatalf("unexpected rejection: %+v", rej)
+	}
+	if adm.username != "bob" {
+		t.Errorf("expected username bob, got %s", adm.username)
+	}
+}
+
+func newACLHub(t *testing.T) *Hub {
+	t.Helper()
+
+	rooms := store.NewMemoryStore()
+	private := &store.Room{Name: "ops", Visibility: store.VisibilityPrivate,
+		Members: map[string]string{"alice": store.RoleOwner}}
+	invite := &store.Room{Name: "vip", Visibility: store.VisibilityInvite, Members: map[string]string{}}
+	password := &store.Room{Name: "club", Visibility: store.VisibilityPassword, Members: map[string]string{}}
+	password.SetPassword("hunter2")
+	for _, room := range []*store.Room{private, invite, password} {
+		rooms.PutRoom(context.Background(), room)
+	}
+
+	hub := NewHub(store.NewNoOpStore())
+	hub.SetRoomStore(rooms)
+	return hub
+}
+
+func TestAdmit_RoomACL(t *testing.T) {
+	hub := newACLHub(t)
+
+	cases := []struct {
+		target   string
+		identity *middleware.Identity
+		code     string
+		status   int
+	}{
+		{"/ws?room=ops&username=bob", nil, "room_private", http.StatusForbidden},
+		{"/ws?room=ops&username=alice", nil, "room_private", http.StatusForbidden}, // a picked name is no membership
+		{"/ws?room=ops", &middleware.Identity{Username: "alice"}, "", 0},
+		{"/ws?room=ops&username=alice", &middleware.Identity{Scopes: []string{middleware.ScopeRead}}, "room_private", http.StatusForbidden},
+		{"/ws?room=vip&username=bob", nil, "invite_required", http.StatusForbidden},
+		{"/ws?room=club&username=bob", nil, "password_required", http.StatusUnauthorized},
+		{"/ws?room=club&username=bob&password=wrong", nil, "password_invalid", http.StatusForbidden},
+		{"/ws?room=club&username=bob&password=hunter2", nil, "", 0},
+		{"/ws?room=unclaimed&username=bob", nil, "", 0},
+		{"/ws?room=ops", &middleware.Identity{Scopes: []string{middleware.ScopeAdmin}}, "", 0},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest("GET", tc.target, nil)
+		if tc.identity != nil {
+			req = req.WithContext(middleware.WithIdentity(req.Context(), tc.identity))
+		}
+
+		adm, rej := admit(hub, req)
+		if tc.code == "" {
+			if rej != nil {
+				t.Errorf("%s: unexpected rejection %s", tc.target, rej.Code)
+			}
+			continue
+		}
+		if rej == nil {
+			t.Errorf("%s: expected %s, got admitted as %+v", tc.target, tc.code, adm)
+			continue
+		}
+		if rej.Code != tc.code || rej.status != tc.status {
+			t.Errorf("%s: expected %s/%d, got %s/%d", tc.target, tc.code, tc.status, rej.Code, rej.status)
+		}
+	}
+}
+
+// asUser authenticates req as the user name, as JWT or SSO logins do.
+func asUser(req *http.Request, name string) *http.Request {
+	return req.WithContext(middleware.WithIdentity(req.Context(), &middleware.Identity{Username: name}))
+}
+
+func TestAdmit_RoomRole(t *testing.T) {
+	hub := newACLHub(t)
+
+	adm, rej := admit(hub, asUser(httptest.NewRequest("GET", "/ws?room=ops", nil), "alice"))
+	if rej != nil {
+		t.Fatalf("unexpected rejection: %+v", rej)
+	}
+	if adm.role != store.RoleOwner {
+		t.Errorf("expected owner role, got %q", adm.role)
+	}
+
+	// Picking the owner's name in a public room confers nothing
+	rooms := hub.roomStore.(*store.MemoryStore)
+	rooms.PutRoom(context.Background(), &store.Room{Name: "lobby", Visibility: store.VisibilityPublic,
+		Members: map[string]string{"alice": store.RoleOwner}})
+	adm, rej = admit(hub, httptest.NewRequest("GET", "/ws?room=lobby&username=alice", nil))
+	if rej != nil {
+		t.Fatalf("unexpected rejection: %+v", rej)
+	}
+	if adm.role != "" {
+		t.Errorf("expected no role for a picked name, got %q", adm.role)
+	}
+}
+
+func TestAdmit_InviteLink(t *testing.T) {
+	hub := newACLHub(t)
+	rooms := hub.roomStore.(*store.MemoryStore)
+	invites := invite.NewManager(middleware.NewSigner("test-secret"), rooms, rooms)
+	hub.SetInvites(invites)
+
+	token, _, err := invites.Create(context.Background(), "ops", "alice", time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := "&invite=" + url.QueryEscape(token)
+
+	// The token is bound to its room
+	_, rej := admit(hub, httptest.NewRequest("GET", "/ws?room=vip&username=bob"+link, nil))
+	if rej == nil || rej.Code != "invite_invalid" {
+		t.Errorf("expected invite_invalid for another room, got %+v", rej)
+	}
+
+	_, rej = admit(hub, httptest.NewRequest("GET", "/ws?room=ops&username=bob"+link, nil))
+	if rej == nil || rej.Code != "login_required" {
+		t.Errorf("expected login_required, got %+v", rej)
+	}
+
+	adm, rej := admit(hub, asUser(httptest.NewRequest("GET", "/ws?room=ops"+link, nil), "bob"))
+	if rej != nil {
+		t.Fatalf("unexpected rejection: %+v", rej)
+	}
+	if adm.role != store.RoleMember {
+		t.Errorf("expected member role, got %q", adm.role)
+	}
+
+	// bob is now a member and needs no invite; the single use is spent
+	if _, rej := admit(hub, asUser(httptest.NewRequest("GET", "/ws?room=ops", nil), "bob")); rej != nil {
+		t.Errorf("member rejected: %+v", rej)
+	}
+	_, rej = admit(hub, asUser(httptest.NewRequest("GET", "/ws?room=ops"+link, nil), "carol"))
+	if rej == nil || rej.Code != "invite_exhausted" {
+		t.Errorf("expected invite_exhausted, got %+v", rej)
+	}
+}
+
+func TestAdmit_ConnectionLimit(t *testing.T) {
+	hub := NewHub(store.NewNoOpStore())
+	hub.SetMaxConnections(2)
+	go hub.Run()
+
+	// A registered client and an admitted one that has not registered yet
+	// both count
+	if _, rej := admit(hub, httptest.NewRequest("GET", "/ws", nil)); rej != nil {
+		t.Fatalf("unexpected rejection: %+v", rej)
+	}
+	alice := &Client{hub: hub, send: make(chan []byte, 1), room: "general", username: "alice", reserved: true}
+	hub.register <- alice
+	waitForClients(t, hub, "general", 1)
+	adm, rej := admit(hub, httptest.NewRequest("GET", "/ws", nil))
+	if rej != nil {
+		t.Fatalf("unexpected rejection: %+v", rej)
+	}
+
+	_, rej = admit(hub, httptest.NewRequest("GET", "/ws", nil))
+	if rej == nil || rej.status != http.StatusServiceUnavailable || rej.Code != "server_full" {
+		t.Errorf("expected server_full, got %+v", rej)
+	}
+	if hub.CheckCapacity(context.Background()) == nil {
+		t.Error("capacity check should fail at the limit")
+	}
+
+	// Both a released slot and a departed client free a place
+	hub.releaseConnection(adm.ip, "")
+	if _, rej := admit(hub, httptest.NewRequest("GET", "/ws", nil)); rej != nil {
+		t.Errorf("unexpected rejection after release: %+v", rej)
+	}
+	hub.unregister <- alice
+	waitForClients(t, hub, "general", 0)
+	if _, rej := admit(hub, httptest.NewRequest("GET", "/ws", nil)); rej != nil {
+		t.Errorf("unexpected rejection after disconnect: %+v", rej)
+	}
+}
+
+func TestAdmit_ConnectionLimitConcurrent(t *testing.T) {
+	hub := NewHub(store.NewNoOpStore())
+	hub.SetMaxConnections(5)
+	go hub.Run()
+
+	var admitted atomic.Int32
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, rej := admit(hub, withRemote(fmt.Sprintf("10.0.%d.1:1234", i))); rej == nil {
+				admitted.Add(1)
+			} else if rej.Code != "server_full" {
+				t.Errorf("expected server_full, got %+v", rej)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := admitted.Load(); n != 5 {
+		t.Errorf("expected exactly 5 admissions, got %d", n)
+	}
+}
+
+func TestAdmit_ConnectionCaps(t *testing.T) {
+	hub := NewHub(store.NewNoOpStore())
+	hub.SetConnectionCaps(2, 1)
+	go hub.Run()
+
+	alice := &middleware.Identity{Username: "alice", Scopes: []string{middleware.ScopeRead}}
+	asAlice := func(remote string) *http.Request {
+		req := httptest.NewRequest("GET", "/ws", nil)
+		req.RemoteAddr = remote
+		return req.WithContext(middleware.WithIdentity(req.Context(), alice))
+	}
+
+	// Slots are taken on admission, before the clients register
+	if _, rej := admit(hub, asAlice("10.0.0.1:1234")); rej != nil {
+		t.Fatalf("unexpected rejection: %+v", rej)
+	}
+	if _, rej := admit(hub, withRemote("10.0.0.1:1235")); rej != nil {
+		t.Fatalf("unexpected rejection: %+v", rej)
+	}
+	first := &Client{hub: hub, send: make(chan []byte, 1), room: "general", username: "alice",
+		ip: "10.0.0.1", identity: alice, reserved: true}
+	hub.register <- first
+	hub.register <- &Client{hub: hub, send: make(chan []byte, 1), room: "general", username: "bob", ip: "10.0.0.1", reserved: true}
+	waitForClients(t, hub, "general", 2)
+
+	// The address has two connections, and alice one, elsewhere
+	_, rej := admit(hub, httptest.NewRequest("GET", "/ws", nil))
+	if rej != nil {
+		t.Fatalf("unexpected rejection: %+v", rej)
+	}
+	_, rej = admit(hub, withRemote("10.0.0.1:1236"))
+	if rej == nil || rej.status != http.StatusTooManyRequests || rej.Code != "too_many_connections" {
+		t.Errorf("expected the IP cap, got %+v", rej)
+	}
+	_, rej = admit(hub, asAlice("10.0.0.2:1234"))
+	if rej == nil || rej.Code != "too_many_connections" || !strings.Contains(rej.Message, "account") {
+		t.Errorf("expected the user cap, got %+v", rej)
+	}
+
+	// Counts drop when clients leave
+	hub.unregister <- first
+	waitForClients(t, hub, "general", 1)
+	if _, rej := admit(hub, asAlice("10.0.0.2:1234")); rej != nil {
+		t.Errorf("unexpected rejection after disconnect: %+v", rej)
+	}
+}
+
+func TestAdmit_EvictionReleasesConnectionSlot(t *testing.T) {
+	hub := NewHub(store.NewNoOpStore())
+	hub.SetConnectionCaps(1, 0)
+	go hub.Run()
+
+	if _, rej := admit(hub, withRemote("10.0.0.1:1234")); rej != nil {
+		t.Fatalf("unexpected rejection: %+v", rej)
+	}
+	hub.register <- &Client{hub: hub, send: make(chan []byte, 1), room: "general", username: "slow", ip: "10.0.0.1", reserved: true}
+	waitForClients(t, hub, "general", 1)
+
+	// The second message overflows the send buffer and evicts the client
+	for range 2 {
+		hub.BroadcastMessage(Message{Type: "message", Username: "bob", Content: "hi", Room: "general"})
+	}
+	waitForClients(t, hub, "general", 0)
+
+	if _, rej := admit(hub, withRemote("10.0.0.1:1235")); rej != nil {
+		t.Errorf("expected the evicted client's slot to be free, got %+v", rej)
+	}
+}
+
+func TestServeWs_FailedUpgradeReleasesConnectionSlot(t *testing.T) {
+	hub := NewHub(store.NewNoOpStore())
+	hub.SetConnectionCaps(1, 0)
+	go hub.Run()
+
+	// A plain GET is admitted but cannot be upgraded
+	rec := httptest.NewRecorder()
+	ServeWs(hub, rec, withRemote("10.0.0.1:1234"))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected the upgrade to fail, got %d", rec.Code)
+	}
+	if _, rej := admit(hub, withRemote("10.0.0.1:1235")); rej != nil {
+		t.Errorf("expected the failed upgrade to release its slot, got %+v", rej)
+	}
+}
+
+// withRemote returns a request to /ws from the address remote.
+func withRemote(remote string) *http.Request {
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req.RemoteAddr = remote
+	return req
+}
@@ -0,0 +1,237 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+)
+
+// Bot is a chat participant written in Go. Bots hosted by the Hub (see
+// AddBot) join rooms without a network connection; the same interface is
+// driven over a WebSocket by the botclient package for bots that run in a
+// separate process with a bot API key.
+//
+// Handlers for one room are called sequentially and should return quickly:
+// a bot that falls behind is disconnected like any slow client.
+type Bot interface {
+	// Name is the username the bot posts as. Bots connected with an API key
+	// named after it appear as middleware.BotPrefix followed by the name.
+	Name() string
+	// Commands declares the slash commands the bot answers. The Handler
+	// field is ignored; invocations are delivered to OnCommand.
+	Commands() []Command
+
+	OnMessage(ctx context.Context, room BotRoom, msg Message)
+	OnJoin(ctx context.Context, room BotRoom, username string)
+	OnLeave(ctx context.Context, room BotRoom, username string)
+	OnCommand(ctx context.Context, room BotRoom, cmd BotCommand)
+}
+
+// BaseBot provides no-op handlers for embedding in bots that only need
+// some of them.
+type BaseBot struct{}
+
+func (BaseBot) Commands() []Command                            { return nil }
+func (BaseBot) OnMessage(context.Context, BotRoom, Message)    {}
+func (BaseBot) OnJoin(context.Context, BotRoom, string)        {}
+func (BaseBot) OnLeave(context.Context, BotRoom, string)       {}
+func (BaseBot) OnCommand(context.Context, BotRoom, BotCommand) {}
+
+// BotRoom is a room the bot has joined.
+type BotRoom interface {
+	Name() string
+	// Say posts content to the room as the bot.
+	Say(content string) error
+}
+
+// BotCommand is a slash command addressed to a bot.
+type BotCommand struct {
+	Name     string
+	Username string   // who ran the command
+	Args     []string // whitespace-separated arguments
+	Text     string   // everything after the command name
+}
+
+// ParseBotCommand parses the content of a "command" message, which carries
+// the command line as typed.
+func ParseBotCommand(msg Message) BotCommand {
+	name, rest, _ := strings.Cut(strings.TrimPrefix(msg.Content, "/"), " ")
+	return BotCommand{
+		Name:     name,
+		Username: msg.Username,
+		Args:     strings.Fields(rest),
+		Text:     strings.TrimSpace(rest),
+	}
+}
+
+// DispatchBotEvent calls the bot handler for msg. Messages the bot sent
+// itself are skipped.
+func DispatchBotEvent(ctx context.Context, bot Bot, room BotRoom, msg Message) {
+	// Bots connected with an API key post as the key name with BotPrefix
+	own := msg.Username == bot.Name() || msg.Username == middleware.BotPrefix+bot.Name()
+	self := msg.Bot && own
+	switch msg.Type {
+	case "message", "action":
+		if !self {
+			bot.OnMessage(ctx, room, msg)
+		}
+	case "join":
+		if !own {
+			bot.OnJoin(ctx, room, msg.Username)
+		}
+	case "leave":
+		if !own {
+			bot.OnLeave(ctx, room, msg.Username)
+		}
+	case "command":
+		bot.OnCommand(ctx, room, ParseBotCommand(msg))
+	}
+}
+
+// hostedRoom is a room joined by an in-process bot.
+type hostedRoom struct {
+	client *Client
+}
+
+func (r *hostedRoom) Name() string {
+	return r.client.room
+}
+
+func (r *hostedRoom) Say(content string) error {
+	if content == "" {
+		return errors.New("empty message")
+	}
+	r.client.hub.BroadcastMessage(Message{
+		Type:     "message",
+		Username: r.client.name(),
+		Content:  content,
+		Room:     r.client.room,
+		Time:     time.Now().Format(time.RFC3339),
+		Bot:      true,
+	})
+	return nil
+}
+
+// AddBot joins bot to rooms. Hosted bots are trusted: room access rules do
+// not apply to them. The hub must be running.
+func (h *Hub) AddBot(bot Bot, rooms ...string) error {
+	name := bot.Name()
+	if name == "" || name == anonymous {
+		return errors.New("bot needs a name")
+	}
+
+	for _, room := range rooms {
+		c := &Client{
+			hub:      h,
+			send:     make(chan []byte, 256),
+			room:     room,
+			username: name,
+			bot:      true,
+
+			transport: TransportHosted,
+		}
+		h.register <- c
+		for _, cmd := range bot.Commands() {
+			if err := h.claimCommand(c, cmd); err != nil {
+				return err
+			}
+		}
+		go c.hostBot(bot)
+
+		slog.Info("bot joined", "bot", name, "room", room)
+		h.BroadcastMessage(Message{
+			Type:     "join",
+			Username: name,
+			Content:  name + " joined the room",
+			Room:     room,
+			Time:     time.Now().Format(time.RFC3339),
+			Bot:      true,
+		})
+	}
+	return nil
+}
+
+// hostBot delivers the messages queued for an in-process bot until the hub
+// closes its channel.
+func (c *Client) hostBot(bot Bot) {
+	room := &hostedRoom{client: c}
+	for data := range c.send {
+		var msg Message
+		if err := jsonCodec.unmarshal(data, &msg); err != nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		DispatchBotEvent(ctx, bot, room, msg)
+		cancel()
+	}
+	slog.Warn("bot disconnected", "bot", c.name(), "room", c.room)
+}
+
+// claimCommand makes the bot client c answer cmd in its room. Commands of
+// the same name may be answered by different bots in different rooms, but
+// bots cannot replace the hub's own commands.
+func (h *Hub) claimCommand(c *Client, cmd Command) error {
+	if existing, ok := h.commands.Lookup(cmd.Name); ok && !existing.bot {
+		return fmt.Errorf("command /%s is already taken", cmd.Name)
+	}
+
+	name := cmd.Name
+	cmd.bot = true
+	if cmd.Description == "" {
+		cmd.Description = "Provided by " + c.name()
+	}
+	cmd.Handler = func(ctx context.Context, inv *Invocation) error {
+		bot := h.botFor(inv.Room, name)
+		if bot == nil {
+			return errors.New("/" + name + " is not available in this room")
+		}
+		data, _ := bot.encoding().marshal(Message{
+			Type:     "command",
+			Username: inv.Username,
+			Content:  "/" + name + " " + inv.Text,
+			Room:     inv.Room,
+			Time:     time.Now().Format(time.RFC3339),
+		})
+		select {
+		case bot.send <- data:
+			return nil
+		default:
+			return errors.New(bot.name() + " is busy, try again later")
+		}
+	}
+	if err := h.commands.Register(cmd); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	if h.botCommands[c.room] == nil {
+		h.botCommands[c.room] = make(map[string]*Client)
+	}
+	h.botCommands[c.room][name] = c
+	h.mu.Unlock()
+	return nil
+}
+
+// botFor returns the bot answering command in room.
+func (h *Hub) botFor(room, command string) *Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.botCommands[room][command]
+}
+
+// releaseCommands drops the commands claimed by c. The caller holds h.mu.
+func (h *Hub) releaseCommands(c *Client) {
+	for name, owner := range h.botCommands[c.room] {
+		if owner == c {
+			delete(h.botCommands[c.room], name)
+		}
+	}
+	if len(h.botCommands[c.room]) == 0 {
+		delete(h.botCommands, c.room)
+	}
+}
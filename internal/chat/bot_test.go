@@ -0,0 +1,91 @@
+package chat
+
+import (
+	"context"
+	"testing"
+)
+
+// echoBot repeats messages and answers /echo.
+type echoBot struct {
+	BaseBot
+	joined chan string
+}
+
+func (b *echoBot) Name() string { return "echo" }
+
+func (b *echoBot) Commands() []Command {
+	return []Command{{Name: "echo", Usage: "<text>"}}
+}
+
+func (b *echoBot) OnMessage(ctx context.Context, room BotRoom, msg Message) {
+	room.Say("heard " + msg.Username + ": " + msg.Content)
+}
+
+func (b *echoBot) OnJoin(ctx context.Context, room BotRoom, username string) {
+	b.joined <- username
+}
+
+func (b *echoBot) OnCommand(ctx context.Context, room BotRoom, cmd BotCommand) {
+	room.Say(cmd.Username + " said " + cmd.Text)
+}
+
+func TestHub_AddBot(t *testing.T) {
+	hub, _, _, server := newModeratedServer(t)
+	bot := &echoBot{joined: make(chan string, 1)}
+	if err := hub.AddBot(bot, "lobby"); err != nil {
+		t.Fatal(err)
+	}
+	waitForClients(t, hub, "lobby", 1)
+
+	conn := dialChat(t, server, "room=lobby&username=alice")
+	defer conn.Close()
+	if name := <-bot.joined; name != "alice" {
+		t.Errorf("expected join from alice, got %s", name)
+	}
+
+	// A client cannot pass itself off as a bot
+	conn.WriteJSON(Message{Content: "hi", Bot: true})
+	if msg := readUntil(t, conn, "message"); msg.Username != "alice" || msg.Bot {
+		t.Errorf("expected alice's message without the bot flag, got %+v", msg)
+	}
+	msg := readUntil(t, conn, "message")
+	if msg.Username != "echo" || msg.Content != "heard alice: hi" || !msg.Bot {
+		t.Errorf("expected flagged reply from echo, got %+v", msg)
+	}
+
+	conn.WriteJSON(Message{Content: "/echo hello there"})
+	msg = readUntil(t, conn, "message")
+	if msg.Content != "alice said hello there" || !msg.Bot {
+		t.Errorf("unexpected command reply %+v", msg)
+	}
+}
+
+func TestHub_BotCommandsAreScopedToRooms(t *testing.T) {
+	hub, _, _, server := newModeratedServer(t)
+	if err := hub.AddBot(&echoBot{joined: make(chan string, 1)}, "lobby"); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := dialChat(t, server, "room=other&username=alice")
+	defer conn.Close()
+
+	conn.WriteJSON(Message{Content: "/echo hello"})
+	if msg := readUntil(t, conn, "error"); msg.Content != "/echo is not available in this room" {
+		t.Errorf("unexpected error %q", msg.Content)
+	}
+}
+
+func TestHub_BotCannotReplaceBuiltins(t *testing.T) {
+	hub := NewHub(nil)
+	c := &Client{hub: hub, send: make(chan []byte, 1), room: "lobby", username: "b", bot: true}
+	if err := hub.claimCommand(c, Command{Name: "kick"}); err == nil {
+		t.Error("bots should not replace built-in commands")
+	}
+}
+
+func TestParseBotCommand(t *testing.T) {
+	cmd := ParseBotCommand(Message{Username: "alice", Content: "/roll  2 d6 "})
+	if cmd.Name != "roll" || cmd.Username != "alice" || cmd.Text != "2 d6" || len(cmd.Args) != 2 {
+		t.Errorf("unexpected command %+v", cmd)
+	}
+}
@@ -0,0 +1,254 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+)
+
+const maxUsernameLength = 32
+
+// builtinCommands are registered on every hub.
+func builtinCommands() []Command {
+	return []Command{
+		{
+			Name:        "me",
+			Usage:       "<action>",
+			Description: "Describe what you are doing",
+			MinArgs:     1,
+			Handler: func(ctx context.Context, inv *Invocation) error {
+				if wait := inv.client.slowMode(ctx); wait > 0 {
+					return errors.New(slowModeNotice(wait))
+				}
+				return inv.Broadcast(ctx, Message{Type: "action", Content: inv.Text})
+			},
+		},
+		{
+			Name:        "nick",
+			Usage:       "<name>",
+			Description: "Change your display name",
+			MinArgs:     1,
+			Handler:     nick,
+		},
+		{
+			Name:        "topic",
+			Usage:       "[topic]",
+			Description: "Show the room topic, or set it as a moderator",
+			Handler:     topic,
+		},
+		{
+			Name:        "slow",
+			Usage:       "[seconds|off]",
+			Description: "Show slow mode, or set it as a moderator",
+			Handler:     slow,
+		},
+		{
+			Name:        "kick",
+			Usage:       "<username> [reason]",
+			Description: "Disconnect a user from the room",
+			MinArgs:     1,
+			Role:        store.RoleModerator,
+			Handler:     kick,
+		},
+		{
+			Name:        "who",
+			Description: "List the users in the room",
+			Handler: func(ctx context.Context, inv *Invocation) error {
+				names := inv.Hub.usernames(inv.Room)
+				inv.Reply("In " + inv.Room + ": " + strings.Join(names, ", "))
+				return nil
+			},
+		},
+		{
+			Name:        "help",
+			Usage:       "[command]",
+			Description: "List the commands you can use",
+			Handler:     help,
+		},
+	}
+}
+
+func nick(ctx context.Context, inv *Invocation) error {
+	if len(inv.Args) != 1 {
+		return ErrUsage
+	}
+	name := inv.Args[0]
+	c := inv.client
+
+	if c.identity != nil && c.identity.Username != "" {
+		return errors.New("your name is set by your login and cannot be changed")
+	}
+	if utf8.RuneCountInString(name) > maxUsernameLength || name == anonymous || strings.HasPrefix(name, middleware.BotPrefix) {
+		return errors.New("that name is not allowed")
+	}
+	if mute := c.muted(ctx); mute != nil {
+		return errors.New(sanctionNotice("you are muted", mute))
+	}
+
+	// Membership is tied to the name, so names of members are reserved and
+	// members-only rooms keep the name people joined with
+	room, err := inv.room(ctx)
+	if err == nil {
+		if room.Visibility != store.VisibilityPublic {
+			return errors.New("names cannot be changed in members-only rooms")
+		}
+		if room.Role(name) != "" {
+			return errors.New(name + " is a member of this room")
+		}
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	if len(inv.Hub.clientsMatching(inv.Room, func(o *Client) bool { return o.name() == name })) > 0 {
+		return errors.New(name + " is already in use")
+	}
+	if m := inv.Hub.moderation; m != nil && m.banned(ctx, inv.Room, name, "") != nil {
+		return errors.New("that name is not allowed")
+	}
+
+	old := inv.Username
+	c.rename(name)
+	inv.Username = name
+	return inv.Broadcast(ctx, Message{Type: "nick", Content: old + " is now known as " + name})
+}
+
+func topic(ctx context.Context, inv *Invocation) error {
+	room, err := inv.room(ctx)
+	if inv.Text == "" {
+		if err != nil || room.Topic == "" {
+			inv.Reply("No topic is set")
+		} else {
+			inv.Reply("Topic: " + room.Topic)
+		}
+		return nil
+	}
+
+	if errors.Is(err, store.ErrNotFound) {
+		return errors.New("only claimed rooms have a topic")
+	}
+	if err != nil {
+		return err
+	}
+	if !inv.HasRole(ctx, store.RoleModerator) {
+		return errors.New("only moderators can set the topic")
+	}
+
+	room.Topic = inv.Text
+	if err := inv.Hub.roomStore.PutRoom(ctx, room); err != nil {
+		return errors.New("failed to save the topic")
+	}
+	return inv.Broadcast(ctx, Message{Type: "topic", Content: room.Topic})
+}
+
+func slow(ctx context.Context, inv *Invocation) error {
+	room, err := inv.room(ctx)
+	if len(inv.Args) == 0 {
+		if err != nil || room.SlowMode == 0 {
+			inv.Reply("Slow mode is off")
+		} else {
+			inv.Reply(fmt.Sprintf("Slow mode is on: one message every %ds", room.SlowMode))
+		}
+		return nil
+	}
+
+	if len(inv.Args) > 1 {
+		return ErrUsage
+	}
+	seconds := 0
+	if inv.Args[0] != "off" {
+		n, convErr := strconv.Atoi(inv.Args[0])
+		if convErr != nil || n < 0 || n > store.MaxSlowMode {
+			return fmt.Errorf("slow mode must be off or 0 to %d seconds", store.MaxSlowMode)
+		}
+		seconds = n
+	}
+
+	if errors.Is(err, store.ErrNotFound) {
+		return errors.New("only claimed rooms have slow mode")
+	}
+	if err != nil {
+		return err
+	}
+	if !inv.HasRole(ctx, store.RoleModerator) {
+		return errors.New("only moderators can change slow mode")
+	}
+
+	room.SlowMode = seconds
+	if err := inv.Hub.roomStore.PutRoom(ctx, room); err != nil {
+		return errors.New("failed to save slow mode")
+	}
+	content := "turned slow mode off"
+	if seconds > 0 {
+		content = fmt.Sprintf("turned slow mode on: one message every %ds", seconds)
+	}
+	return inv.Broadcast(ctx, Message{Type: "slowmode", Content: content})
+}
+
+func kick(ctx context.Context, inv *Invocation) error {
+	m := inv.Hub.moderation
+	if m == nil {
+		return errors.New("moderation is not enabled")
+	}
+
+	target := inv.Args[0]
+	if room, err := inv.room(ctx); err == nil && room.IsModerator(target) && !inv.HasRole(ctx, store.RoleOwner) {
+		return errors.New("moderators cannot kick other moderators")
+	}
+
+	reason := strings.TrimSpace(strings.TrimPrefix(inv.Text, target))
+	n, err := m.Kick(ctx, Action{Actor: inv.Username, Room: inv.Room, Username: target, Reason: reason})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New(target + " is not in this room")
+	}
+	inv.Reply("Kicked " + target)
+	return nil
+}
+
+func help(ctx context.Context, inv *Invocation) error {
+	if len(inv.Args) > 0 {
+		cmd, ok := inv.Hub.commands.Lookup(strings.TrimPrefix(strings.ToLower(inv.Args[0]), "/"))
+		if !ok {
+			return errors.New("unknown command /" + inv.Args[0])
+		}
+		inv.Reply(cmd.usage() + " - " + cmd.Description)
+		return nil
+	}
+
+	lines := []string{"Commands:"}
+	for _, cmd := range inv.Hub.commands.List() {
+		if cmd.bot && inv.Hub.botFor(inv.Room, cmd.Name) == nil {
+			continue
+		}
+		if cmd.Role == "" || inv.HasRole(ctx, cmd.Role) {
+			lines = append(lines, strings.TrimSpace("/"+cmd.Name+" "+cmd.Usage)+" - "+cmd.Description)
+		}
+	}
+	inv.Reply(strings.Join(lines, "\n"))
+	return nil
+}
+
+// usernames returns the sorted, distinct names of the users in room.
+func (h *Hub) usernames(room string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var names []string
+	for c := range h.rooms[room] {
+		if !seen[c.name()] {
+			seen[c.name()] = true
+			names = append(names, c.name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -2,13 +2,21 @@ package chat
 
 import (
 	"context"
-	"encoding/json"
 	"log/slog"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/TrailBlazors/realtime-chat-railway/internal/config"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/metrics"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/tracing"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -18,21 +26,25 @@ const (
 )
 
 var (
-	cfg      *config.Config
+	settings atomic.Pointer[config.Config]
 	upgrader websocket.Upgrader
 )
 
 func InitClient(c *config.Config) {
-	cfg = c
+	settings.Store(c)
 	upgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
+		Subprotocols:    subprotocols(),
+		// Compression is negotiated per connection; the level and the
+		// size threshold are applied in ServeWs and writePump.
+		EnableCompression: c.CompressionEnabled(),
 		CheckOrigin: func(r *http.Request) bool {
 			origin := r.Header.Get("Origin")
 			if origin == "" {
 				return true // Allow requests without Origin header (e.g., from same origin)
 			}
-			allowed := cfg.IsOriginAllowed(origin)
+			allowed := settings.Load().IsOriginAllowed(origin)
 			if !allowed {
 				slog.Warn("rejected connection from disallowed origin", "origin", origin)
 			}
@@ -41,76 +53,278 @@ func InitClient(c *config.Config) {
 	}
 }
 
+// Reload applies c to new connections and messages. Compression is
+// negotiated with the settings given to InitClient.
+func Reload(c *config.Config) {
+	settings.Store(c)
+}
+
 type Client struct {
 	hub      *Hub
-	conn     *websocket.Conn
+	conn     *websocket.Conn // nil for long-poll subscribers
 	send     chan []byte
 	room     string
-	username string
+	username string // name at connect time; see name
+	ip       string
+	codec    *codec               // nil means JSON
+	identity *middleware.Identity // nil when auth is disabled
+	role     string               // room role at connect time
+	bot      bool
+	reserved bool         // admitted with a connection slot; see Hub.reserveConnection
+	poll     *pollSession // nil for WebSocket clients
+
+	// Connection metadata for the admin API; id and connectedAt are set
+	// by the hub on registration
+	id          string
+	transport   string
+	remoteAddr  string
+	connectedAt time.Time
+	bytesSent   atomic.Int64
+
+	messageTAT time.Time // message bucket, guarded by the hub's FloodControl
+
+	renamed atomic.Pointer[string] // set by /nick, read from any goroutine
 }
 
 func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.Tracer().Start(tracing.FromRequest(r), "chat.upgrade",
+		trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	adm, rej := admit(hub, r)
+	if rej != nil {
+		span.SetStatus(codes.Error, rej.Code)
+		span.SetAttributes(attribute.Int("http.response.status_code", rej.status))
+		rej.write(w)
+		return
+	}
+	span.SetAttributes(attribute.String("chat.room", adm.room), attribute.String("chat.username", adm.username))
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		hub.releaseConnection(adm.ip, authenticatedName(adm.identity))
+		metrics.UpgradeFailures.Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "websocket upgrade failed")
 		slog.Error("websocket upgrade failed", "error", err)
 		return
 	}
 
-	room := r.URL.Query().Get("room")
-	username := r.URL.Query().Get("username")
-
-	if room == "" {
-		room = "general"
-	}
-	if username == "" {
-		username = "anonymous"
+	if cfg := settings.Load(); cfg.CompressionEnabled() {
+		if err := conn.SetCompressionLevel(cfg.CompressionLevel); err != nil {
+			slog.Warn("invalid compression level", "error", err, "level", cfg.CompressionLevel)
+		}
 	}
 
 	client := &Client{
 		hub:      hub,
 		conn:     conn,
 		send:     make(chan []byte, 256),
-		room:     room,
-		username: username,
+		room:     adm.room,
+		username: adm.username,
+		ip:       adm.ip,
+		codec:    codecFor(conn.Subprotocol()),
+		identity: adm.identity,
+		role:     adm.role,
+		bot:      adm.identity != nil && adm.identity.IsBot(),
+		reserved: true,
+
+		transport:  TransportWebSocket,
+		remoteAddr: r.RemoteAddr,
 	}
 
 	client.hub.register <- client
 
 	slog.Info("client connected",
-		"username", username,
-		"room", room,
+		"username", client.name(),
+		"room", client.room,
 		"remote_addr", r.RemoteAddr,
+		"ip", client.ip,
+		"protocol", client.codec.name,
+		"bot", client.bot,
 	)
 
-	// Send recent messages from history
+	// Bots react to live events only, so replaying history would make them
+	// answer old messages
+	if !client.bot {
+		client.sendHistory()
+	}
+	join := client.presence("join")
+	join.Trace = tracing.Inject(ctx)
+	hub.BroadcastMessage(join)
+
+	go client.writePump()
+	go client.readPump()
+}
+
+func presenceMessage(typ, username, room string) Message {
+	verb := " joined the room"
+	if typ == "leave" {
+		verb = " left the room"
+	}
+	return Message{
+		Type:     typ,
+		Username: username,
+		Content:  username + verb,
+		Room:     room,
+		Time:     time.Now().Format(time.RFC3339),
+	}
+}
+
+// presence returns the join or leave message for this client.
+func (c *Client) presence(typ string) Message {
+	msg := presenceMessage(typ, c.name(), c.room)
+	msg.Bot = c.bot
+	return msg
+}
+
+// sendHistory queues the most recent messages of the client's room.
+func (c *Client) sendHistory() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	messages, err := hub.store.GetRecentMessages(ctx, room, 50)
+	messages, err := c.hub.store.GetRecentMessages(ctx, c.room, 50)
 	cancel()
 
 	if err != nil {
-		slog.Warn("failed to load message history", "error", err, "room", room)
-	} else {
-		for _, msg := range messages {
-			data, _ := json.Marshal(msg)
-			select {
-			case client.send <- data:
-			default:
+		slog.Warn("failed to load message history", "error", err, "room", c.room)
+		return
+	}
+	for _, msg := range messages {
+		data, _ := c.encoding().marshal(Message(msg))
+		select {
+		case c.send <- data:
+		default:
+		}
+	}
+}
+
+// name returns the client's current username.
+func (c *Client) name() string {
+	if n := c.renamed.Load(); n != nil {
+		return *n
+	}
+	return c.username
+}
+
+// rename changes the client's username. The connect-time username is never
+// written, so that the goroutines reading it need no lock.
+func (c *Client) rename(username string) {
+	c.renamed.Store(&username)
+}
+
+// encoding returns the wire format negotiated by the client.
+func (c *Client) encoding() *codec {
+	if c.codec == nil {
+		return jsonCodec
+	}
+	return c.codec
+}
+
+// sendError delivers an error notice to this client only.
+func (c *Client) sendError(content string) {
+	c.sendNotice("error", content)
+}
+
+// sendNotice delivers a message of type typ to this client only.
+func (c *Client) sendNotice(typ, content string) {
+	select {
+	case c.send <- c.notice(typ, content):
+	default:
+	}
+}
+
+// notice encodes a message of type typ for this client.
+func (c *Client) notice(typ, content string) []byte {
+	data, _ := c.encoding().marshal(Message{
+		Type:    typ,
+		Content: content,
+		Room:    c.room,
+		Time:    time.Now().Format(time.RFC3339),
+	})
+	return data
+}
+
+// muted returns the mute in force for this client, if any.
+func (c *Client) muted(ctx context.Context) *store.Sanction {
+	if c.hub.moderation == nil {
+		return nil
+	}
+	return c.hub.moderation.muted(ctx, c.room, c.name())
+}
+
+// handleInbound processes one frame received from the client, in a span
+// whose trace context is attached to the message it broadcasts.
+func (c *Client) handleInbound(ctx context.Context, data []byte) {
+	metrics.MessagesIn.Inc()
+
+	ctx, span := tracing.Tracer().Start(ctx, "chat.receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("chat.room", c.room), attribute.String("chat.username", c.name())))
+	defer span.End()
+
+	if c.identity != nil && !c.identity.HasScope(middleware.ScopeWrite) {
+		c.sendError("your credentials do not allow sending messages")
+		return
+	}
+
+	if c.flooding(ctx) {
+		span.SetStatus(codes.Error, "rate limited")
+		return
+	}
+
+	var msg Message
+	if err := c.encoding().unmarshal(data, &msg); err != nil {
+		span.SetStatus(codes.Error, "invalid message")
+		slog.Warn("failed to unmarshal message",
+			"error", err,
+			"username", c.name(),
+		)
+		return
+	}
+
+	// Bots claim commands with a register frame naming the command and
+	// its usage, and cannot run commands themselves
+	if c.bot {
+		if msg.Type == "register" {
+			name, usage, _ := strings.Cut(strings.TrimSpace(msg.Content), " ")
+			if err := c.hub.claimCommand(c, Command{Name: name, Usage: usage}); err != nil {
+				c.sendError(err.Error())
 			}
+			return
 		}
+	} else if strings.HasPrefix(msg.Content, "/") {
+		// Lines starting with a slash are commands; "//" sends a literal slash
+		if !strings.HasPrefix(msg.Content, "//") {
+			c.hub.runCommand(c, msg.Content)
+			return
+		}
+		msg.Content = msg.Content[1:]
 	}
 
-	// Send join message
-	joinMsg := Message{
-		Type:     "join",
-		Username: username,
-		Content:  username + " joined the room",
-		Room:     room,
-		Time:     time.Now().Format(time.RFC3339),
+	// A trace context sent by the client is linked, not trusted as parent
+	if link, ok := tracing.LinkTo(msg.Trace); ok {
+		span.AddLink(link)
 	}
-	hub.BroadcastMessage(joinMsg)
 
-	go client.writePump()
-	go client.readPump()
+	mctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	mute := c.muted(mctx)
+	cancel()
+	if mute != nil {
+		c.sendError(sanctionNotice("you are muted", mute))
+		return
+	}
+	if wait := c.slowMode(ctx); wait > 0 {
+		c.sendError(slowModeNotice(wait))
+		return
+	}
+
+	msg.Username = c.name()
+	msg.Room = c.room
+	msg.Time = time.Now().Format(time.RFC3339)
+	msg.Type = "message"
+	msg.Bot = c.bot
+	msg.Trace = tracing.Inject(ctx)
+
+	c.hub.BroadcastMessage(msg)
 }
 
 func (c *Client) readPump() {
@@ -119,21 +333,14 @@ func (c *Client) readPump() {
 		c.conn.Close()
 
 		slog.Info("client disconnected",
-			"username", c.username,
+			"username", c.name(),
 			"room", c.room,
 		)
 
-		leaveMsg := Message{
-			Type:     "leave",
-			Username: c.username,
-			Content:  c.username + " left the room",
-			Room:     c.room,
-			Time:     time.Now().Format(time.RFC3339),
-		}
-		c.hub.BroadcastMessage(leaveMsg)
+		c.hub.BroadcastMessage(c.presence("leave"))
 	}()
 
-	c.conn.SetReadLimit(cfg.MaxMessageSize)
+	c.conn.SetReadLimit(settings.Load().MaxMessageSize)
 	c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.conn.SetPongHandler(func(string) error {
 		c.conn.SetReadDeadline(time.Now().Add(pongWait))
@@ -146,27 +353,13 @@ func (c *Client) readPump() {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				slog.Warn("unexpected websocket close",
 					"error", err,
-					"username", c.username,
+					"username", c.name(),
 				)
 			}
 			break
 		}
 
-		var msg Message
-		if err := json.Unmarshal(message, &msg); err != nil {
-			slog.Warn("failed to unmarshal message",
-				"error", err,
-				"username", c.username,
-			)
-			continue
-		}
-
-		msg.Username = c.username
-		msg.Room = c.room
-		msg.Time = time.Now().Format(time.RFC3339)
-		msg.Type = "message"
-
-		c.hub.BroadcastMessage(msg)
+		c.handleInbound(context.Background(), message)
 	}
 }
 
@@ -186,13 +379,7 @@ func (c *Client) writePump() {
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			if err := w.Close(); err != nil {
+			if err := c.writeFrame(message); err != nil {
 				return
 			}
 
@@ -204,3 +391,60 @@ func (c *Client) writePump() {
 		}
 	}
 }
+
+// writeFrame writes message and whatever else is already queued in send,
+// up to cfg.WriteBatchSize messages. Clients that negotiated a batching
+// subprotocol get them coalesced into one frame, so that a busy room costs
+// one frame instead of one per message; others get a frame per message.
+func (c *Client) writeFrame(message []byte) error {
+	cfg := settings.Load()
+	batch := 1
+	if cfg.WriteBatchSize > 1 {
+		batch += min(len(c.send), cfg.WriteBatchSize-1)
+	}
+	enc := c.encoding()
+
+	messages := make([][]byte, 1, batch)
+	messages[0] = message
+	for len(messages) < batch {
+		messages = append(messages, <-c.send)
+	}
+
+	if enc.batch {
+		return c.writeMessages(cfg, enc, messages)
+	}
+	for _, m := range messages {
+		if err := c.writeMessages(cfg, enc, [][]byte{m}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMessages writes messages in one frame, joined with the codec's
+// separator.
+func (c *Client) writeMessages(cfg *config.Config, enc *codec, messages [][]byte) error {
+	size := len(enc.separator) * (len(messages) - 1)
+	for _, m := range messages {
+		size += len(m)
+	}
+	if cfg.CompressionEnabled() {
+		c.conn.EnableWriteCompression(size >= cfg.CompressionThreshold)
+	}
+
+	w, err := c.conn.NextWriter(enc.frameType)
+	if err != nil {
+		return err
+	}
+	for i, m := range messages {
+		if i > 0 {
+			w.Write(enc.separator)
+		}
+		w.Write(m)
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	c.bytesSent.Add(int64(size))
+	return nil
+}
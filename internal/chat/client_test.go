@@ -0,0 +1,201 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/config"
+	"github.com/gorilla/websocket"
+)
+
+// countingConn counts the write syscalls and bytes the server puts on the wire.
+type countingConn struct {
+	net.Conn
+	writes *atomic.Int64
+	bytes  *atomic.Int64
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	c.writes.Add(1)
+	c.bytes.Add(int64(len(p)))
+	return c.Conn.Write(p)
+}
+
+type countingListener struct {
+	net.Listener
+	writes atomic.Int64
+	bytes  atomic.Int64
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: conn, writes: &l.writes, bytes: &l.bytes}, nil
+}
+
+// newWriterPair returns a server-side client whose writePump has not been
+// started yet, together with the dialed peer connection.
+func newWriterPair(tb testing.TB, c *config.Config) (*Client, *websocket.Conn, *countingListener) {
+	tb.Helper()
+	InitClient(c)
+
+	clients := make(chan *Client, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			tb.Errorf("upgrade failed: %v", err)
+			return
+		}
+		if c.CompressionEnabled() {
+			conn.SetCompressionLevel(c.CompressionLevel)
+		}
+		clients <- &Client{conn: conn, send: make(chan []byte, 256)}
+	}))
+	listener := &countingListener{Listener: server.Listener}
+	server.Listener = listener
+	server.Start()
+	tb.Cleanup(server.Close)
+
+	dialer := websocket.Dialer{EnableCompression: c.CompressionEnabled()}
+	peer, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		tb.Fatalf("dial failed: %v", err)
+	}
+	tb.Cleanup(func() { peer.Close() })
+
+	client := <-clients
+	listener.writes.Store(0)
+	listener.bytes.Store(0)
+	return client, peer, listener
+}
+
+func TestWritePump_CoalescesBacklog(t *testing.T) {
+	client, peer, _ := newWriterPair(t, &config.Config{WriteBatchSize: 32})
+	client.codec = jsonBatchCodec
+
+	for i := 0; i < 3; i++ {
+		data, _ := json.Marshal(Message{Type: "message", Content: "Hello!"})
+		client.send <- data
+	}
+	go client.writePump()
+
+	peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := peer.ReadMessage()
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 messages in one frame, got %d", len(lines))
+	}
+	for _, line := range lines {
+		var msg Message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			t.Errorf("invalid message in frame: %v", err)
+		}
+	}
+}
+
+func TestWritePump_OneMessagePerFrameWithoutBatchProtocol(t *testing.T) {
+	client, peer, _ := newWriterPair(t, &config.Config{WriteBatchSize: 32})
+
+	for i := 0; i < 3; i++ {
+		client.send <- []byte(`{"type":"message"}`)
+	}
+	go client.writePump()
+
+	peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for i := 0; i < 3; i++ {
+		_, data, err := peer.ReadMessage()
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Errorf("frame %d should hold a single JSON message: %v", i+1, err)
+		}
+	}
+}
+
+func TestWritePump_BatchingDisabled(t *testing.T) {
+	client, peer, _ := newWriterPair(t, &config.Config{WriteBatchSize: 1})
+	client.codec = jsonBatchCodec
+
+	for i := 0; i < 3; i++ {
+		client.send <- []byte(`{"type":"message"}`)
+	}
+	go client.writePump()
+
+	peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for i := 0; i < 3; i++ {
+		_, data, err := peer.ReadMessage()
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if bytes.Contains(data, []byte("\n")) {
+			t.Errorf("frame %d should contain a single message", i+1)
+		}
+	}
+}
+
+// benchmarkBusyRoom measures the bytes and write syscalls needed to deliver
+// bursts of broadcast messages to one client.
+func benchmarkBusyRoom(b *testing.B, c *config.Config) {
+	const burst = 64
+
+	client, peer, listener := newWriterPair(b, c)
+	client.codec = jsonBatchCodec
+	go client.writePump()
+
+	data, _ := json.Marshal(Message{
+		Type:     "message",
+		Username: "user1",
+		Content:  strings.Repeat("the quick brown fox jumps over the lazy dog ", 4),
+		Room:     "busy-room",
+		Time:     time.Now().Format(time.RFC3339),
+	})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < burst; j++ {
+			client.send <- data
+		}
+		for received := 0; received < burst; {
+			_, frame, err := peer.ReadMessage()
+			if err != nil {
+				b.Fatalf("read failed: %v", err)
+			}
+			received += bytes.Count(frame, []byte("\n")) + 1
+		}
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(listener.bytes.Load())/float64(b.N), "wire-bytes/op")
+	b.ReportMetric(float64(listener.writes.Load())/float64(b.N), "writes/op")
+}
+
+func BenchmarkBusyRoom_Plain(b *testing.B) {
+	benchmarkBusyRoom(b, &config.Config{WriteBatchSize: 1})
+}
+
+func BenchmarkBusyRoom_Batched(b *testing.B) {
+	benchmarkBusyRoom(b, &config.Config{WriteBatchSize: 32})
+}
+
+func BenchmarkBusyRoom_Compressed(b *testing.B) {
+	benchmarkBusyRoom(b, &config.Config{WriteBatchSize: 1, CompressionLevel: 1, CompressionThreshold: 256})
+}
+
+func BenchmarkBusyRoom_BatchedCompressed(b *testing.B) {
+	benchmarkBusyRoom(b, &config.Config{WriteBatchSize: 32, CompressionLevel: 1, CompressionThreshold: 256})
+}
@@ -0,0 +1,93 @@
+package chat
+
+import (
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// WebSocket subprotocols understood by the server. Clients that do not
+// request a subprotocol get JSON text frames, one message per frame.
+// ProtocolJSONBatch clients accept frames of several newline-separated
+// messages, which the server sends when messages queue up.
+const (
+	ProtocolJSON      = "chat.v1.json"
+	ProtocolJSONBatch = "chat.v1.json-batch"
+	ProtocolMsgpack   = "chat.v1.msgpack"
+)
+
+// codec is a wire format for messages exchanged with clients. Codecs that
+// batch coalesce queued messages into one frame, joined with separator.
+type codec struct {
+	name      string
+	frameType int
+	batch     bool
+	separator []byte
+	marshal   func(v any) ([]byte, error)
+	unmarshal func(data []byte, v any) error
+}
+
+var (
+	jsonCodec = &codec{
+		name:      ProtocolJSON,
+		frameType: websocket.TextMessage,
+		marshal:   json.Marshal,
+		unmarshal: json.Unmarshal,
+	}
+	jsonBatchCodec = &codec{
+		name:      ProtocolJSONBatch,
+		frameType: websocket.TextMessage,
+		batch:     true,
+		separator: []byte{'\n'},
+		marshal:   json.Marshal,
+		unmarshal: json.Unmarshal,
+	}
+	msgpackCodec = &codec{
+		name:      ProtocolMsgpack,
+		frameType: websocket.BinaryMessage,
+		marshal:   msgpack.Marshal,
+		unmarshal: msgpack.Unmarshal,
+	}
+
+	// In order of preference, for clients offering several
+	codecs = []*codec{jsonBatchCodec, jsonCodec, msgpackCodec}
+)
+
+// codecFor returns the codec negotiated for subprotocol, defaulting to JSON.
+func codecFor(subprotocol string) *codec {
+	for _, c := range codecs {
+		if c.name == subprotocol {
+			return c
+		}
+	}
+	return jsonCodec
+}
+
+func subprotocols() []string {
+	names := make([]string, len(codecs))
+	for i, c := range codecs {
+		names[i] = c.name
+	}
+	return names
+}
+
+// encodedMessage encodes a message at most once per codec, however many
+// clients it is delivered to.
+type encodedMessage struct {
+	msg    Message
+	frames map[*codec][]byte
+}
+
+func newEncodedMessage(msg Message) *encodedMessage {
+	return &encodedMessage{msg: msg, frames: make(map[*codec][]byte, len(codecs))}
+}
+
+func (e *encodedMessage) bytes(c *codec) []byte {
+	if data, ok := e.frames[c]; ok {
+		return data
+	}
+	data, _ := c.marshal(e.msg)
+	e.frames[c] = data
+	return data
+}
@@ -0,0 +1,143 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/config"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestCodecFor(t *testing.T) {
+	if codecFor(ProtocolMsgpack) != msgpackCodec {
+		t.Error("expected msgpack codec")
+	}
+	if codecFor(ProtocolJSON) != jsonCodec {
+		t.Error("expected JSON codec")
+	}
+	if codecFor("") != jsonCodec {
+		t.Error("should default to JSON when no subprotocol was negotiated")
+	}
+}
+
+func TestEncodedMessage_OncePerCodec(t *testing.T) {
+	msg := Message{Type: "message", Username: "user1", Content: "Hello!", Room: "test-room"}
+	encoded := newEncodedMessage(msg)
+
+	first := encoded.bytes(msgpackCodec)
+	second := encoded.bytes(msgpackCodec)
+	if &first[0] != &second[0] {
+		t.Error("msgpack frame should be encoded once and reused")
+	}
+
+	var decoded Message
+	if err := msgpack.Unmarshal(first, &decoded); err != nil {
+		t.Fatalf("failed to decode msgpack frame: %v", err)
+	}
+	if decoded != msg {
+		t.Errorf("expected %+v, got %+v", msg, decoded)
+	}
+
+	if err := json.Unmarshal(encoded.bytes(jsonCodec), &decoded); err != nil {
+		t.Fatalf("failed to decode JSON frame: %v", err)
+	}
+	if decoded != msg {
+		t.Errorf("expected %+v, got %+v", msg, decoded)
+	}
+}
+
+func dialChat(t *testing.T, server *httptest.Server, query string, protocols ...string) *websocket.Conn {
+	t.Helper()
+
+	dialer := websocket.Dialer{Subprotocols: protocols}
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?" + query
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	return conn
+}
+
+func TestServeWs_NegotiatesBinaryFormat(t *testing.T) {
+	InitClient(&config.Config{MaxMessageSize: 4096, AllowedOrigins: []string{"*"}})
+
+	hub := NewHub(store.NewNoOpStore())
+	go hub.Run()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeWs(hub, w, r)
+	}))
+	defer server.Close()
+
+	conn := dialChat(t, server, "room=bin&username=mobile", ProtocolMsgpack)
+	defer conn.Close()
+
+	if conn.Subprotocol() != ProtocolMsgpack {
+		t.Fatalf("expected subprotocol %s, got %q", ProtocolMsgpack, conn.Subprotocol())
+	}
+
+	out, _ := msgpack.Marshal(Message{Content: "Hello!"})
+	if err := conn.WriteMessage(websocket.BinaryMessage, out); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		frameType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if frameType != websocket.BinaryMessage {
+			t.Fatalf("expected binary frame, got %d", frameType)
+		}
+
+		var msg Message
+		if err := msgpack.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("failed to decode frame: %v", err)
+		}
+		if msg.Type == "message" {
+			if msg.Content != "Hello!" || msg.Username != "mobile" {
+				t.Errorf("unexpected message: %+v", msg)
+			}
+			return
+		}
+	}
+}
+
+func TestServeWs_DefaultsToJSON(t *testing.T) {
+	InitClient(&config.Config{MaxMessageSize: 4096, AllowedOrigins: []string{"*"}})
+
+	hub := NewHub(store.NewNoOpStore())
+	go hub.Run()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeWs(hub, w, r)
+	}))
+	defer server.Close()
+
+	conn := dialChat(t, server, "room=text&username=browser")
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	frameType, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if frameType != websocket.TextMessage {
+		t.Fatalf("expected text frame, got %d", frameType)
+	}
+
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("failed to decode frame: %v", err)
+	}
+	if msg.Type != "join" {
+		t.Errorf("expected join message, got %q", msg.Type)
+	}
+}
@@ -0,0 +1,204 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+)
+
+// ErrUsage is returned by a command handler when its arguments are wrong;
+// the caller is shown the command's usage.
+var ErrUsage = errors.New("usage")
+
+var commandName = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// Command is a slash command typed into the chat input, such as /who.
+type Command struct {
+	Name        string // without the slash
+	Usage       string // argument synopsis, e.g. "<username> [reason]"
+	Description string
+	MinArgs     int
+	Role        string // minimum room role; "" lets anyone run it
+	Handler     func(ctx context.Context, inv *Invocation) error
+
+	bot bool // answered by a bot; see Hub.claimCommand
+}
+
+// Invocation is a command being run by a connected client.
+type Invocation struct {
+	Hub      *Hub
+	Room     string
+	Username string
+	Args     []string // whitespace-separated arguments
+	Text     string   // everything after the command name
+
+	client *Client
+}
+
+// Reply sends content to the invoking client only.
+func (inv *Invocation) Reply(content string) {
+	inv.client.sendNotice("info", content)
+}
+
+// Broadcast sends msg to the room as the invoking user. It fails when the
+// user is muted.
+func (inv *Invocation) Broadcast(ctx context.Context, msg Message) error {
+	if mute := inv.client.muted(ctx); mute != nil {
+		return errors.New(sanctionNotice("you are muted", mute))
+	}
+	msg.Room = inv.Room
+	if msg.Username == "" {
+		msg.Username = inv.Username
+	}
+	msg.Time = time.Now().Format(time.RFC3339)
+	inv.Hub.BroadcastMessage(msg)
+	return nil
+}
+
+// Role returns the user's current role in the room, or "" for non-members,
+// rooms without metadata and clients that picked their own name.
+func (inv *Invocation) Role(ctx context.Context) string {
+	name := authenticatedName(inv.client.identity)
+	if name == "" {
+		return ""
+	}
+	room, err := inv.room(ctx)
+	if err != nil {
+		return ""
+	}
+	return room.Role(name)
+}
+
+// HasRole reports whether the user holds at least role in the room. Admins
+// hold every role.
+func (inv *Invocation) HasRole(ctx context.Context, role string) bool {
+	if id := inv.client.identity; id != nil && id.HasScope(middleware.ScopeAdmin) {
+		return true
+	}
+	return roleRank(inv.Role(ctx)) >= roleRank(role)
+}
+
+// room loads the metadata of the invocation's room.
+func (inv *Invocation) room(ctx context.Context) (*store.Room, error) {
+	if inv.Hub.roomStore == nil {
+		return nil, store.ErrNotFound
+	}
+	return inv.Hub.roomStore.GetRoom(ctx, inv.Room)
+}
+
+func roleRank(role string) int {
+	switch role {
+	case store.RoleOwner:
+		return 3
+	case store.RoleModerator:
+		return 2
+	case store.RoleMember:
+		return 1
+	}
+	return 0
+}
+
+// Commands is the registry of slash commands. It is safe for concurrent
+// use, so commands may be registered while the hub is running.
+type Commands struct {
+	mu       sync.RWMutex
+	commands map[string]Command
+}
+
+func NewCommands() *Commands {
+	return &Commands{commands: make(map[string]Command)}
+}
+
+// Register adds cmd, replacing any command of the same name.
+func (cs *Commands) Register(cmd Command) error {
+	if !commandName.MatchString(cmd.Name) {
+		return fmt.Errorf("invalid command name %q", cmd.Name)
+	}
+	if cmd.Handler == nil {
+		return fmt.Errorf("command /%s has no handler", cmd.Name)
+	}
+	if cmd.Role != "" && !store.ValidRole(cmd.Role) {
+		return fmt.Errorf("command /%s: unknown role %q", cmd.Name, cmd.Role)
+	}
+
+	cs.mu.Lock()
+	cs.commands[cmd.Name] = cmd
+	cs.mu.Unlock()
+	return nil
+}
+
+func (cs *Commands) Lookup(name string) (Command, bool) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	cmd, ok := cs.commands[name]
+	return cmd, ok
+}
+
+// List returns the registered commands sorted by name.
+func (cs *Commands) List() []Command {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	list := make([]Command, 0, len(cs.commands))
+	for _, cmd := range cs.commands {
+		list = append(list, cmd)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func (cmd Command) usage() string {
+	return strings.TrimSpace("usage: /" + cmd.Name + " " + cmd.Usage)
+}
+
+// runCommand parses and runs a line starting with a slash.
+func (h *Hub) runCommand(c *Client, line string) {
+	name, rest, _ := strings.Cut(strings.TrimPrefix(line, "/"), " ")
+	name = strings.ToLower(name)
+
+	cmd, ok := h.commands.Lookup(name)
+	if !ok {
+		c.sendError("unknown command /" + name + ", type /help for a list of commands")
+		return
+	}
+
+	inv := &Invocation{
+		Hub:      h,
+		Room:     c.room,
+		Username: c.name(),
+		Args:     strings.Fields(rest),
+		Text:     strings.TrimSpace(rest),
+		client:   c,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if cmd.Role != "" && !inv.HasRole(ctx, cmd.Role) {
+		c.sendError("/" + cmd.Name + " requires the " + cmd.Role + " role")
+		return
+	}
+	if len(inv.Args) < cmd.MinArgs {
+		c.sendError(cmd.usage())
+		return
+	}
+
+	err := cmd.Handler(ctx, inv)
+	switch {
+	case errors.Is(err, ErrUsage):
+		c.sendError(cmd.usage())
+	case err != nil:
+		c.sendError(err.Error())
+	default:
+		slog.Debug("command run", "command", cmd.Name, "room", c.room, "username", c.name())
+	}
+}
@@ -0,0 +1,118 @@
+package chat
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+)
+
+func TestCommands_Register(t *testing.T) {
+	cs := NewCommands()
+	handler := func(context.Context, *Invocation) error { return nil }
+
+	if err := cs.Register(Command{Name: "Bad Name", Handler: handler}); err == nil {
+		t.Error("expected invalid name to be rejected")
+	}
+	if err := cs.Register(Command{Name: "roll"}); err == nil {
+		t.Error("expected missing handler to be rejected")
+	}
+	if err := cs.Register(Command{Name: "roll", Role: "wizard", Handler: handler}); err == nil {
+		t.Error("expected unknown role to be rejected")
+	}
+	if err := cs.Register(Command{Name: "roll", Handler: handler}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if _, ok := cs.Lookup("roll"); !ok {
+		t.Error("expected /roll to be registered")
+	}
+}
+
+func TestCommands_Dispatch(t *testing.T) {
+	hub, mod, s, server := newModeratedServer(t)
+	hub.SetRoomStore(s)
+	s.PutRoom(context.Background(), &store.Room{
+		Name:       "lobby",
+		Visibility: store.VisibilityPublic,
+		Members:    map[string]string{"alice": store.RoleOwner},
+	})
+
+	var got []string
+	hub.Commands().Register(Command{
+		Name:    "roll",
+		Usage:   "<sides>",
+		MinArgs: 1,
+		Handler: func(ctx context.Context, inv *Invocation) error {
+			got = inv.Args
+			inv.Reply("rolled")
+			return nil
+		},
+	})
+
+	alice := dialChat(t, server, "room=lobby&login=alice")
+	defer alice.Close()
+	bob := dialChat(t, server, "room=lobby&username=bob")
+	defer bob.Close()
+	waitForClients(t, hub, "lobby", 2)
+
+	send := func(content string) { bob.WriteJSON(Message{Content: content}) }
+
+	send("/roll")
+	if msg := readUntil(t, bob, "error"); !strings.Contains(msg.Content, "usage: /roll <sides>") {
+		t.Errorf("expected usage, got %q", msg.Content)
+	}
+	send("/roll 20")
+	if msg := readUntil(t, bob, "info"); msg.Content != "rolled" || len(got) != 1 || got[0] != "20" {
+		t.Errorf("unexpected reply %q with args %v", msg.Content, got)
+	}
+
+	send("/kick alice")
+	if msg := readUntil(t, bob, "error"); !strings.Contains(msg.Content, "requires the moderator role") {
+		t.Errorf("expected role error, got %q", msg.Content)
+	}
+
+	send("/me waves")
+	if msg := readUntil(t, alice, "action"); msg.Username != "bob" || msg.Content != "waves" {
+		t.Errorf("unexpected action %+v", msg)
+	}
+
+	send("//shrug")
+	if msg := readUntil(t, alice, "message"); msg.Content != "/shrug" {
+		t.Errorf("expected literal slash, got %q", msg.Content)
+	}
+
+	send("/nick alice")
+	if msg := readUntil(t, bob, "error"); !strings.Contains(msg.Content, "member of this room") {
+		t.Errorf("expected reserved name error, got %q", msg.Content)
+	}
+	send("/nick bot:greeter")
+	if msg := readUntil(t, bob, "error"); !strings.Contains(msg.Content, "not allowed") {
+		t.Errorf("expected bot names to be reserved, got %q", msg.Content)
+	}
+	send("/nick robert")
+	if msg := readUntil(t, alice, "nick"); msg.Username != "robert" {
+		t.Errorf("unexpected nick message %+v", msg)
+	}
+	send("/who")
+	if msg := readUntil(t, bob, "info"); msg.Content != "In lobby: alice, robert" {
+		t.Errorf("unexpected /who reply %q", msg.Content)
+	}
+
+	alice.WriteJSON(Message{Content: "/topic Release day"})
+	if msg := readUntil(t, bob, "topic"); msg.Content != "Release day" {
+		t.Errorf("unexpected topic message %+v", msg)
+	}
+
+	mod.Mute(context.Background(), Action{Actor: "alice", Room: "lobby", Username: "robert"})
+	send("/me tries to speak")
+	if msg := readUntil(t, bob, "error"); !strings.Contains(msg.Content, "muted") {
+		t.Errorf("expected mute error, got %q", msg.Content)
+	}
+
+	alice.WriteJSON(Message{Content: "/kick robert too loud"})
+	if msg := readUntil(t, alice, "info"); msg.Content != "Kicked robert" {
+		t.Errorf("unexpected kick reply %q", msg.Content)
+	}
+	waitForClients(t, hub, "lobby", 1)
+}
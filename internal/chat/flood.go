@@ -0,0 +1,259 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/metrics"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+)
+
+// Flood-control policies, as reported by the rate_limited metric.
+const (
+	PolicyMessages     = "messages"
+	PolicyUserMessages = "user_messages"
+	policySlowMode     = "slow_mode"
+)
+
+// floodActor is recorded as the author of mutes issued for flooding.
+const floodActor = "flood-control"
+
+// Strikes older than strikeWindow are forgotten, so that only clients
+// that keep flooding are escalated against.
+const strikeWindow = 10 * time.Minute
+
+// FloodPolicy limits the messages clients send once connected. Rates are
+// messages per minute, and a zero rate disables its limit.
+type FloodPolicy struct {
+	ConnectionRate  int
+	ConnectionBurst int // defaults to ConnectionRate
+	UserRate        int // across every connection of the user
+	UserBurst       int // defaults to UserRate
+
+	// Clients over a limit are warned Warnings times, then muted for
+	// MuteDuration, then disconnected
+	Warnings     int
+	MuteDuration time.Duration
+}
+
+// FloodControl enforces a FloodPolicy and the slow mode of rooms.
+// Connection buckets live on the clients; user buckets may be shared with
+// other replicas through SetStore. Strikes and slow-mode posts are local.
+type FloodControl struct {
+	users *middleware.RateLimiter // per-user buckets, used while userLimit is set
+
+	mu           sync.Mutex
+	conn         *middleware.Policy // nil disables
+	userLimit    bool
+	warnings     int
+	muteDuration time.Duration
+	strikes      map[string]*strike
+	lastPost     map[string]time.Time // room and user -> last post, for slow mode
+}
+
+type strike struct {
+	count int
+	last  time.Time
+}
+
+func NewFloodControl(p FloodPolicy) *FloodControl {
+	f := &FloodControl{
+		users:    middleware.NewPolicyLimiter(middleware.Policy{Name: PolicyUserMessages}),
+		strikes:  make(map[string]*strike),
+		lastPost: make(map[string]time.Time),
+	}
+	f.SetPolicy(p)
+
+	go f.cleanup()
+
+	return f
+}
+
+// SetPolicy replaces the policy while serving. Buckets and strikes are
+// kept.
+func (f *FloodControl) SetPolicy(p FloodPolicy) {
+	var conn *middleware.Policy
+	if p.ConnectionRate > 0 {
+		if p.ConnectionBurst <= 0 {
+			p.ConnectionBurst = p.ConnectionRate
+		}
+		conn = &middleware.Policy{
+			Name: PolicyMessages, Limit: p.ConnectionRate, Period: time.Minute, Burst: p.ConnectionBurst,
+		}
+	}
+	if p.UserRate > 0 {
+		f.users.SetPolicy(middleware.Policy{
+			Name: PolicyUserMessages, Limit: p.UserRate, Period: time.Minute, Burst: p.UserBurst,
+		})
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.conn = conn
+	f.userLimit = p.UserRate > 0
+	f.warnings = p.Warnings
+	f.muteDuration = p.MuteDuration
+}
+
+// SetStore shares the per-user buckets with every replica using s.
+func (f *FloodControl) SetStore(s store.RateLimitStore) {
+	f.users.SetStore(s)
+}
+
+// cleanup forgets expired strikes and slow-mode posts every minute.
+func (f *FloodControl) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	for range ticker.C {
+		now := time.Now()
+		f.mu.Lock()
+		for key, s := range f.strikes {
+			if now.Sub(s.last) > strikeWindow {
+				delete(f.strikes, key)
+			}
+		}
+		for key, at := range f.lastPost {
+			if now.Sub(at) > store.MaxSlowMode*time.Second {
+				delete(f.lastPost, key)
+			}
+		}
+		f.mu.Unlock()
+	}
+}
+
+// userKey identifies the person behind c: their login, or their IP when
+// anonymous, since anonymous clients may change names at will.
+func userKey(c *Client) string {
+	if c.identity != nil && c.identity.Username != "" {
+		return "user:" + c.identity.Username
+	}
+	return "ip:" + c.ip
+}
+
+// allow takes a token from the buckets of c's connection and user. When
+// either is empty, it returns the policy and how long to wait.
+func (f *FloodControl) allow(c *Client, now time.Time) (string, time.Duration, bool) {
+	f.mu.Lock()
+	userLimit := f.userLimit
+	if f.conn != nil {
+		d := f.conn.Take(c.messageTAT, now)
+		if !d.Allowed {
+			f.mu.Unlock()
+			return PolicyMessages, d.RetryAfter, false
+		}
+		c.messageTAT = now.Add(d.Reset)
+	}
+	f.mu.Unlock()
+
+	if userLimit {
+		if d := f.users.Take(userKey(c)); !d.Allowed {
+			return PolicyUserMessages, d.RetryAfter, false
+		}
+	}
+	return "", 0, true
+}
+
+// strike records a violation by key and returns how many it has
+// committed within the strike window, with the escalation policy.
+func (f *FloodControl) strike(key string, now time.Time) (n, warnings int, mute time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.strikes[key]
+	if !ok || now.Sub(s.last) > strikeWindow {
+		s = &strike{}
+		f.strikes[key] = s
+	}
+	s.count++
+	s.last = now
+	return s.count, f.warnings, f.muteDuration
+}
+
+// post records a post to a room in slow mode unless the previous one was
+// less than interval ago, in which case it returns how long to wait.
+func (f *FloodControl) post(key string, interval time.Duration, now time.Time) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if last, ok := f.lastPost[key]; ok {
+		if wait := last.Add(interval).Sub(now); wait > 0 {
+			return wait
+		}
+	}
+	f.lastPost[key] = now
+	return 0
+}
+
+// flooding applies the hub's message limits to a frame from c, escalating
+// against clients that keep exceeding them, and reports whether the frame
+// must be dropped.
+func (c *Client) flooding(ctx context.Context) bool {
+	f := c.hub.flood
+	if f == nil {
+		return false
+	}
+
+	now := time.Now()
+	policy, wait, ok := f.allow(c, now)
+	if ok {
+		return false
+	}
+	metrics.RateLimited.WithLabelValues(policy).Inc()
+
+	n, warnings, mute := f.strike(userKey(c), now)
+	switch {
+	case n <= warnings:
+		c.sendError(fmt.Sprintf("you are sending messages too fast, wait %s (warning %d of %d)",
+			ceilSeconds(wait), n, warnings))
+		return true
+	case n == warnings+1 && c.mutable():
+		a := Action{Actor: floodActor, Room: c.room, Username: c.name(), Reason: "flooding", Duration: mute}
+		if _, err := c.hub.moderation.Mute(ctx, a); err == nil {
+			return true
+		}
+	}
+	c.disconnect("disconnected for flooding")
+	return true
+}
+
+// mutable reports whether c can be muted. Mutes apply to a name, and the
+// anonymous name is shared by everyone who did not pick one.
+func (c *Client) mutable() bool {
+	return c.hub.moderation != nil && c.name() != anonymous
+}
+
+// slowMode applies the slow mode of c's room, recording the post when it
+// is allowed, and returns how long c must wait otherwise. Moderators are
+// exempt.
+func (c *Client) slowMode(ctx context.Context) time.Duration {
+	f := c.hub.flood
+	if f == nil || c.hub.roomStore == nil {
+		return 0
+	}
+	if c.identity != nil && c.identity.HasScope(middleware.ScopeAdmin) {
+		return 0
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	room, err := c.hub.roomStore.GetRoom(ctx, c.room)
+	cancel()
+	if err != nil || room.SlowMode <= 0 || room.IsModerator(authenticatedName(c.identity)) {
+		return 0
+	}
+
+	wait := f.post(c.room+"\x00"+userKey(c), time.Duration(room.SlowMode)*time.Second, time.Now())
+	if wait > 0 {
+		metrics.RateLimited.WithLabelValues(policySlowMode).Inc()
+	}
+	return wait
+}
+
+func slowModeNotice(wait time.Duration) string {
+	return fmt.Sprintf("slow mode is on, you can post again in %s", ceilSeconds(wait))
+}
+
+// ceilSeconds rounds d up to whole seconds for notices.
+func ceilSeconds(d time.Duration) time.Duration {
+	return time.Duration(math.Ceil(d.Seconds())) * time.Second
+}
@@ -0,0 +1,102 @@
+package chat
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/gorilla/websocket"
+)
+
+func sendText(t *testing.T, conn *websocket.Conn, content string) {
+	t.Helper()
+	if err := conn.WriteJSON(Message{Content: content}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+}
+
+func TestFloodControl_Escalation(t *testing.T) {
+	hub, mod, _, server := newModeratedServer(t)
+	hub.SetFloodControl(NewFloodControl(FloodPolicy{
+		ConnectionRate: 60, ConnectionBurst: 2, Warnings: 1, MuteDuration: time.Minute,
+	}))
+
+	conn := dialChat(t, server, "room=lobby&username=spammer")
+	defer conn.Close()
+	waitForClients(t, hub, "lobby", 1)
+
+	// The burst goes through
+	for i := 0; i < 2; i++ {
+		sendText(t, conn, "hi")
+		readUntil(t, conn, "message")
+	}
+
+	// Then the client is warned, muted, and disconnected
+	sendText(t, conn, "hi")
+	if msg := readUntil(t, conn, "error"); !strings.Contains(msg.Content, "warning 1 of 1") {
+		t.Errorf("expected a warning, got %q", msg.Content)
+	}
+
+	sendText(t, conn, "hi")
+	if msg := readUntil(t, conn, "error"); msg.Content != "you have been muted: flooding" {
+		t.Errorf("expected a mute notice, got %q", msg.Content)
+	}
+	active := mod.Active(context.Background())
+	if len(active) != 1 || active[0].Kind != store.SanctionMute || active[0].By != floodActor {
+		t.Fatalf("expected a flood-control mute, got %+v", active)
+	}
+	if active[0].ExpiresAt.IsZero() {
+		t.Error("flood mutes should expire")
+	}
+
+	sendText(t, conn, "hi")
+	expectClose(t, conn, "disconnected for flooding")
+}
+
+func TestFloodControl_UserLimitSpansConnections(t *testing.T) {
+	hub, _, _, server := newModeratedServer(t)
+	hub.SetFloodControl(NewFloodControl(FloodPolicy{UserRate: 60, UserBurst: 2, Warnings: 3}))
+
+	a := dialChat(t, server, "room=lobby&username=a")
+	defer a.Close()
+	b := dialChat(t, server, "room=lobby&username=b")
+	defer b.Close()
+	waitForClients(t, hub, "lobby", 2)
+
+	// Anonymous clients are limited by IP, so both share one bucket
+	sendText(t, a, "one")
+	readUntil(t, a, "message")
+	sendText(t, a, "two")
+	readUntil(t, a, "message")
+
+	sendText(t, b, "three")
+	if msg := readUntil(t, b, "error"); !strings.Contains(msg.Content, "too fast") {
+		t.Errorf("expected the second connection to be limited, got %q", msg.Content)
+	}
+}
+
+func TestFloodControl_SlowMode(t *testing.T) {
+	hub, _, s, server := newModeratedServer(t)
+	hub.SetRoomStore(s)
+	hub.SetFloodControl(NewFloodControl(FloodPolicy{}))
+	s.CreateRoom(context.Background(), &store.Room{
+		Name:       "lobby",
+		Visibility: store.VisibilityPublic,
+		SlowMode:   60,
+		Members:    map[string]string{"owner": store.RoleOwner},
+	})
+
+	conn := dialChat(t, server, "room=lobby&username=alice")
+	defer conn.Close()
+	waitForClients(t, hub, "lobby", 1)
+
+	sendText(t, conn, "first")
+	readUntil(t, conn, "message")
+
+	sendText(t, conn, "second")
+	if msg := readUntil(t, conn, "error"); !strings.HasPrefix(msg.Content, "slow mode is on") {
+		t.Errorf("expected a slow mode notice, got %q", msg.Content)
+	}
+}
@@ -2,20 +2,34 @@ package chat
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/TrailBlazors/realtime-chat-railway/internal/invite"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/metrics"
 	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/tracing"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/webhook"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Message struct {
-	Type     string `json:"type"`
-	Username string `json:"username"`
-	Content  string `json:"content"`
-	Room     string `json:"room"`
-	Time     string `json:"time"`
+	Type     string `json:"type" msgpack:"type"`
+	Username string `json:"username" msgpack:"username"`
+	Content  string `json:"content" msgpack:"content"`
+	Room     string `json:"room" msgpack:"room"`
+	Time     string `json:"time" msgpack:"time"`
+	Bot      bool   `json:"bot,omitempty" msgpack:"bot,omitempty"` // sent by a bot
+
+	// Trace is the W3C traceparent of the span that received the message,
+	// so that recipients can link their spans to it
+	Trace string `json:"traceparent,omitempty" msgpack:"traceparent,omitempty"`
 }
 
 type Hub struct {
@@ -23,18 +37,45 @@ type Hub struct {
 	broadcast  chan Message
 	register   chan *Client
 	unregister chan *Client
+	probe      chan chan struct{}
 	mu         sync.RWMutex
 	store      store.Store
+	roomStore  store.RoomStore // nil means every room is public
+	invites    *invite.Manager // nil disables invite links
+	moderation *Moderation     // nil disables bans and mutes
+	flood      *FloodControl   // nil disables message limits and slow mode
+	webhooks   *webhook.Dispatcher
+	commands   *Commands
+
+	botCommands    map[string]map[string]*Client // room -> command -> bot
+	maxConnections int                           // 0 means unlimited
+	maxPerIP       int                           // 0 means unlimited
+	maxPerUser     int                           // 0 means unlimited
+	ipConns        map[string]int
+	userConns      map[string]int
+	clients        int // registered clients
+	pending        int // admitted clients that have not registered yet
+	lastClientID   uint64
 }
 
 func NewHub(s store.Store) *Hub {
-	return &Hub{
+	h := &Hub{
 		rooms:      make(map[string]map[*Client]bool),
 		broadcast:  make(chan Message, 256),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		probe:      make(chan chan struct{}),
 		store:      s,
+		commands:   NewCommands(),
+
+		botCommands: make(map[string]map[string]*Client),
+		ipConns:     make(map[string]int),
+		userConns:   make(map[string]int),
+	}
+	for _, cmd := range builtinCommands() {
+		h.commands.Register(cmd)
 	}
+	return h
 }
 
 func (h *Hub) Run() {
@@ -47,12 +88,19 @@ func (h *Hub) Run() {
 				slog.Info("room created", "room", client.room)
 			}
 			h.rooms[client.room][client] = true
+			if client.reserved {
+				h.pending--
+			}
+			h.lastClientID++
+			client.id = strconv.FormatUint(h.lastClientID, 10)
+			client.connectedAt = time.Now()
 			clientCount := len(h.rooms[client.room])
+			h.recordClients(1)
 			h.mu.Unlock()
 
 			slog.Debug("client registered",
 				"room", client.room,
-				"username", client.username,
+				"username", client.name(),
 				"clients_in_room", clientCount,
 			)
 
@@ -62,37 +110,63 @@ func (h *Hub) Run() {
 				if _, exists := clients[client]; exists {
 					delete(clients, client)
 					close(client.send)
+					h.countConnection(client, -1)
+					if client.bot {
+						h.releaseCommands(client)
+					}
 					if len(clients) == 0 {
 						delete(h.rooms, client.room)
 						slog.Info("room deleted (empty)", "room", client.room)
 					}
+					h.recordClients(-1)
 				}
 			}
 			h.mu.Unlock()
 
+		case reply := <-h.probe:
+			close(reply)
+
 		case message := <-h.broadcast:
-			// Persist message to store
-			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			// Persist message to store, in the trace of the span that
+			// received it
+			ctx, span := tracing.Tracer().Start(tracing.Extract(context.Background(), message.Trace), "chat.persist",
+				trace.WithAttributes(attribute.String("chat.room", message.Room), attribute.String("chat.type", message.Type)))
+			ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 			if err := h.store.SaveMessage(ctx, store.Message(message)); err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, "failed to persist message")
 				slog.Warn("failed to persist message", "error", err, "room", message.Room)
 			}
 			cancel()
+			span.End()
 
 			h.mu.RLock()
 			clients := h.rooms[message.Room]
 			h.mu.RUnlock()
 
-			messageBytes, _ := json.Marshal(message)
+			start := time.Now()
+			encoded := newEncodedMessage(message)
 			for client := range clients {
 				select {
-				case client.send <- messageBytes:
+				case client.send <- encoded.bytes(client.encoding()):
+					metrics.MessagesOut.Inc()
+					metrics.SendBufferOccupancy.Observe(float64(len(client.send)) / float64(cap(client.send)))
 				default:
 					close(client.send)
 					h.mu.Lock()
 					delete(h.rooms[message.Room], client)
+					h.countConnection(client, -1)
+					if client.bot {
+						h.releaseCommands(client)
+					}
+					h.recordClients(-1)
 					h.mu.Unlock()
+					metrics.SlowConsumerEvictions.Inc()
 				}
 			}
+			metrics.BroadcastDuration.Observe(time.Since(start).Seconds())
+
+			h.publish(message)
 
 			if message.Type == "message" {
 				slog.Debug("message broadcast",
@@ -105,6 +179,169 @@ func (h *Hub) Run() {
 	}
 }
 
+// recordClients updates the gauges after delta clients joined or left.
+// Rooms are not a label: their names are chosen by users, unbounded in
+// number and private for members-only rooms. The caller holds h.mu.
+func (h *Hub) recordClients(delta int) {
+	h.clients += delta
+	metrics.Clients.Add(float64(delta))
+	metrics.Rooms.Set(float64(len(h.rooms)))
+}
+
+// SetRoomStore enables room access control. It must be called before the
+// hub starts serving clients.
+func (h *Hub) SetRoomStore(rs store.RoomStore) {
+	h.roomStore = rs
+}
+
+// SetInvites lets clients join members-only rooms with an invite link
+// (?invite=). Like SetRoomStore, it must be called before serving clients.
+func (h *Hub) SetInvites(m *invite.Manager) {
+	h.invites = m
+}
+
+// SetModeration enables bans and mutes. It must be called before serving
+// clients.
+func (h *Hub) SetModeration(m *Moderation) {
+	h.moderation = m
+}
+
+// SetFloodControl limits the messages clients send once connected and
+// enables slow mode. It must be called before serving clients.
+func (h *Hub) SetFloodControl(f *FloodControl) {
+	h.flood = f
+}
+
+// SetWebhooks sends room events to webhooks. It must be called before
+// serving clients.
+func (h *Hub) SetWebhooks(d *webhook.Dispatcher) {
+	h.webhooks = d
+}
+
+// publish notifies webhooks of chat messages and presence changes.
+func (h *Hub) publish(msg Message) {
+	if h.webhooks == nil {
+		return
+	}
+	switch msg.Type {
+	case "message", "action":
+		h.webhooks.Publish(webhook.Event{Type: store.EventMessage, Room: msg.Room, Data: msg})
+	case "join", "leave":
+		h.webhooks.Publish(webhook.Event{Type: msg.Type, Room: msg.Room, Data: msg})
+	}
+}
+
+// SetMaxConnections limits the number of connected clients across every
+// room. Zero, the default, means unlimited. It may be called while
+// serving; clients over a lowered limit stay connected.
+func (h *Hub) SetMaxConnections(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxConnections = n
+}
+
+// SetConnectionCaps limits the concurrent connections from one IP and of
+// one logged-in user. Anonymous users are only limited by IP, since they
+// pick their names. Zero means unlimited. Like SetMaxConnections, it may
+// be called while serving.
+func (h *Hub) SetConnectionCaps(perIP, perUser int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxPerIP = perIP
+	h.maxPerUser = perUser
+}
+
+// countConnection adjusts the connection counts of c's IP and user by
+// delta. The caller holds h.mu.
+func (h *Hub) countConnection(c *Client, delta int) {
+	h.countSlots(c.ip, authenticatedName(c.identity), delta)
+}
+
+// countSlots adjusts the connection counts of ip and user, which may be
+// empty, by delta. The caller holds h.mu.
+func (h *Hub) countSlots(ip, user string, delta int) {
+	adjust := func(counts map[string]int, key string) {
+		if key == "" {
+			return
+		}
+		if counts[key] += delta; counts[key] <= 0 {
+			delete(counts, key)
+		}
+	}
+	adjust(h.ipConns, ip)
+	adjust(h.userConns, user)
+}
+
+// Probe waits for Run to answer a request, proving that the hub loop is
+// not stuck.
+func (h *Hub) Probe(ctx context.Context) error {
+	reply := make(chan struct{})
+	select {
+	case h.probe <- reply:
+	case <-ctx.Done():
+		return fmt.Errorf("hub loop did not answer: %w", ctx.Err())
+	}
+	select {
+	case <-reply:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("hub loop did not answer: %w", ctx.Err())
+	}
+}
+
+// errServerFull is returned by reserveConnection when the hub has as many
+// connections as SetMaxConnections allows.
+var errServerFull = errors.New("the server has reached its connection limit")
+
+// CheckCapacity returns an error when the connection limit is reached.
+func (h *Hub) CheckCapacity(context.Context) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if n := h.clients + h.pending; h.maxConnections > 0 && n >= h.maxConnections {
+		return fmt.Errorf("%d of %d connections in use", n, h.maxConnections)
+	}
+	return nil
+}
+
+// reserveConnection takes a connection slot of the hub, ip and user, which
+// may be empty, or returns an error when any has as many connections as
+// allowed; errServerFull for the hub. Checking and counting under one lock
+// keeps concurrent upgrades from overshooting the caps. The slot is freed
+// when the client leaves the hub, or by releaseConnection if it never
+// registers. The client must be marked reserved so that registering moves
+// it from the pending to the registered count.
+func (h *Hub) reserveConnection(ip, user string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.maxConnections > 0 && h.clients+h.pending >= h.maxConnections {
+		return errServerFull
+	}
+	if n := h.ipConns[ip]; ip != "" && h.maxPerIP > 0 && n >= h.maxPerIP {
+		return fmt.Errorf("%d connections from your address are already open", n)
+	}
+	if n := h.userConns[user]; user != "" && h.maxPerUser > 0 && n >= h.maxPerUser {
+		return fmt.Errorf("%d connections of your account are already open", n)
+	}
+	h.pending++
+	h.countSlots(ip, user, 1)
+	return nil
+}
+
+// releaseConnection frees a slot taken by reserveConnection for a client
+// that did not register, such as a failed upgrade.
+func (h *Hub) releaseConnection(ip, user string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pending--
+	h.countSlots(ip, user, -1)
+}
+
+// Commands returns the hub's slash-command registry, which starts out with
+// the built-in commands.
+func (h *Hub) Commands() *Commands {
+	return h.commands
+}
+
 func (h *Hub) BroadcastMessage(msg Message) {
 	h.broadcast <- msg
 }
@@ -115,6 +352,17 @@ func (h *Hub) GetRoomCount() int {
 	return len(h.rooms)
 }
 
+// GetConnectionCount returns the number of clients in every room.
+func (h *Hub) GetConnectionCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	n := 0
+	for _, clients := range h.rooms {
+		n += len(clients)
+	}
+	return n
+}
+
 func (h *Hub) GetClientCount(room string) int {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -123,3 +371,16 @@ func (h *Hub) GetClientCount(room string) int {
 	}
 	return 0
 }
+
+// RoomInUse reports whether room has clients connected or messages in its
+// history, even though nobody may have claimed it.
+func (h *Hub) RoomInUse(ctx context.Context, room string) (bool, error) {
+	if h.GetClientCount(room) > 0 {
+		return true, nil
+	}
+	history, err := h.store.GetRecentMessages(ctx, room, 1)
+	if err != nil {
+		return false, err
+	}
+	return len(history) > 0, nil
+}
@@ -2,10 +2,15 @@ package chat
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/TrailBlazors/realtime-chat-railway/internal/metrics"
 	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/webhook"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestHub_RoomManagement(t *testing.T) {
@@ -212,3 +217,101 @@ func TestHub_MessagePersistence(t *testing.T) {
 		t.Errorf("join message should not be persisted, got %d messages", len(ms.messages))
 	}
 }
+
+func TestHub_PublishesWebhookEvents(t *testing.T) {
+	events := make(chan string, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events <- r.Header.Get(webhook.HeaderEvent)
+	}))
+	defer receiver.Close()
+
+	s := store.NewMemoryStore()
+	dispatcher := webhook.NewDispatcher(s)
+	dispatcher.AllowPrivateNetworks()
+	if _, err := dispatcher.Create(context.Background(), "lobby", receiver.URL, nil, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+
+	hub := NewHub(store.NewNoOpStore())
+	hub.SetWebhooks(dispatcher)
+	mod := NewModeration(hub, s)
+	hub.SetModeration(mod)
+	go hub.Run()
+
+	hub.BroadcastMessage(presenceMessage("join", "bob", "lobby"))
+	hub.BroadcastMessage(Message{Type: "message", Username: "bob", Content: "hi", Room: "lobby"})
+	hub.BroadcastMessage(Message{Type: "message", Username: "bob", Content: "elsewhere", Room: "other"})
+	if _, err := mod.Mute(ctx, Action{Actor: "alice", Room: "lobby", Username: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]int{}
+	for range 3 {
+		select {
+		case e := <-events:
+			got[e]++
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for events, got %v", got)
+		}
+	}
+	if got[store.EventJoin] != 1 || got[store.EventMessage] != 1 || got[store.EventModeration] != 1 {
+		t.Errorf("unexpected events %v", got)
+	}
+}
+
+func TestHub_RecordsMetrics(t *testing.T) {
+	hub := NewHub(store.NewNoOpStore())
+	go hub.Run()
+
+	clients := testutil.ToFloat64(metrics.Clients)
+	fast := &Client{hub: hub, send: make(chan []byte, 256), room: "metrics-room", username: "fast"}
+	slow := &Client{hub: hub, send: make(chan []byte, 1), room: "metrics-room", username: "slow"}
+	hub.register <- fast
+	hub.register <- slow
+	time.Sleep(10 * time.Millisecond)
+
+	if got := testutil.ToFloat64(metrics.Clients); got != clients+2 {
+		t.Errorf("expected 2 more clients in the gauge, got %v", got-clients)
+	}
+
+	sent := testutil.ToFloat64(metrics.MessagesOut)
+	evicted := testutil.ToFloat64(metrics.SlowConsumerEvictions)
+	for range 2 {
+		hub.BroadcastMessage(Message{Type: "message", Username: "fast", Content: "hi", Room: "metrics-room"})
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if got := testutil.ToFloat64(metrics.MessagesOut); got != sent+3 {
+		t.Errorf("expected 3 messages sent, got %v", got-sent)
+	}
+	if got := testutil.ToFloat64(metrics.SlowConsumerEvictions); got != evicted+1 {
+		t.Errorf("expected the slow client to be evicted, got %v", got-evicted)
+	}
+	if got := testutil.ToFloat64(metrics.Clients); got != clients+1 {
+		t.Errorf("expected 1 more client after eviction, got %v", got-clients)
+	}
+
+	hub.unregister <- fast
+	time.Sleep(10 * time.Millisecond)
+	if got := testutil.ToFloat64(metrics.Clients); got != clients {
+		t.Errorf("expected the gauge back at %v, got %v", clients, got)
+	}
+}
+
+func TestHub_Probe(t *testing.T) {
+	hub := NewHub(store.NewNoOpStore())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := hub.Probe(ctx); err == nil {
+		t.Error("probe should fail while the hub loop is not running")
+	}
+
+	go hub.Run()
+	if err := hub.Probe(context.Background()); err != nil {
+		t.Errorf("unexpected probe error: %v", err)
+	}
+}
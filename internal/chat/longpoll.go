@@ -0,0 +1,394 @@
+package chat
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/tracing"
+)
+
+const (
+	pollTimeout     = 25 * time.Second
+	pollSessionIdle = 60 * time.Second
+	pollBacklog     = 256
+)
+
+type pollEntry struct {
+	seq  uint64
+	data []byte
+}
+
+// pollSession buffers the messages delivered to a long-poll subscriber
+// between two polls. Every entry gets a sequence number which the client
+// echoes back as its cursor.
+type pollSession struct {
+	id     string
+	lp     *LongPoll
+	client *Client
+	owner  pollOwner // identity that opened the session
+
+	mu       sync.Mutex
+	entries  []pollEntry
+	next     uint64
+	notify   chan struct{}
+	waiters  int
+	lastPoll time.Time
+	closed   bool
+}
+
+// pollOwner identifies the credentials of a long-poll request. Anonymous
+// requests, when auth is disabled, have the zero value.
+type pollOwner struct {
+	username, keyName string
+}
+
+func ownerOf(r *http.Request) pollOwner {
+	id, ok := middleware.IdentityFromContext(r.Context())
+	if !ok {
+		return pollOwner{}
+	}
+	return pollOwner{username: id.Username, keyName: id.KeyName}
+}
+
+type pollResponse struct {
+	Session  string            `json:"session"`
+	Cursor   uint64            `json:"cursor"`
+	Messages []json.RawMessage `json:"messages"`
+}
+
+// LongPoll serves the HTTP long-polling transport. A GET on the endpoint
+// holds the request open until messages arrive for the session or the
+// timeout expires; a POST sends a message into the session's room.
+type LongPoll struct {
+	hub      *Hub
+	timeout  time.Duration
+	idle     time.Duration
+	mu       sync.Mutex
+	sessions map[string]*pollSession
+}
+
+func NewLongPoll(hub *Hub) *LongPoll {
+	lp := &LongPoll{
+		hub:      hub,
+		timeout:  pollTimeout,
+		idle:     pollSessionIdle,
+		sessions: make(map[string]*pollSession),
+	}
+
+	go lp.cleanup()
+
+	return lp
+}
+
+func (lp *LongPoll) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		lp.poll(w, r)
+	case http.MethodPost:
+		lp.publish(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// poll returns the messages after the requested cursor. Without a session
+// parameter it opens a new session and returns its id without waiting.
+func (lp *LongPoll) poll(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("session")
+	if id == "" {
+		adm, rej := admit(lp.hub, r)
+		if rej != nil {
+			rej.write(w)
+			return
+		}
+		s := lp.open(r, adm)
+		lp.respond(w, s, 0, s.wait(r, 0, 0))
+		return
+	}
+
+	s := lp.lookup(id)
+	if s == nil {
+		http.Error(w, "Unknown Session", http.StatusGone)
+		return
+	}
+	if !s.ownedBy(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if s.isClosed() {
+		http.Error(w, "Unknown Session", http.StatusGone)
+		return
+	}
+
+	cursor, _ := strconv.ParseUint(r.URL.Query().Get("cursor"), 10, 64)
+	entries := s.wait(r, cursor, lp.timeout)
+	if len(entries) == 0 && s.isClosed() {
+		http.Error(w, "Unknown Session", http.StatusGone)
+		return
+	}
+	lp.respond(w, s, cursor, entries)
+}
+
+func (lp *LongPoll) publish(w http.ResponseWriter, r *http.Request) {
+	s := lp.lookup(r.URL.Query().Get("session"))
+	if s == nil {
+		http.Error(w, "Unknown Session", http.StatusGone)
+		return
+	}
+	if !s.ownedBy(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	// The client was kicked, banned or evicted and left the hub
+	if s.isClosed() {
+		http.Error(w, "Unknown Session", http.StatusGone)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, settings.Load().MaxMessageSize))
+	if err != nil {
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	s.client.handleInbound(tracing.FromRequest(r), body)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (lp *LongPoll) respond(w http.ResponseWriter, s *pollSession, cursor uint64, entries []pollEntry) {
+	resp := pollResponse{
+		Session:  s.id,
+		Cursor:   cursor,
+		Messages: make([]json.RawMessage, 0, len(entries)),
+	}
+	var size int64
+	for _, e := range entries {
+		resp.Messages = append(resp.Messages, e.data)
+		size += int64(len(e.data))
+	}
+	s.client.bytesSent.Add(size)
+	if len(entries) > 0 {
+		resp.Cursor = entries[len(entries)-1].seq + 1
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// open registers a new long-poll subscriber with the hub.
+func (lp *LongPoll) open(r *http.Request, adm *admission) *pollSession {
+	client := &Client{
+		hub:      lp.hub,
+		send:     make(chan []byte, 256),
+		room:     adm.room,
+		username: adm.username,
+		ip:       adm.ip,
+		identity: adm.identity,
+		role:     adm.role,
+		bot:      adm.identity != nil && adm.identity.IsBot(),
+		reserved: true,
+
+		transport:  TransportLongPoll,
+		remoteAddr: r.RemoteAddr,
+	}
+	s := &pollSession{
+		id:       newSessionID(),
+		lp:       lp,
+		client:   client,
+		owner:    ownerOf(r),
+		notify:   make(chan struct{}),
+		lastPoll: time.Now(),
+	}
+	client.poll = s
+
+	lp.mu.Lock()
+	lp.sessions[s.id] = s
+	lp.mu.Unlock()
+
+	go s.pump()
+	lp.hub.register <- client
+
+	slog.Info("long-poll client connected",
+		"username", client.name(),
+		"room", client.room,
+		"remote_addr", r.RemoteAddr,
+		"ip", client.ip,
+	)
+
+	client.sendHistory()
+	lp.hub.BroadcastMessage(client.presence("join"))
+
+	return s
+}
+
+// ownedBy reports whether r carries the credentials that opened the
+// session, so that a leaked session id is not enough to read or post as
+// its owner.
+func (s *pollSession) ownedBy(r *http.Request) bool {
+	if ownerOf(r) != s.owner {
+		slog.Warn("long-poll session used with other credentials", "ip", middleware.ClientIP(r), "room", s.client.room)
+		return false
+	}
+	return true
+}
+
+func (lp *LongPoll) lookup(id string) *pollSession {
+	if id == "" {
+		return nil
+	}
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	return lp.sessions[id]
+}
+
+// remove forgets a session whose client has left the hub.
+func (lp *LongPoll) remove(id string) {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	delete(lp.sessions, id)
+}
+
+// cleanup closes sessions that have not been polled within the idle period.
+func (lp *LongPoll) cleanup() {
+	ticker := time.NewTicker(lp.idle / 2)
+	for range ticker.C {
+		var expired []*pollSession
+
+		lp.mu.Lock()
+		for id, s := range lp.sessions {
+			if s.expired(lp.idle) {
+				delete(lp.sessions, id)
+				expired = append(expired, s)
+			}
+		}
+		lp.mu.Unlock()
+
+		for _, s := range expired {
+			lp.hub.unregister <- s.client
+			slog.Info("long-poll client disconnected",
+				"username", s.client.name(),
+				"room", s.client.room,
+			)
+			lp.hub.BroadcastMessage(s.client.presence("leave"))
+		}
+	}
+}
+
+// pump moves messages from the client's send channel into the session
+// buffer until the hub closes the channel, then forgets the session.
+func (s *pollSession) pump() {
+	for data := range s.client.send {
+		s.mu.Lock()
+		if !s.closed {
+			s.push(data)
+		}
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.notify)
+	}
+	s.mu.Unlock()
+	s.lp.remove(s.id)
+}
+
+// end buffers a last message and closes the session without waiting for
+// the hub to unregister the client, so that a poll in progress still gets
+// data but no later request is served.
+func (s *pollSession) end(data []byte) {
+	s.mu.Lock()
+	if !s.closed {
+		s.push(data)
+		s.closed = true
+	}
+	s.mu.Unlock()
+	s.lp.remove(s.id)
+}
+
+// push buffers data and wakes the waiting polls. The caller holds s.mu.
+func (s *pollSession) push(data []byte) {
+	s.entries = append(s.entries, pollEntry{seq: s.next, data: data})
+	s.next++
+	if len(s.entries) > pollBacklog {
+		s.entries = s.entries[len(s.entries)-pollBacklog:]
+	}
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+// wait returns the buffered entries at or after cursor, blocking for up to
+// timeout when there are none yet.
+func (s *pollSession) wait(r *http.Request, cursor uint64, timeout time.Duration) []pollEntry {
+	s.mu.Lock()
+	s.waiters++
+	s.lastPoll = time.Now()
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.waiters--
+		s.lastPoll = time.Now()
+		s.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		entries := s.since(cursor)
+		notify, closed := s.notify, s.closed
+		s.mu.Unlock()
+
+		if len(entries) > 0 || closed || timeout == 0 {
+			return entries
+		}
+
+		select {
+		case <-notify:
+		case <-timer.C:
+			return nil
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (s *pollSession) since(cursor uint64) []pollEntry {
+	for i, e := range s.entries {
+		if e.seq >= cursor {
+			return append([]pollEntry(nil), s.entries[i:]...)
+		}
+	}
+	return nil
+}
+
+func (s *pollSession) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *pollSession) expired(idle time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed || (s.waiters == 0 && time.Since(s.lastPoll) > idle)
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
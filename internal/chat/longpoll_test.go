@@ -0,0 +1,193 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/config"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+)
+
+func doPoll(t *testing.T, lp *LongPoll, target string) pollResponse {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", target, nil)
+	rec := httptest.NewRecorder()
+	lp.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var resp pollResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	return resp
+}
+
+func TestLongPoll_ReceiveAndSend(t *testing.T) {
+	InitClient(&config.Config{MaxMessageSize: 4096})
+
+	hub := NewHub(store.NewNoOpStore())
+	go hub.Run()
+
+	lp := NewLongPoll(hub)
+	lp.timeout = time.Second
+
+	// Open a session
+	resp := doPoll(t, lp, "/poll?room=test-room&username=user1")
+	if resp.Session == "" {
+		t.Fatal("expected a session id")
+	}
+	if hub.GetClientCount("test-room") != 1 {
+		t.Errorf("expected 1 client in room, got %d", hub.GetClientCount("test-room"))
+	}
+
+	// Drain the join message
+	cursor := resp.Cursor
+	for {
+		resp = doPoll(t, lp, "/poll?session="+resp.Session+"&cursor="+itoa(cursor))
+		cursor = resp.Cursor
+		if len(resp.Messages) > 0 {
+			break
+		}
+	}
+
+	// Send a message through the session
+	req := httptest.NewRequest("POST", "/poll?session="+resp.Session, strings.NewReader(`{"content":"Hello!"}`))
+	rec := httptest.NewRecorder()
+	lp.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", rec.Code)
+	}
+
+	resp = doPoll(t, lp, "/poll?session="+resp.Session+"&cursor="+itoa(cursor))
+	if len(resp.Messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(resp.Messages))
+	}
+
+	var msg Message
+	json.Unmarshal(resp.Messages[0], &msg)
+	if msg.Content != "Hello!" || msg.Username != "user1" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if resp.Cursor != cursor+1 {
+		t.Errorf("expected cursor %d, got %d", cursor+1, resp.Cursor)
+	}
+}
+
+func TestLongPoll_Timeout(t *testing.T) {
+	InitClient(&config.Config{MaxMessageSize: 4096})
+
+	hub := NewHub(store.NewNoOpStore())
+	go hub.Run()
+
+	lp := NewLongPoll(hub)
+	lp.timeout = 50 * time.Millisecond
+
+	resp := doPoll(t, lp, "/poll?room=quiet-room&username=user1")
+	time.Sleep(50 * time.Millisecond)
+
+	// Skip past the join message, then wait with nothing to deliver
+	resp = doPoll(t, lp, "/poll?session="+resp.Session+"&cursor=1")
+
+	if len(resp.Messages) != 0 {
+		t.Errorf("expected no messages, got %d", len(resp.Messages))
+	}
+	if resp.Cursor != 1 {
+		t.Errorf("cursor should not advance on timeout, got %d", resp.Cursor)
+	}
+}
+
+func TestLongPoll_UnknownSession(t *testing.T) {
+	hub := NewHub(store.NewNoOpStore())
+	lp := NewLongPoll(hub)
+
+	req := httptest.NewRequest("GET", "/poll?session=missing", nil)
+	rec := httptest.NewRecorder()
+	lp.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusGone {
+		t.Errorf("expected 410, got %d", rec.Code)
+	}
+}
+
+func TestLongPoll_ClosedSession(t *testing.T) {
+	InitClient(&config.Config{MaxMessageSize: 4096})
+
+	hub := NewHub(store.NewNoOpStore())
+	go hub.Run()
+
+	lp := NewLongPoll(hub)
+	lp.timeout = 50 * time.Millisecond
+
+	resp := doPoll(t, lp, "/poll?room=test-room&username=user1")
+	s := lp.lookup(resp.Session)
+
+	// The hub drops the client, as on a kick or a slow-consumer eviction
+	hub.unregister <- s.client
+	deadline := time.Now().Add(time.Second)
+	for lp.lookup(resp.Session) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("session was not removed after its client left the hub")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !s.isClosed() {
+		t.Error("expected the session to be closed")
+	}
+
+	for _, method := range []string{"GET", "POST"} {
+		req := httptest.NewRequest(method, "/poll?session="+resp.Session, strings.NewReader(`{"content":"still here"}`))
+		rec := httptest.NewRecorder()
+		lp.ServeHTTP(rec, req)
+		if rec.Code != http.StatusGone {
+			t.Errorf("%s: expected 410, got %d", method, rec.Code)
+		}
+	}
+}
+
+func itoa(n uint64) string {
+	return strconv.FormatUint(n, 10)
+}
+
+func TestLongPoll_SessionBoundToIdentity(t *testing.T) {
+	InitClient(&config.Config{MaxMessageSize: 4096})
+
+	hub := NewHub(store.NewNoOpStore())
+	go hub.Run()
+
+	lp := NewLongPoll(hub)
+	lp.timeout = 10 * time.Millisecond
+
+	rec := httptest.NewRecorder()
+	lp.ServeHTTP(rec, asUser(httptest.NewRequest("GET", "/poll?room=lobby", nil), "alice"))
+	var resp pollResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Session == "" {
+		t.Fatalf("expected a session, got %d %s", rec.Code, rec.Body)
+	}
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/poll?session="+resp.Session, nil),
+		asUser(httptest.NewRequest("GET", "/poll?session="+resp.Session, nil), "mallory"),
+		asUser(httptest.NewRequest("POST", "/poll?session="+resp.Session, strings.NewReader(`{"content":"hi"}`)), "mallory"),
+	} {
+		rec := httptest.NewRecorder()
+		lp.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s as another identity: expected 403, got %d", req.Method, rec.Code)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	lp.ServeHTTP(rec, asUser(httptest.NewRequest("GET", "/poll?session="+resp.Session, nil), "alice"))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected the owner to poll, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,312 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/webhook"
+	"github.com/gorilla/websocket"
+)
+
+var ErrNoTarget = errors.New("a username or IP address is required")
+
+// Action describes a moderation action. An empty Room applies a ban or mute
+// in every room; a zero Duration makes it permanent.
+type Action struct {
+	Actor    string
+	Room     string
+	Username string
+	IP       string
+	Reason   string
+	Duration time.Duration
+}
+
+// Moderation enforces bans and mutes and acts on connected clients. Every
+// action is persisted and appended to the audit log. Active sanctions are
+// cached and reloaded periodically so that changes made by other instances
+// are picked up.
+type Moderation struct {
+	hub     *Hub
+	store   store.ModerationStore
+	refresh time.Duration
+
+	mu        sync.RWMutex
+	sanctions []store.Sanction
+	loaded    time.Time
+}
+
+func NewModeration(hub *Hub, s store.ModerationStore) *Moderation {
+	return &Moderation{hub: hub, store: s, refresh: 30 * time.Second}
+}
+
+// Kick disconnects the user's connections to the room and returns how many
+// were closed.
+func (m *Moderation) Kick(ctx context.Context, a Action) (int, error) {
+	if a.Username == "" {
+		return 0, ErrNoTarget
+	}
+
+	clients := m.hub.clientsMatching(a.Room, func(c *Client) bool { return c.name() == a.Username })
+	if len(clients) == 0 {
+		return 0, nil
+	}
+	if err := m.audit(ctx, "kick", a, nil); err != nil {
+		return 0, err
+	}
+
+	for _, c := range clients {
+		c.disconnect(withReason("you were kicked", a.Reason))
+	}
+	slog.Info("user kicked", "room", a.Room, "username", a.Username, "by", a.Actor)
+	return len(clients), nil
+}
+
+// Ban stops the user or IP from joining and disconnects matching clients.
+func (m *Moderation) Ban(ctx context.Context, a Action) (store.Sanction, error) {
+	if a.Username == "" && a.IP == "" {
+		return store.Sanction{}, ErrNoTarget
+	}
+
+	s, err := m.sanction(ctx, store.SanctionBan, a)
+	if err != nil {
+		return s, err
+	}
+
+	clients := m.hub.clientsMatching(a.Room, func(c *Client) bool { return s.Applies(c.room, c.name(), c.ip) })
+	for _, c := range clients {
+		c.disconnect(withReason("you were banned", a.Reason))
+	}
+	slog.Info("ban issued", "room", a.Room, "username", a.Username, "ip", a.IP, "by", a.Actor,
+		"disconnected", len(clients))
+	return s, nil
+}
+
+// Mute lets the user keep reading while rejecting their messages.
+func (m *Moderation) Mute(ctx context.Context, a Action) (store.Sanction, error) {
+	if a.Username == "" {
+		return store.Sanction{}, ErrNoTarget
+	}
+
+	s, err := m.sanction(ctx, store.SanctionMute, a)
+	if err != nil {
+		return s, err
+	}
+
+	for _, c := range m.hub.clientsMatching(a.Room, func(c *Client) bool { return c.name() == a.Username }) {
+		c.sendError(withReason("you have been muted", a.Reason))
+	}
+	slog.Info("mute issued", "room", a.Room, "username", a.Username, "by", a.Actor)
+	return s, nil
+}
+
+// Lift removes a ban or mute before it expires.
+func (m *Moderation) Lift(ctx context.Context, actor, id string) (store.Sanction, error) {
+	var lifted store.Sanction
+	for _, s := range m.Active(ctx) {
+		if s.ID == id {
+			lifted = s
+		}
+	}
+	if lifted.ID == "" {
+		return lifted, store.ErrNotFound
+	}
+
+	if err := m.store.DeleteSanction(ctx, id); err != nil {
+		return lifted, err
+	}
+	action := "unban"
+	if lifted.Kind == store.SanctionMute {
+		action = "unmute"
+	}
+	a := Action{Actor: actor, Room: lifted.Room, Username: lifted.Username, IP: lifted.IP}
+	if err := m.audit(ctx, action, a, &lifted); err != nil {
+		return lifted, err
+	}
+
+	m.reload(ctx)
+	return lifted, nil
+}
+
+// Active returns the sanctions in force.
+func (m *Moderation) Active(ctx context.Context) []store.Sanction {
+	now := time.Now()
+	var active []store.Sanction
+	for _, s := range m.cached(ctx) {
+		if !s.Expired(now) {
+			active = append(active, s)
+		}
+	}
+	return active
+}
+
+// Audit returns the newest limit entries of the audit log.
+func (m *Moderation) Audit(ctx context.Context, limit int) ([]store.AuditEntry, error) {
+	return m.store.ListAudit(ctx, limit)
+}
+
+// banned returns the ban that stops username or ip from joining room.
+func (m *Moderation) banned(ctx context.Context, room, username, ip string) *store.Sanction {
+	return m.find(ctx, store.SanctionBan, room, username, ip)
+}
+
+// muted returns the mute that silences username in room.
+func (m *Moderation) muted(ctx context.Context, room, username string) *store.Sanction {
+	return m.find(ctx, store.SanctionMute, room, username, "")
+}
+
+func (m *Moderation) find(ctx context.Context, kind, room, username, ip string) *store.Sanction {
+	for _, s := range m.Active(ctx) {
+		if s.Kind == kind && s.Applies(room, username, ip) {
+			return &s
+		}
+	}
+	return nil
+}
+
+func (m *Moderation) sanction(ctx context.Context, kind string, a Action) (store.Sanction, error) {
+	now := time.Now().UTC()
+	s := store.Sanction{
+		ID:        newSessionID(),
+		Kind:      kind,
+		Room:      a.Room,
+		Username:  a.Username,
+		IP:        a.IP,
+		Reason:    a.Reason,
+		By:        a.Actor,
+		CreatedAt: now,
+	}
+	if a.Duration > 0 {
+		s.ExpiresAt = now.Add(a.Duration)
+	}
+
+	if err := m.store.PutSanction(ctx, s); err != nil {
+		return s, err
+	}
+	if err := m.audit(ctx, kind, a, &s); err != nil {
+		return s, err
+	}
+
+	m.mu.Lock()
+	m.sanctions = append(m.sanctions, s)
+	m.mu.Unlock()
+	return s, nil
+}
+
+func (m *Moderation) audit(ctx context.Context, action string, a Action, s *store.Sanction) error {
+	e := store.AuditEntry{
+		Action:   action,
+		Actor:    a.Actor,
+		Room:     a.Room,
+		Username: a.Username,
+		IP:       a.IP,
+		Reason:   a.Reason,
+		At:       time.Now().UTC(),
+	}
+	if s != nil {
+		e.Sanction = s.ID
+		e.ExpiresAt = s.ExpiresAt
+	}
+	if err := m.store.AppendAudit(ctx, e); err != nil {
+		return err
+	}
+	if w := m.hub.webhooks; w != nil {
+		w.Publish(webhook.Event{Type: store.EventModeration, Room: e.Room, Data: e})
+	}
+	return nil
+}
+
+func (m *Moderation) cached(ctx context.Context) []store.Sanction {
+	m.mu.RLock()
+	sanctions, fresh := m.sanctions, time.Since(m.loaded) < m.refresh
+	m.mu.RUnlock()
+
+	if fresh {
+		return sanctions
+	}
+	if err := m.reload(ctx); err != nil {
+		slog.Warn("failed to reload sanctions, using cached sanctions", "error", err)
+		return sanctions
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.sanctions
+}
+
+func (m *Moderation) reload(ctx context.Context) error {
+	sanctions, err := m.store.ListSanctions(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.sanctions = sanctions
+	m.loaded = time.Now()
+	m.mu.Unlock()
+	return nil
+}
+
+// clientsMatching returns the connected clients of room, or of every room
+// when room is empty, for which match returns true.
+func (h *Hub) clientsMatching(room string, match func(*Client) bool) []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var matched []*Client
+	for name, clients := range h.rooms {
+		if room != "" && name != room {
+			continue
+		}
+		for c := range clients {
+			if match(c) {
+				matched = append(matched, c)
+			}
+		}
+	}
+	return matched
+}
+
+// disconnect closes the client's connection with reason. WebSocket clients
+// receive it in the close frame; long-poll clients as an error message
+// before their session ends. The session ends at once, so that it cannot
+// be used to post before the hub unregisters the client.
+func (c *Client) disconnect(reason string) {
+	if c.conn == nil {
+		if c.poll != nil {
+			c.poll.end(c.notice("error", reason))
+		} else {
+			c.sendError(reason)
+		}
+		c.hub.unregister <- c
+		return
+	}
+
+	if len(reason) > 120 {
+		reason = reason[:120]
+	}
+	msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason)
+	c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
+	c.conn.Close()
+}
+
+func withReason(notice, reason string) string {
+	if reason == "" {
+		return notice
+	}
+	return notice + ": " + reason
+}
+
+// sanctionNotice tells a sanctioned user why and until when.
+func sanctionNotice(notice string, s *store.Sanction) string {
+	if s.Room != "" {
+		notice += " from " + s.Room
+	}
+	if !s.ExpiresAt.IsZero() {
+		notice += " until " + s.ExpiresAt.Format(time.RFC3339)
+	}
+	return withReason(notice, s.Reason)
+}
@@ -0,0 +1,202 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/config"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/gorilla/websocket"
+)
+
+func newModeratedServer(t *testing.T) (*Hub, *Moderation, *store.MemoryStore, *httptest.Server) {
+	t.Helper()
+	InitClient(&config.Config{MaxMessageSize: 4096, AllowedOrigins: []string{"*"}})
+
+	hub := NewHub(store.NewNoOpStore())
+	s := store.NewMemoryStore()
+	mod := NewModeration(hub, s)
+	hub.SetModeration(mod)
+	go hub.Run()
+
+	server := httptest.NewServer(loginHandler(func(w http.ResponseWriter, r *http.Request) {
+		ServeWs(hub, w, r)
+	}))
+	t.Cleanup(server.Close)
+	return hub, mod, s, server
+}
+
+// loginHandler stands in for Auth in tests: ?login=name authenticates the
+// request as the user name, whose room roles then apply.
+func loginHandler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if name := r.URL.Query().Get("login"); name != "" {
+			r = r.WithContext(middleware.WithIdentity(r.Context(), &middleware.Identity{Username: name}))
+		}
+		next(w, r)
+	}
+}
+
+// waitForClients waits until room has n registered clients.
+func waitForClients(t *testing.T, hub *Hub, room string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.GetClientCount(room) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d clients in %s, got %d", n, room, hub.GetClientCount(room))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// readUntil reads JSON messages until one has the given type.
+func readUntil(t *testing.T, conn *websocket.Conn, typ string) Message {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for %q: %v", typ, err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			var msg Message
+			if json.Unmarshal([]byte(line), &msg) == nil && msg.Type == typ {
+				return msg
+			}
+		}
+	}
+}
+
+func TestModeration_KickClosesConnection(t *testing.T) {
+	hub, mod, s, server := newModeratedServer(t)
+
+	conn := dialChat(t, server, "room=lobby&username=troll")
+	defer conn.Close()
+	waitForClients(t, hub, "lobby", 1)
+
+	n, err := mod.Kick(context.Background(), Action{Actor: "alice", Room: "lobby", Username: "troll", Reason: "spam"})
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 kicked connection, got %d (err %v)", n, err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err = conn.ReadMessage()
+		if err != nil {
+			break
+		}
+	}
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation ||
+		!strings.Contains(closeErr.Text, "spam") {
+		t.Errorf("expected policy-violation close with reason, got %v", err)
+	}
+
+	entries, _ := s.ListAudit(context.Background(), 10)
+	if len(entries) != 1 || entries[0].Action != "kick" || entries[0].Actor != "alice" {
+		t.Errorf("unexpected audit log %+v", entries)
+	}
+}
+
+func TestModeration_BanRejectsReconnect(t *testing.T) {
+	hub, mod, s, server := newModeratedServer(t)
+	ctx := context.Background()
+
+	conn := dialChat(t, server, "room=lobby&username=troll")
+	defer conn.Close()
+	waitForClients(t, hub, "lobby", 1)
+
+	ban, err := mod.Ban(ctx, Action{Actor: "alice", Room: "lobby", Username: "troll", Duration: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForClients(t, hub, "lobby", 0)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?room=lobby&username=troll"
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for banned user, got %v", err)
+	}
+
+	// The ban is scoped to the room
+	other := dialChat(t, server, "room=elsewhere&username=troll")
+	other.Close()
+
+	if _, err := mod.Lift(ctx, "alice", ban.ID); err != nil {
+		t.Fatalf("Lift failed: %v", err)
+	}
+	again := dialChat(t, server, "room=lobby&username=troll")
+	again.Close()
+
+	entries, _ := s.ListAudit(ctx, 10)
+	if len(entries) != 2 || entries[0].Action != "ban" || entries[1].Action != "unban" {
+		t.Errorf("unexpected audit log %+v", entries)
+	}
+}
+
+func TestModeration_BanEndsLongPollSession(t *testing.T) {
+	hub, mod, _, _ := newModeratedServer(t)
+	lp := NewLongPoll(hub)
+
+	resp := doPoll(t, lp, "/poll?room=lobby&username=troll")
+	waitForClients(t, hub, "lobby", 1)
+
+	if _, err := mod.Ban(context.Background(), Action{Actor: "alice", Room: "lobby", Username: "troll"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Refused at once, not only after the hub unregistered the client
+	for _, method := range []string{"POST", "GET"} {
+		req := httptest.NewRequest(method, "/poll?session="+resp.Session, strings.NewReader(`{"content":"still here"}`))
+		rec := httptest.NewRecorder()
+		lp.ServeHTTP(rec, req)
+		if rec.Code != http.StatusGone {
+			t.Errorf("%s: expected 410 after the ban, got %d", method, rec.Code)
+		}
+	}
+	waitForClients(t, hub, "lobby", 0)
+}
+
+func TestModeration_GlobalIPBan(t *testing.T) {
+	_, mod, _, server := newModeratedServer(t)
+
+	mod.Ban(context.Background(), Action{Actor: "admin", IP: "127.0.0.1"})
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?room=anywhere&username=newname"
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for banned IP, got %v", err)
+	}
+}
+
+func TestModeration_MuteRejectsWrites(t *testing.T) {
+	hub, mod, _, server := newModeratedServer(t)
+
+	conn := dialChat(t, server, "room=lobby&username=loud")
+	defer conn.Close()
+	waitForClients(t, hub, "lobby", 1)
+
+	if _, err := mod.Mute(context.Background(), Action{Actor: "alice", Room: "lobby", Username: "loud"}); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, conn, "error")
+
+	conn.WriteJSON(Message{Content: "can you hear me?"})
+	notice := readUntil(t, conn, "error")
+	if !strings.Contains(notice.Content, "muted") {
+		t.Errorf("expected a mute notice, got %q", notice.Content)
+	}
+
+	// Muted users keep receiving the room
+	hub.BroadcastMessage(Message{Type: "message", Username: "alice", Content: "hi", Room: "lobby"})
+	if msg := readUntil(t, conn, "message"); msg.Username != "alice" {
+		t.Errorf("expected alice's message, got %+v", msg)
+	}
+}
@@ -0,0 +1,62 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing_ReceiveLinkedToPersistAndDelivery(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	hub, _, _, server := newModeratedServer(t)
+	alice := dialChat(t, server, "room=lobby&username=alice")
+	defer alice.Close()
+	bob := dialChat(t, server, "room=lobby&username=bob")
+	defer bob.Close()
+	waitForClients(t, hub, "lobby", 2)
+
+	// A traceparent sent by the client is linked, not used as parent
+	const clientParent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	if err := alice.WriteJSON(Message{Content: "hello", Trace: clientParent}); err != nil {
+		t.Fatal(err)
+	}
+	got := readUntil(t, bob, "message")
+	if got.Trace == "" || got.Trace == clientParent {
+		t.Fatalf("expected the server's traceparent, got %q", got.Trace)
+	}
+
+	var receive, persist sdktrace.ReadOnlySpan
+	deadline := time.Now().Add(2 * time.Second)
+	for (receive == nil || persist == nil) && time.Now().Before(deadline) {
+		for _, span := range recorder.Ended() {
+			switch {
+			case span.Name() == "chat.receive":
+				receive = span
+			case span.Name() == "chat.persist" && receive != nil && span.Parent().SpanID() == receive.SpanContext().SpanID():
+				persist = span
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if receive == nil || persist == nil {
+		t.Fatalf("expected receive and persist spans, got receive=%v persist=%v", receive != nil, persist != nil)
+	}
+
+	if want := "00-" + receive.SpanContext().TraceID().String() + "-" + receive.SpanContext().SpanID().String() + "-01"; got.Trace != want {
+		t.Errorf("delivered traceparent %q, want %q", got.Trace, want)
+	}
+	if links := receive.Links(); len(links) != 1 || links[0].SpanContext.TraceID().String() != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("expected a link to the client's span, got %+v", links)
+	}
+	if receive.Parent().IsValid() || receive.SpanKind() != trace.SpanKindConsumer {
+		t.Error("the receive span should start a trace")
+	}
+}
@@ -1,74 +1,326 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/netip"
 	"os"
 	"strconv"
-	"strings"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/origin"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/tlsconfig"
 )
 
 type Config struct {
+	File           string // the CONFIG_FILE that was read, if any
 	Port           string
 	AllowedOrigins []string
+	TrustedProxies []string // CIDRs or IPs whose proxy headers are believed
+	NetworkAllow   []string // CIDRs or IPs; when set, only these may connect
+	NetworkDeny    []string // CIDRs or IPs that may never connect
 	RedisURL       string
-	AuthToken      string
-	RateLimit      int
-	MaxMessageSize int64
-	MessageTTL     int // hours
-	MaxMessages    int // per room
+	AuthToken      string // shared by chat clients; may read and write
+	AdminToken     string // bootstrap admin credential for /admin and API keys
+	APIKeysStore   string // "file", "redis" or "memory"; empty disables API keys
+	APIKeysFile    string
+	JWTSecret      string // HS256 signing secret
+	JWTJWKSFile    string // local JWKS file with RS256/ES256 keys
+	JWTIssuer      string
+	JWTAudience    string
+
+	OIDCIssuer           string
+	OIDCClientID         string
+	OIDCClientSecret     string
+	OIDCRedirectURL      string
+	SessionSecret        string
+	SessionTTL           int // hours
+	InviteSecret         string
+	RateLimit            int // API requests per minute
+	RateLimitBurst       int
+	WSRateLimit          int // WebSocket and long-poll requests per minute
+	WSRateLimitBurst     int
+	StaticRateLimit      int // static file requests per minute
+	StaticRateLimitBurst int
+	RateLimitStore       string // "memory" or "redis", which shares buckets between replicas
+	MaxMessageSize       int64
+	MessageTTL           int // hours
+	MaxMessages          int // per room
+
+	MessageRateLimit          int // chat messages per minute per connection; 0 disables
+	MessageRateLimitBurst     int
+	UserMessageRateLimit      int // chat messages per minute per user across connections; 0 disables
+	UserMessageRateLimitBurst int
+	FloodWarnings             int // warnings before a flooding client is muted
+	FloodMuteDuration         int // seconds
+
+	CompressionLevel     int // 0 disables permessage-deflate
+	CompressionThreshold int // bytes; smaller frames are sent uncompressed
+	WriteBatchSize       int // max queued messages written at once, in one frame for chat.v1.json-batch
+
+	TracesExporter string // "otlp", "stdout" or "none"
+	MetricsPort    string // serves /metrics on its own port, e.g. for private networking; empty serves it on Port to admins
+
+	MaxConnections        int // across every room; 0 means unlimited
+	MaxConnectionsPerIP   int // 0 means unlimited
+	MaxConnectionsPerUser int // per logged-in user; 0 means unlimited
+	DrainDelay            int // seconds between failing readiness and shutting down
+
+	TLSCertFile      string // serves HTTPS on Port when set, with TLSKeyFile
+	TLSKeyFile       string
+	TLSMinVersion    string   // "1.0" to "1.3"
+	TLSCipherSuites  []string // crypto/tls names, for TLS 1.2 and below; empty keeps Go's defaults
+	TLSClientCAFile  string   // CA bundle that signs client certificates
+	TLSClientAuth    string   // "none", "optional" or "require"
+	HTTPRedirectPort string   // plain HTTP port redirecting to HTTPS; empty disables
 }
 
-func Load() *Config {
+// Load reads the configuration from the environment and, when
+// CONFIG_FILE names one, from a YAML or TOML file whose keys are the
+// variable names in any case. Environment variables override the file.
+// Every invalid value is reported, joined into one error.
+func Load() (*Config, error) {
+	src, err := newSource(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return nil, err
+	}
+
 	cfg := &Config{
-		Port:           getEnv("PORT", "8080"),
-		RedisURL:       os.Getenv("REDIS_URL"),
-		AuthToken:      os.Getenv("AUTH_TOKEN"),
-		RateLimit:      getEnvInt("RATE_LIMIT", 60),
-		MaxMessageSize: int64(getEnvInt("MAX_MESSAGE_SIZE", 4096)),
-		MessageTTL:     getEnvInt("MESSAGE_TTL_HOURS", 24),
-		MaxMessages:    getEnvInt("MAX_MESSAGES_PER_ROOM", 100),
-	}
-
-	originsStr := getEnv("ALLOWED_ORIGINS", "*")
-	if originsStr == "*" {
-		cfg.AllowedOrigins = []string{"*"}
-	} else {
-		cfg.AllowedOrigins = strings.Split(originsStr, ",")
-		for i, origin := range cfg.AllowedOrigins {
-			cfg.AllowedOrigins[i] = strings.TrimSpace(origin)
-		}
+		File:         src.path,
+		Port:         src.get("PORT", "8080"),
+		RedisURL:     src.get("REDIS_URL", ""),
+		AuthToken:    src.get("AUTH_TOKEN", ""),
+		AdminToken:   src.get("ADMIN_TOKEN", ""),
+		APIKeysStore: src.get("API_KEYS_STORE", ""),
+		APIKeysFile:  src.get("API_KEYS_FILE", ""),
+		JWTSecret:    src.get("JWT_SECRET", ""),
+		JWTJWKSFile:  src.get("JWT_JWKS_FILE", ""),
+		JWTIssuer:    src.get("JWT_ISSUER", ""),
+		JWTAudience:  src.get("JWT_AUDIENCE", ""),
+
+		OIDCIssuer:           src.get("OIDC_ISSUER", ""),
+		OIDCClientID:         src.get("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:     src.get("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:      src.get("OIDC_REDIRECT_URL", ""),
+		SessionSecret:        src.get("SESSION_SECRET", ""),
+		SessionTTL:           src.getInt("SESSION_TTL_HOURS", 12),
+		InviteSecret:         src.get("INVITE_SECRET", ""),
+		RateLimit:            src.getInt("RATE_LIMIT", 60),
+		WSRateLimit:          src.getInt("RATE_LIMIT_WS", 30),
+		WSRateLimitBurst:     src.getInt("RATE_LIMIT_WS_BURST", 10),
+		StaticRateLimit:      src.getInt("RATE_LIMIT_STATIC", 600),
+		StaticRateLimitBurst: src.getInt("RATE_LIMIT_STATIC_BURST", 100),
+		RateLimitStore:       src.get("RATE_LIMIT_STORE", "memory"),
+		MaxMessageSize:       int64(src.getInt("MAX_MESSAGE_SIZE", 4096)),
+		MessageTTL:           src.getInt("MESSAGE_TTL_HOURS", 24),
+		MaxMessages:          src.getInt("MAX_MESSAGES_PER_ROOM", 100),
+
+		MessageRateLimit:          src.getInt("RATE_LIMIT_MESSAGES", 30),
+		MessageRateLimitBurst:     src.getInt("RATE_LIMIT_MESSAGES_BURST", 10),
+		UserMessageRateLimit:      src.getInt("RATE_LIMIT_USER_MESSAGES", 60),
+		UserMessageRateLimitBurst: src.getInt("RATE_LIMIT_USER_MESSAGES_BURST", 20),
+		FloodWarnings:             src.getInt("FLOOD_WARNINGS", 2),
+		FloodMuteDuration:         src.getInt("FLOOD_MUTE_SECONDS", 300),
+
+		CompressionLevel:     src.getInt("WS_COMPRESSION_LEVEL", 1),
+		CompressionThreshold: src.getInt("WS_COMPRESSION_THRESHOLD", 512),
+		WriteBatchSize:       src.getInt("WS_WRITE_BATCH", 32),
+
+		TracesExporter: src.get("OTEL_TRACES_EXPORTER", "none"),
+		MetricsPort:    src.get("METRICS_PORT", ""),
+
+		MaxConnections:        src.getInt("MAX_CONNECTIONS", 0),
+		MaxConnectionsPerIP:   src.getInt("MAX_CONNECTIONS_PER_IP", 0),
+		MaxConnectionsPerUser: src.getInt("MAX_CONNECTIONS_PER_USER", 0),
+		DrainDelay:            src.getInt("DRAIN_DELAY_SECONDS", 5),
+
+		TLSCertFile:      src.get("TLS_CERT_FILE", ""),
+		TLSKeyFile:       src.get("TLS_KEY_FILE", ""),
+		TLSMinVersion:    src.get("TLS_MIN_VERSION", "1.2"),
+		TLSCipherSuites:  src.getList("TLS_CIPHER_SUITES", nil),
+		TLSClientCAFile:  src.get("TLS_CLIENT_CA_FILE", ""),
+		TLSClientAuth:    src.get("TLS_CLIENT_AUTH", ""),
+		HTTPRedirectPort: src.get("HTTP_REDIRECT_PORT", ""),
+
+		AllowedOrigins: src.getList("ALLOWED_ORIGINS", []string{"*"}),
+		TrustedProxies: src.getList("TRUSTED_PROXIES", nil),
+		NetworkAllow:   src.getList("NETWORK_ALLOW", nil),
+		NetworkDeny:    src.getList("NETWORK_DENY", nil),
 	}
 
-	return cfg
-}
+	cfg.RateLimitBurst = src.getInt("RATE_LIMIT_BURST", cfg.RateLimit)
 
-func (c *Config) IsOriginAllowed(origin string) bool {
-	if len(c.AllowedOrigins) == 1 && c.AllowedOrigins[0] == "*" {
-		return true
+	if cfg.APIKeysStore == "" {
+		if cfg.APIKeysFile != "" {
+			cfg.APIKeysStore = "file"
+		} else if cfg.AdminToken != "" {
+			cfg.APIKeysStore = "memory"
+		}
 	}
-	for _, allowed := range c.AllowedOrigins {
-		if allowed == origin {
-			return true
+
+	if cfg.TLSClientAuth == "" {
+		if cfg.TLSClientCAFile != "" {
+			cfg.TLSClientAuth = tlsconfig.ClientAuthRequire
+		} else {
+			cfg.TLSClientAuth = tlsconfig.ClientAuthNone
 		}
 	}
-	return false
+
+	if err := errors.Join(append(src.finish(), cfg.validate()...)...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// IsOriginAllowed matches origin against the allowed-origin patterns; see
+// package origin for their syntax.
+func (c *Config) IsOriginAllowed(o string) bool {
+	return origin.Allowed(c.AllowedOrigins, o)
+}
+
+func (c *Config) CompressionEnabled() bool {
+	return c.CompressionLevel != 0
+}
+
+func (c *Config) JWTEnabled() bool {
+	return c.JWTSecret != "" || c.JWTJWKSFile != ""
+}
+
+func (c *Config) OIDCEnabled() bool {
+	return c.OIDCIssuer != "" && c.OIDCClientID != ""
+}
+
+func (c *Config) APIKeysEnabled() bool {
+	return c.APIKeysStore != ""
+}
+
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != ""
 }
 
 func (c *Config) AuthEnabled() bool {
-	return c.AuthToken != ""
+	return c.AuthToken != "" || c.AdminToken != "" || c.APIKeysEnabled() || c.JWTEnabled() || c.OIDCEnabled()
 }
 
-func getEnv(key, defaultVal string) string {
-	if val := os.Getenv(key); val != "" {
-		return val
+// validate returns an error for every setting that is out of range or
+// cannot be used.
+func (c *Config) validate() []error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(validPort(c.Port), "PORT: %q is not a port number", c.Port)
+	check(c.AdminToken == "" || c.AdminToken != c.AuthToken, "ADMIN_TOKEN: must differ from AUTH_TOKEN, which every chat client holds")
+
+	positive := []struct {
+		key   string
+		value int
+	}{
+		{"SESSION_TTL_HOURS", c.SessionTTL},
+		{"RATE_LIMIT", c.RateLimit},
+		{"RATE_LIMIT_BURST", c.RateLimitBurst},
+		{"RATE_LIMIT_WS", c.WSRateLimit},
+		{"RATE_LIMIT_WS_BURST", c.WSRateLimitBurst},
+		{"RATE_LIMIT_STATIC", c.StaticRateLimit},
+		{"RATE_LIMIT_STATIC_BURST", c.StaticRateLimitBurst},
+		{"MAX_MESSAGE_SIZE", int(c.MaxMessageSize)},
+		{"MESSAGE_TTL_HOURS", c.MessageTTL},
+		{"MAX_MESSAGES_PER_ROOM", c.MaxMessages},
+		{"WS_WRITE_BATCH", c.WriteBatchSize},
+	}
+	for _, s := range positive {
+		check(s.value > 0, "%s: must be positive, got %d", s.key, s.value)
+	}
+
+	nonNegative := []struct {
+		key   string
+		value int
+	}{
+		{"RATE_LIMIT_MESSAGES", c.MessageRateLimit},
+		{"RATE_LIMIT_MESSAGES_BURST", c.MessageRateLimitBurst},
+		{"RATE_LIMIT_USER_MESSAGES", c.UserMessageRateLimit},
+		{"RATE_LIMIT_USER_MESSAGES_BURST", c.UserMessageRateLimitBurst},
+		{"FLOOD_WARNINGS", c.FloodWarnings},
+		{"FLOOD_MUTE_SECONDS", c.FloodMuteDuration},
+		{"WS_COMPRESSION_THRESHOLD", c.CompressionThreshold},
+		{"MAX_CONNECTIONS", c.MaxConnections},
+		{"MAX_CONNECTIONS_PER_IP", c.MaxConnectionsPerIP},
+		{"MAX_CONNECTIONS_PER_USER", c.MaxConnectionsPerUser},
+		{"DRAIN_DELAY_SECONDS", c.DrainDelay},
+	}
+	for _, s := range nonNegative {
+		check(s.value >= 0, "%s: must not be negative, got %d", s.key, s.value)
+	}
+
+	check(c.CompressionLevel >= -2 && c.CompressionLevel <= 9,
+		"WS_COMPRESSION_LEVEL: must be between -2 and 9, got %d", c.CompressionLevel)
+	check(c.RateLimitStore == "memory" || c.RateLimitStore == "redis",
+		"RATE_LIMIT_STORE: must be memory or redis, got %q", c.RateLimitStore)
+	check(c.RateLimitStore != "redis" || c.RedisURL != "",
+		"RATE_LIMIT_STORE: redis requires REDIS_URL")
+	switch c.APIKeysStore {
+	case "", "memory":
+	case "file":
+		check(c.APIKeysFile != "", "API_KEYS_STORE: file requires API_KEYS_FILE")
+	case "redis":
+		check(c.RedisURL != "", "API_KEYS_STORE: redis requires REDIS_URL")
+	default:
+		check(false, "API_KEYS_STORE: must be file, redis or memory, got %q", c.APIKeysStore)
+	}
+	switch c.TracesExporter {
+	case "otlp", "stdout", "none":
+	default:
+		check(false, "OTEL_TRACES_EXPORTER: must be otlp, stdout or none, got %q", c.TracesExporter)
 	}
-	return defaultVal
-}
 
-func getEnvInt(key string, defaultVal int) int {
-	if val := os.Getenv(key); val != "" {
-		if i, err := strconv.Atoi(val); err == nil {
-			return i
+	for _, pattern := range c.AllowedOrigins {
+		if err := origin.Validate(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("ALLOWED_ORIGINS: %w", err))
 		}
 	}
-	return defaultVal
+	for key, list := range map[string][]string{
+		"TRUSTED_PROXIES": c.TrustedProxies,
+		"NETWORK_ALLOW":   c.NetworkAllow,
+		"NETWORK_DENY":    c.NetworkDeny,
+	} {
+		for _, entry := range list {
+			if _, err := netip.ParsePrefix(entry); err == nil {
+				continue
+			}
+			if _, err := netip.ParseAddr(entry); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not an IP address or CIDR", key, entry))
+			}
+		}
+	}
+
+	check((c.TLSCertFile == "") == (c.TLSKeyFile == ""), "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	if _, err := tlsconfig.ParseVersion(c.TLSMinVersion); err != nil {
+		errs = append(errs, fmt.Errorf("TLS_MIN_VERSION: %w", err))
+	}
+	if _, err := tlsconfig.ParseCipherSuites(c.TLSCipherSuites); err != nil {
+		errs = append(errs, fmt.Errorf("TLS_CIPHER_SUITES: %w", err))
+	}
+	if _, err := tlsconfig.ParseClientAuth(c.TLSClientAuth); err != nil {
+		errs = append(errs, fmt.Errorf("TLS_CLIENT_AUTH: %w", err))
+	} else if c.TLSClientAuth != tlsconfig.ClientAuthNone {
+		check(c.TLSClientCAFile != "", "TLS_CLIENT_AUTH: %s requires TLS_CLIENT_CA_FILE", c.TLSClientAuth)
+		check(c.TLSEnabled(), "TLS_CLIENT_AUTH: client certificates require TLS_CERT_FILE")
+	}
+	if c.MetricsPort != "" {
+		check(validPort(c.MetricsPort) && c.MetricsPort != c.Port && c.MetricsPort != c.HTTPRedirectPort,
+			"METRICS_PORT: %q is not a port number other than PORT and HTTP_REDIRECT_PORT", c.MetricsPort)
+	}
+	if c.HTTPRedirectPort != "" {
+		check(c.TLSEnabled(), "HTTP_REDIRECT_PORT: redirecting to HTTPS requires TLS_CERT_FILE")
+		check(validPort(c.HTTPRedirectPort) && c.HTTPRedirectPort != c.Port,
+			"HTTP_REDIRECT_PORT: %q is not a port number other than PORT", c.HTTPRedirectPort)
+	}
+	return errs
+}
+
+func validPort(s string) bool {
+	port, err := strconv.Atoi(s)
+	return err == nil && port > 0 && port <= 65535
 }
@@ -2,6 +2,9 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -14,7 +17,10 @@ func TestLoad_Defaults(t *testing.T) {
 	os.Unsetenv("RATE_LIMIT")
 	os.Unsetenv("MAX_MESSAGE_SIZE")
 
-	cfg := Load()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
 
 	if cfg.Port != "8080" {
 		t.Errorf("expected default port 8080, got %s", cfg.Port)
@@ -46,7 +52,10 @@ func TestLoad_CustomValues(t *testing.T) {
 		os.Unsetenv("MAX_MESSAGE_SIZE")
 	}()
 
-	cfg := Load()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
 
 	if cfg.Port != "3000" {
 		t.Errorf("expected port 3000, got %s", cfg.Port)
@@ -110,3 +119,163 @@ func TestAuthEnabled(t *testing.T) {
 		t.Error("auth should be enabled when token is set")
 	}
 }
+
+func TestIsOriginAllowed_Patterns(t *testing.T) {
+	cfg := &Config{AllowedOrigins: []string{"https://*.up.railway.app", "http://localhost:*"}}
+
+	if !cfg.IsOriginAllowed("https://pr-42.up.railway.app") {
+		t.Error("expected preview deployments to be allowed")
+	}
+	if !cfg.IsOriginAllowed("http://localhost:5173") {
+		t.Error("expected any localhost port to be allowed")
+	}
+	if cfg.IsOriginAllowed("http://pr-42.up.railway.app") {
+		t.Error("expected the scheme to be enforced")
+	}
+}
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_YAMLFileWithEnvOverride(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, "chat.yaml", `
+port: 9000
+allowed_origins:
+  - https://example.com
+  - https://*.example.com
+RATE_LIMIT: 120
+max_connections_per_ip: 5
+`))
+	t.Setenv("RATE_LIMIT", "90")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Port != "9000" {
+		t.Errorf("expected port 9000 from the file, got %s", cfg.Port)
+	}
+	if !slices.Equal(cfg.AllowedOrigins, []string{"https://example.com", "https://*.example.com"}) {
+		t.Errorf("expected origins from the file, got %v", cfg.AllowedOrigins)
+	}
+	if cfg.RateLimit != 90 {
+		t.Errorf("expected the environment to override the file, got %d", cfg.RateLimit)
+	}
+	if cfg.RateLimitBurst != 90 {
+		t.Errorf("expected the burst to default to the rate limit, got %d", cfg.RateLimitBurst)
+	}
+	if cfg.MaxConnectionsPerIP != 5 {
+		t.Errorf("expected 5 connections per IP, got %d", cfg.MaxConnectionsPerIP)
+	}
+}
+
+func TestLoad_TOMLFile(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, "chat.toml", `
+port = "9001"
+allowed_origins = "https://a.example.com, https://b.example.com"
+max_message_size = 8192
+`))
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Port != "9001" || cfg.MaxMessageSize != 8192 || len(cfg.AllowedOrigins) != 2 {
+		t.Errorf("unexpected configuration %+v", cfg)
+	}
+}
+
+func TestLoad_ReportsEveryInvalidValue(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, "chat.yaml", `
+rate_limt: 10
+network_deny: [10.0.0.0/33]
+`))
+	t.Setenv("PORT", "70000")
+	t.Setenv("RATE_LIMIT_WS", "fast")
+	t.Setenv("RATE_LIMIT_STORE", "disk")
+	t.Setenv("ALLOWED_ORIGINS", "https://*example.com")
+	t.Setenv("METRICS_PORT", "metrics")
+
+	cfg, err := Load()
+	if err == nil {
+		t.Fatalf("expected an error, got %+v", cfg)
+	}
+	for _, want := range []string{
+		"PORT", "RATE_LIMIT_WS", "RATE_LIMIT_STORE", "ALLOWED_ORIGINS", "NETWORK_DENY", "METRICS_PORT",
+		"unknown setting rate_limt",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to mention %s, got:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoad_RejectsUnknownFileFormat(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, "chat.ini", "port=1"))
+	if _, err := Load(); err == nil {
+		t.Error("expected an error for an .ini file")
+	}
+}
+
+func TestReload(t *testing.T) {
+	cur := &Config{Port: "8080", AuthToken: "old", RateLimit: 60, AllowedOrigins: []string{"*"}}
+	next := &Config{Port: "9090", AuthToken: "new", RateLimit: 10, AllowedOrigins: []string{"https://example.com"}}
+
+	merged, restart := cur.Reload(next)
+	if merged.RateLimit != 10 || merged.AuthToken != "new" || merged.AllowedOrigins[0] != "https://example.com" {
+		t.Errorf("expected reloadable settings to be applied, got %+v", merged)
+	}
+	if merged.Port != "8080" {
+		t.Errorf("expected the port to need a restart, got %s", merged.Port)
+	}
+	if !slices.Equal(restart, []string{"Port"}) {
+		t.Errorf("expected only Port to need a restart, got %v", restart)
+	}
+	if cur.RateLimit != 60 {
+		t.Error("Reload must not modify the current configuration")
+	}
+
+	// Turning authentication off needs a restart
+	_, restart = cur.Reload(&Config{Port: "8080", RateLimit: 60, AllowedOrigins: []string{"*"}})
+	if !slices.Equal(restart, []string{"AuthToken"}) {
+		t.Errorf("expected removing AUTH_TOKEN to need a restart, got %v", restart)
+	}
+}
+
+func TestLoad_TLS(t *testing.T) {
+	t.Setenv("TLS_CERT_FILE", "/etc/chat/tls.crt")
+	t.Setenv("TLS_KEY_FILE", "/etc/chat/tls.key")
+	t.Setenv("TLS_CLIENT_CA_FILE", "/etc/chat/clients.crt")
+	t.Setenv("HTTP_REDIRECT_PORT", "8081")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !cfg.TLSEnabled() || cfg.TLSMinVersion != "1.2" {
+		t.Errorf("expected TLS 1.2 and above, got %+v", cfg)
+	}
+	if cfg.TLSClientAuth != "require" {
+		t.Errorf("expected a client CA to require client certificates, got %q", cfg.TLSClientAuth)
+	}
+
+	t.Setenv("TLS_KEY_FILE", "")
+	t.Setenv("TLS_MIN_VERSION", "1.4")
+	t.Setenv("TLS_CIPHER_SUITES", "TLS_RSA_WITH_RC4_128_SHA")
+	t.Setenv("HTTP_REDIRECT_PORT", "8080")
+	_, err = Load()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"TLS_KEY_FILE", "TLS_MIN_VERSION", "TLS_CIPHER_SUITES", "HTTP_REDIRECT_PORT"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to mention %s, got:\n%v", want, err)
+		}
+	}
+}
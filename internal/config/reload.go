@@ -0,0 +1,64 @@
+package config
+
+import "reflect"
+
+// reloadable lists the settings that can change while serving, without
+// dropping connections.
+var reloadable = map[string]bool{
+	"AllowedOrigins": true,
+	"NetworkAllow":   true,
+	"NetworkDeny":    true,
+
+	"RateLimit":                 true,
+	"RateLimitBurst":            true,
+	"WSRateLimit":               true,
+	"WSRateLimitBurst":          true,
+	"StaticRateLimit":           true,
+	"StaticRateLimitBurst":      true,
+	"MessageRateLimit":          true,
+	"MessageRateLimitBurst":     true,
+	"UserMessageRateLimit":      true,
+	"UserMessageRateLimitBurst": true,
+	"FloodWarnings":             true,
+	"FloodMuteDuration":         true,
+
+	"MaxMessageSize":        true,
+	"MaxConnections":        true,
+	"MaxConnectionsPerIP":   true,
+	"MaxConnectionsPerUser": true,
+}
+
+// Reload merges next, freshly loaded, into c: it returns a copy of c with
+// the reloadable settings of next, and the names of the other settings
+// that differ, which only take effect after a restart.
+func (c *Config) Reload(next *Config) (*Config, []string) {
+	merged := *c
+	var restart []string
+
+	cur, nxt, out := reflect.ValueOf(c).Elem(), reflect.ValueOf(next).Elem(), reflect.ValueOf(&merged).Elem()
+	for i := 0; i < cur.NumField(); i++ {
+		if reflect.DeepEqual(cur.Field(i).Interface(), nxt.Field(i).Interface()) {
+			continue
+		}
+		name := cur.Type().Field(i).Name
+		if c.canReload(name, next) {
+			out.Field(i).Set(nxt.Field(i))
+		} else {
+			restart = append(restart, name)
+		}
+	}
+	return &merged, restart
+}
+
+// canReload reports whether the setting name can change from c to next.
+// Credentials can be rotated, but adding or removing them turns an
+// authenticator on or off, which needs a restart.
+func (c *Config) canReload(name string, next *Config) bool {
+	switch name {
+	case "AuthToken":
+		return c.AuthToken != "" && next.AuthToken != ""
+	case "JWTSecret", "JWTJWKSFile", "JWTIssuer", "JWTAudience":
+		return c.JWTEnabled() && next.JWTEnabled()
+	}
+	return reloadable[name]
+}
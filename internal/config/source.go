@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// source looks settings up in the environment, then in the config file,
+// and collects the values that fail to parse instead of ignoring them.
+type source struct {
+	path string
+	file map[string]string // setting name -> value, formatted like the variable
+	used map[string]bool   // settings that were looked up
+	errs []error
+}
+
+// newSource reads the config file at path, if any. Keys are the names of
+// the environment variables, in any case; lists may be arrays or
+// comma-separated strings.
+func newSource(path string) (*source, error) {
+	s := &source{path: path, file: make(map[string]string), used: make(map[string]bool)}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+	raw := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		_, err = toml.Decode(string(data), &raw)
+	default:
+		return nil, fmt.Errorf("config file %s: unknown format, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	for key, value := range raw {
+		v, err := formatValue(value)
+		if err != nil {
+			s.errs = append(s.errs, fmt.Errorf("config file: %s: %w", key, err))
+			continue
+		}
+		s.file[strings.ToUpper(key)] = v
+	}
+	return s, nil
+}
+
+// formatValue formats a value from the file the way it would be written
+// in the environment.
+func formatValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := formatValue(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", fmt.Errorf("nested settings are not supported")
+}
+
+func (s *source) lookup(key string) (string, bool) {
+	s.used[key] = true
+	if v := os.Getenv(key); v != "" {
+		return v, true
+	}
+	v, ok := s.file[key]
+	return v, ok && v != ""
+}
+
+func (s *source) get(key, defaultVal string) string {
+	if v, ok := s.lookup(key); ok {
+		return v
+	}
+	return defaultVal
+}
+
+func (s *source) getInt(key string, defaultVal int) int {
+	v, ok := s.lookup(key)
+	if !ok {
+		return defaultVal
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: %q is not an integer", key, v))
+		return defaultVal
+	}
+	return i
+}
+
+// getList splits a comma-separated setting, dropping empty entries.
+func (s *source) getList(key string, defaultVal []string) []string {
+	v, ok := s.lookup(key)
+	if !ok {
+		return defaultVal
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// finish returns the parse errors and an error for every setting of the
+// file that was never looked up, which is most likely misspelled.
+func (s *source) finish() []error {
+	errs := s.errs
+	var unknown []string
+	for key := range s.file {
+		if !s.used[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		errs = append(errs, fmt.Errorf("config file: unknown setting %s", strings.ToLower(key)))
+	}
+	return errs
+}
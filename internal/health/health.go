@@ -0,0 +1,163 @@
+// Package health serves the liveness and readiness probes used by
+// orchestrators. Liveness means the process should not be restarted;
+// readiness means it should receive traffic.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CheckTimeout bounds each check, so that a hung dependency fails its
+// check instead of hanging the probe.
+const CheckTimeout = 2 * time.Second
+
+var ErrDraining = errors.New("server is draining")
+
+// Check reports an unhealthy dependency by returning an error.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs the liveness and readiness checks.
+type Checker struct {
+	mu       sync.RWMutex
+	live     []namedCheck
+	ready    []namedCheck
+	draining atomic.Bool
+	timeout  time.Duration
+}
+
+func NewChecker() *Checker {
+	c := &Checker{timeout: CheckTimeout}
+	c.AddReadiness("draining", func(context.Context) error {
+		if c.draining.Load() {
+			return ErrDraining
+		}
+		return nil
+	})
+	return c
+}
+
+// AddLiveness adds a check that fails /livez, and /readyz, which a server
+// that is not alive cannot be.
+func (c *Checker) AddLiveness(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.live = append(c.live, namedCheck{name, check})
+}
+
+// AddReadiness adds a check that fails /readyz only.
+func (c *Checker) AddReadiness(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ready = append(c.ready, namedCheck{name, check})
+}
+
+// Drain fails readiness from now on so that load balancers stop sending
+// new connections before the server shuts down.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+func (c *Checker) Draining() bool {
+	return c.draining.Load()
+}
+
+// CheckResult is the outcome of one check.
+type CheckResult struct {
+	Status   string  `json:"status"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_ms"`
+}
+
+// Report is the body of both probes.
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Live runs the liveness checks.
+func (c *Checker) Live(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := append([]namedCheck(nil), c.live...)
+	c.mu.RUnlock()
+	return run(ctx, checks, c.timeout)
+}
+
+// Ready runs the liveness and readiness checks.
+func (c *Checker) Ready(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := append(append([]namedCheck(nil), c.live...), c.ready...)
+	c.mu.RUnlock()
+	return run(ctx, checks, c.timeout)
+}
+
+// run runs checks concurrently, each with its own timeout.
+func run(ctx context.Context, checks []namedCheck, timeout time.Duration) Report {
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	results := make([]CheckResult, len(checks))
+
+	var wg sync.WaitGroup
+	for i, nc := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := nc.check(ctx)
+			results[i] = CheckResult{Status: StatusOK, Duration: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				results[i].Status = StatusFail
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, nc := range checks {
+		report.Checks[nc.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+// Livez serves the liveness probe: 200 when every liveness check passes
+// and 503 otherwise.
+func (c *Checker) Livez(w http.ResponseWriter, r *http.Request) {
+	write(w, c.Live(r.Context()))
+}
+
+// Readyz serves the readiness probe: 200 when every check passes and 503
+// otherwise, including while draining.
+func (c *Checker) Readyz(w http.ResponseWriter, r *http.Request) {
+	write(w, c.Ready(r.Context()))
+}
+
+func write(w http.ResponseWriter, report Report) {
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,92 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func probe(t *testing.T, handler http.HandlerFunc) (int, Report) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/", nil))
+
+	var report Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("invalid report: %v", err)
+	}
+	return rec.Code, report
+}
+
+func TestChecker_Healthy(t *testing.T) {
+	c := NewChecker()
+	c.AddLiveness("hub", func(context.Context) error { return nil })
+	c.AddReadiness("store", func(context.Context) error { return nil })
+
+	code, report := probe(t, c.Livez)
+	if code != http.StatusOK || report.Status != StatusOK || len(report.Checks) != 1 {
+		t.Errorf("unexpected liveness %d %+v", code, report)
+	}
+
+	code, report = probe(t, c.Readyz)
+	if code != http.StatusOK || report.Status != StatusOK {
+		t.Errorf("unexpected readiness %d %+v", code, report)
+	}
+	for _, name := range []string{"hub", "store", "draining"} {
+		if report.Checks[name].Status != StatusOK {
+			t.Errorf("expected %s to pass, got %+v", name, report.Checks[name])
+		}
+	}
+}
+
+func TestChecker_FailingReadiness(t *testing.T) {
+	c := NewChecker()
+	c.AddLiveness("hub", func(context.Context) error { return nil })
+	c.AddReadiness("store", func(context.Context) error { return errors.New("connection refused") })
+
+	code, report := probe(t, c.Readyz)
+	if code != http.StatusServiceUnavailable || report.Status != StatusFail {
+		t.Errorf("expected 503, got %d %+v", code, report)
+	}
+	if got := report.Checks["store"]; got.Status != StatusFail || got.Error != "connection refused" {
+		t.Errorf("unexpected store result %+v", got)
+	}
+
+	// A dependency outage does not make the process unhealthy
+	if code, _ := probe(t, c.Livez); code != http.StatusOK {
+		t.Errorf("expected liveness to pass, got %d", code)
+	}
+}
+
+func TestChecker_FailingLivenessFailsReadiness(t *testing.T) {
+	c := NewChecker()
+	c.timeout = 10 * time.Millisecond
+	c.AddLiveness("hub", func(ctx context.Context) error {
+		<-ctx.Done() // a stuck hub loop
+		return ctx.Err()
+	})
+
+	if code, _ := probe(t, c.Livez); code != http.StatusServiceUnavailable {
+		t.Errorf("expected liveness to fail, got %d", code)
+	}
+	if code, report := probe(t, c.Readyz); code != http.StatusServiceUnavailable || report.Checks["hub"].Status != StatusFail {
+		t.Errorf("expected readiness to fail, got %d %+v", code, report)
+	}
+}
+
+func TestChecker_Drain(t *testing.T) {
+	c := NewChecker()
+	c.Drain()
+
+	code, report := probe(t, c.Readyz)
+	if code != http.StatusServiceUnavailable || report.Checks["draining"].Error != ErrDraining.Error() {
+		t.Errorf("expected draining to fail readiness, got %d %+v", code, report)
+	}
+	if code, _ := probe(t, c.Livez); code != http.StatusOK {
+		t.Errorf("draining should not fail liveness, got %d", code)
+	}
+}
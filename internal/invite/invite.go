@@ -0,0 +1,145 @@
+// Package invite mints and redeems room invite links. A link carries an
+// HMAC-signed token naming the invite, its room and expiry; the use count
+// and revocation state live in the store so that a leaked link can be shut
+// off.
+package invite
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+)
+
+var ErrInvalid = errors.New("invalid invite")
+
+// Claims is the signed payload of an invite token.
+type Claims struct {
+	ID      string `json:"id"`
+	Room    string `json:"room"`
+	Expires int64  `json:"exp"`
+}
+
+type Manager struct {
+	signer  *middleware.Signer
+	invites store.InviteStore
+	rooms   store.RoomStore
+}
+
+// NewManager returns a Manager sealing invite tokens with a key derived
+// from signer for invites only.
+func NewManager(signer *middleware.Signer, invites store.InviteStore, rooms store.RoomStore) *Manager {
+	return &Manager{signer: signer.Purpose("invite"), invites: invites, rooms: rooms}
+}
+
+// Create records a new invite to room and returns its token. maxUses of 0
+// allows any number of uses until the invite expires.
+func (m *Manager) Create(ctx context.Context, room, createdBy string, ttl time.Duration, maxUses int) (string, *store.Invite, error) {
+	if ttl <= 0 {
+		return "", nil, fmt.Errorf("invite lifetime must be positive")
+	}
+	if maxUses < 0 {
+		return "", nil, fmt.Errorf("max_uses must not be negative")
+	}
+
+	now := time.Now().UTC()
+	inv := &store.Invite{
+		ID:        newID(),
+		Room:      room,
+		CreatedBy: createdBy,
+		MaxUses:   maxUses,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if err := m.invites.CreateInvite(ctx, inv); err != nil {
+		return "", nil, err
+	}
+
+	token, err := m.signer.Seal(Claims{ID: inv.ID, Room: room, Expires: inv.ExpiresAt.Unix()})
+	if err != nil {
+		return "", nil, err
+	}
+	return token, inv, nil
+}
+
+// Parse verifies the token's signature and expiry without using it.
+func (m *Manager) Parse(token string) (*Claims, error) {
+	var claims Claims
+	if err := m.signer.Unseal(token, &claims); err != nil || claims.ID == "" {
+		return nil, ErrInvalid
+	}
+	if time.Now().Unix() > claims.Expires {
+		return nil, store.ErrInviteExpired
+	}
+	return &claims, nil
+}
+
+// Redeem uses the invite for username and makes them a member of its room.
+func (m *Manager) Redeem(ctx context.Context, token, username string) (*store.Room, error) {
+	claims, err := m.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+	if username == "" {
+		return nil, fmt.Errorf("%w: a username is required", ErrInvalid)
+	}
+
+	_, err = m.invites.UseInvite(ctx, claims.ID, username, time.Now().UTC())
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrInvalid
+	}
+	used := errors.Is(err, store.ErrInviteUsed)
+	if err != nil && !used {
+		return nil, err
+	}
+
+	room, err := m.rooms.GetRoom(ctx, claims.Room)
+	if err != nil {
+		return nil, err
+	}
+	// Accepting again is harmless for a member, but must not bring back
+	// one who was removed since
+	if used {
+		if room.Role(username) == "" {
+			return nil, store.ErrInviteUsed
+		}
+		return room, nil
+	}
+	if room.Role(username) == "" {
+		if room.Members == nil {
+			room.Members = make(map[string]string)
+		}
+		room.Members[username] = store.RoleMember
+		if err := m.rooms.PutRoom(ctx, room); err != nil {
+			return nil, err
+		}
+	}
+	return room, nil
+}
+
+func (m *Manager) List(ctx context.Context, room string) ([]*store.Invite, error) {
+	return m.invites.ListInvites(ctx, room)
+}
+
+// Revoke disables the invite of room with the given id.
+func (m *Manager) Revoke(ctx context.Context, room, id string) error {
+	inv, err := m.invites.GetInvite(ctx, id)
+	if err != nil {
+		return err
+	}
+	if inv.Room != room {
+		return store.ErrNotFound
+	}
+	return m.invites.RevokeInvite(ctx, id)
+}
+
+func newID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,104 @@
+package invite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+)
+
+func newTestManager(t *testing.T) (*Manager, *store.MemoryStore) {
+	t.Helper()
+	s := store.NewMemoryStore()
+	s.PutRoom(context.Background(), &store.Room{
+		Name:       "ops",
+		Visibility: store.VisibilityPrivate,
+		Members:    map[string]string{"alice": store.RoleOwner},
+	})
+	return NewManager(middleware.NewSigner("test-secret"), s, s), s
+}
+
+func TestManager_RedeemGrantsMembership(t *testing.T) {
+	m, s := newTestManager(t)
+	ctx := context.Background()
+
+	token, _, err := m.Create(ctx, "ops", "alice", time.Hour, 1)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	room, err := m.Redeem(ctx, token, "bob")
+	if err != nil {
+		t.Fatalf("Redeem failed: %v", err)
+	}
+	if room.Role("bob") != store.RoleMember {
+		t.Errorf("expected bob to be a member, got %q", room.Role("bob"))
+	}
+	stored, _ := s.GetRoom(ctx, "ops")
+	if stored.Role("bob") != store.RoleMember {
+		t.Error("membership was not persisted")
+	}
+
+	if _, err := m.Redeem(ctx, token, "carol"); !errors.Is(err, store.ErrInviteExhausted) {
+		t.Errorf("expected ErrInviteExhausted, got %v", err)
+	}
+}
+
+func TestManager_RepeatRedemptionDoesNotRestoreMembership(t *testing.T) {
+	m, s := newTestManager(t)
+	ctx := context.Background()
+
+	token, _, _ := m.Create(ctx, "ops", "alice", time.Hour, 0)
+	if _, err := m.Redeem(ctx, token, "bob"); err != nil {
+		t.Fatalf("Redeem failed: %v", err)
+	}
+
+	room, _ := s.GetRoom(ctx, "ops")
+	delete(room.Members, "bob")
+	s.PutRoom(ctx, room)
+
+	if _, err := m.Redeem(ctx, token, "bob"); !errors.Is(err, store.ErrInviteUsed) {
+		t.Errorf("expected ErrInviteUsed, got %v", err)
+	}
+	if room, _ := s.GetRoom(ctx, "ops"); room.Role("bob") != "" {
+		t.Errorf("a removed member should stay removed, got %q", room.Role("bob"))
+	}
+}
+
+func TestManager_RejectsTamperedAndRevoked(t *testing.T) {
+	m, _ := newTestManager(t)
+	ctx := context.Background()
+
+	token, inv, _ := m.Create(ctx, "ops", "alice", time.Hour, 0)
+
+	if _, err := m.Redeem(ctx, token+"x", "bob"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected ErrInvalid for a tampered token, got %v", err)
+	}
+
+	other := NewManager(middleware.NewSigner("other-secret"), store.NewMemoryStore(), store.NewMemoryStore())
+	if _, err := other.Parse(token); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected ErrInvalid for a foreign signature, got %v", err)
+	}
+
+	if err := m.Revoke(ctx, "general", inv.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("revoking through another room should fail, got %v", err)
+	}
+	if err := m.Revoke(ctx, "ops", inv.ID); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if _, err := m.Redeem(ctx, token, "bob"); !errors.Is(err, store.ErrInviteRevoked) {
+		t.Errorf("expected ErrInviteRevoked, got %v", err)
+	}
+}
+
+func TestManager_ExpiredToken(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	token, _ := m.signer.Seal(Claims{ID: "old", Room: "ops", Expires: time.Now().Add(-time.Minute).Unix()})
+	if _, err := m.Parse(token); !errors.Is(err, store.ErrInviteExpired) {
+		t.Errorf("expected ErrInviteExpired, got %v", err)
+	}
+}
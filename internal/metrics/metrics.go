@@ -0,0 +1,109 @@
+// Package metrics defines the Prometheus metrics exported on /metrics.
+// Collectors are package-level so that any package can record to them
+// without threading a registry through constructors.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "chat"
+
+var (
+	Clients = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "clients",
+		Help:      "Connected clients across every room.",
+	})
+
+	Rooms = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "rooms",
+		Help:      "Rooms with at least one connected client.",
+	})
+
+	MessagesIn = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_received_total",
+		Help:      "Messages received from clients.",
+	})
+
+	MessagesOut = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_sent_total",
+		Help:      "Messages queued for delivery to clients, counted once per recipient.",
+	})
+
+	BroadcastDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "broadcast_duration_seconds",
+		Help:      "Time taken to fan a message out to the send buffers of a room.",
+		Buckets:   []float64{.00001, .00005, .0001, .0005, .001, .005, .01, .05, .1},
+	})
+
+	SendBufferOccupancy = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "send_buffer_occupancy_ratio",
+		Help:      "Fill level of a client's send buffer after a message is queued.",
+		Buckets:   []float64{.01, .05, .1, .25, .5, .75, .9, 1},
+	})
+
+	SlowConsumerEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "slow_consumer_evictions_total",
+		Help:      "Clients dropped because their send buffer was full.",
+	})
+
+	StoreDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "store_operation_duration_seconds",
+		Help:      "Latency of Redis commands issued by the store.",
+		Buckets:   prometheus.ExponentialBuckets(.0001, 4, 8),
+	}, []string{"operation"})
+
+	StoreErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "store_operation_errors_total",
+		Help:      "Redis commands issued by the store that failed.",
+	}, []string{"operation"})
+
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by the rate limiter, by policy.",
+	}, []string{"policy"})
+
+	AuthFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_failures_total",
+		Help:      "Requests rejected by authentication, by reason (missing or invalid credentials).",
+	}, []string{"reason"})
+
+	UpgradeFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_upgrade_failures_total",
+		Help:      "WebSocket handshakes that failed after admission.",
+	})
+)
+
+// Registry holds the chat metrics and the Go runtime and process
+// collectors.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Clients, Rooms, MessagesIn, MessagesOut, BroadcastDuration, SendBufferOccupancy,
+		SlowConsumerEvictions, StoreDuration, StoreErrors, RateLimited, AuthFailures, UpgradeFailures,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
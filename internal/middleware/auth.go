@@ -1,68 +1,134 @@
 package middleware
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
 	"strings"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/metrics"
 )
 
+// ErrNoCredentials is returned by an Authenticator when the request carries
+// no credentials it recognizes, so the next one can be tried.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator resolves the identity behind a request's credentials.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
 type Auth struct {
-	token string
+	authenticators []Authenticator
+	legacy         *legacyToken // nil without AUTH_TOKEN
 }
 
-func NewAuth(token string) *Auth {
+// NewAuth returns an Auth trying each authenticator in turn. A non-empty
+// token (AUTH_TOKEN) is accepted as a key that may read and write, but not
+// administer; see NewAdminToken.
+func NewAuth(token string, authenticators ...Authenticator) *Auth {
+	var legacy *legacyToken
 	if token != "" {
-		slog.Info("authentication enabled")
+		legacy = newLegacyToken("AUTH_TOKEN", token, ScopeRead, ScopeWrite)
+		authenticators = append(authenticators, legacy)
+	}
+	if len(authenticators) > 0 {
+		slog.Info("authentication enabled", "authenticators", len(authenticators))
 	} else {
 		slog.Info("authentication disabled (no AUTH_TOKEN set)")
 	}
-	return &Auth{token: token}
+	return &Auth{authenticators: authenticators, legacy: legacy}
+}
+
+// SetToken rotates the AUTH_TOKEN while serving. The token can be
+// replaced but not added or removed, which changes whether auth is
+// enabled.
+func (a *Auth) SetToken(token string) error {
+	if a.legacy == nil || token == "" {
+		return errors.New("AUTH_TOKEN can only be added or removed with a restart")
+	}
+	a.legacy.set(token)
+	return nil
 }
 
 func (a *Auth) Enabled() bool {
-	return a.token != ""
+	return len(a.authenticators) > 0
 }
 
-func (a *Auth) ValidateRequest(r *http.Request) bool {
-	if !a.Enabled() {
-		return true
-	}
+// Authenticate validates r and returns the identity behind it. Requests
+// are valid without an identity only when auth is disabled.
+func (a *Auth) Authenticate(r *http.Request) (*Identity, bool) {
+	id, err := a.authenticate(r)
+	return id, err == nil
+}
 
-	// Check query parameter
-	if token := r.URL.Query().Get("token"); token == a.token {
-		return true
+// authenticate returns ErrNoCredentials when no authenticator recognized
+// the request's credentials, or the last error of one that did.
+func (a *Auth) authenticate(r *http.Request) (*Identity, error) {
+	if !a.Enabled() {
+		return nil, nil
 	}
 
-	// Check Authorization header (Bearer token)
-	authHeader := r.Header.Get("Authorization")
-	if strings.HasPrefix(authHeader, "Bearer ") {
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		if token == a.token {
-			return true
+	failure := ErrNoCredentials
+	for _, authenticator := range a.authenticators {
+		id, err := authenticator.Authenticate(r)
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, ErrNoCredentials) {
+			slog.Debug("authentication failed", "error", err, "path", r.URL.Path)
+			failure = err
 		}
 	}
 
-	return false
+	return nil, failure
+}
+
+func (a *Auth) ValidateRequest(r *http.Request) bool {
+	_, ok := a.Authenticate(r)
+	return ok
 }
 
 func (a *Auth) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !a.ValidateRequest(r) {
-			slog.Warn("unauthorized request", "ip", r.RemoteAddr, "path", r.URL.Path)
+		id, err := a.authenticate(r)
+		if err != nil {
+			reason := "invalid"
+			if errors.Is(err, ErrNoCredentials) {
+				reason = "missing"
+			}
+			metrics.AuthFailures.WithLabelValues(reason).Inc()
+			slog.Warn("unauthorized request", "ip", ClientIP(r), "path", r.URL.Path)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+		if id != nil {
+			if id.KeyName != "" {
+				slog.Debug("request authenticated by API key", "key", id.KeyName, "path", r.URL.Path)
+			}
+			r = r.WithContext(WithIdentity(r.Context(), id))
+		}
 		next.ServeHTTP(w, r)
 	})
 }
 
 func (a *Auth) MiddlewareFunc(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if !a.ValidateRequest(r) {
-			slog.Warn("unauthorized request", "ip", r.RemoteAddr, "path", r.URL.Path)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-		next(w, r)
+	return a.Middleware(next).ServeHTTP
+}
+
+// bearerToken returns the token from the query string or the
+// Authorization header.
+func bearerToken(r *http.Request) string {
+	// Check query parameter
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+
+	// Check Authorization header (Bearer token)
+	authHeader := r.Header.Get("Authorization")
+	if strings.HasPrefix(authHeader, "Bearer ") {
+		return strings.TrimPrefix(authHeader, "Bearer ")
 	}
+
+	return ""
 }
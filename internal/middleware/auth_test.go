@@ -4,6 +4,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/metrics"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestAuth_Disabled(t *testing.T) {
@@ -92,3 +96,40 @@ func TestAuth_Middleware(t *testing.T) {
 		t.Errorf("expected 401, got %d", rec.Code)
 	}
 }
+
+func TestAuth_FailureMetrics(t *testing.T) {
+	auth := NewAuth("", NewKeyRegistry(store.NewMemoryKeyStore()))
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	missing := testutil.ToFloat64(metrics.AuthFailures.WithLabelValues("missing"))
+	invalid := testutil.ToFloat64(metrics.AuthFailures.WithLabelValues("invalid"))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/?token=ck_unknown", nil))
+
+	if got := testutil.ToFloat64(metrics.AuthFailures.WithLabelValues("missing")); got != missing+1 {
+		t.Errorf("expected one missing-credentials failure, got %v", got-missing)
+	}
+	if got := testutil.ToFloat64(metrics.AuthFailures.WithLabelValues("invalid")); got != invalid+1 {
+		t.Errorf("expected one invalid-credentials failure, got %v", got-invalid)
+	}
+}
+
+func TestAuth_SetToken(t *testing.T) {
+	auth := NewAuth("old")
+	if err := auth.SetToken("new"); err != nil {
+		t.Fatalf("SetToken: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/?token=old", nil)
+	if auth.ValidateRequest(req) {
+		t.Error("should reject the rotated-out token")
+	}
+	req = httptest.NewRequest("GET", "/?token=new", nil)
+	if !auth.ValidateRequest(req) {
+		t.Error("should allow the new token")
+	}
+
+	if err := NewAuth("").SetToken("new"); err == nil {
+		t.Error("should not enable auth while serving")
+	}
+}
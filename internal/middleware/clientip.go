@@ -0,0 +1,210 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// TrustedProxies resolves the client IP of requests that come through
+// reverse proxies. Proxy headers are only believed when the peer is a
+// trusted proxy, and the chain is read from the right, skipping trusted
+// hops, since everything left of the first untrusted hop may be forged.
+type TrustedProxies struct {
+	prefixes []netip.Prefix
+	warned   atomic.Bool // proxy headers from an untrusted peer were logged
+}
+
+// NewTrustedProxies parses a list of CIDRs or bare IPs. An empty list
+// trusts no proxy, so proxy headers are ignored.
+func NewTrustedProxies(cidrs []string) (*TrustedProxies, error) {
+	prefixes, err := parsePrefixes(cidrs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxy: %w", err)
+	}
+	return &TrustedProxies{prefixes: prefixes}, nil
+}
+
+// parsePrefixes parses CIDRs, and bare IPs as single-address prefixes.
+func parsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, s := range cidrs {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not an IP or CIDR", s)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP or CIDR", s)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// containsAddr reports whether any of prefixes contains addr.
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Trusted reports whether addr belongs to a trusted proxy.
+func (p *TrustedProxies) Trusted(addr netip.Addr) bool {
+	return p != nil && containsAddr(p.prefixes, addr)
+}
+
+// Resolve returns the IP of the client that sent r. The RFC 7239
+// Forwarded header is preferred over X-Forwarded-For, and X-Real-IP is
+// only used when a trusted proxy sent neither.
+func (p *TrustedProxies) Resolve(r *http.Request) string {
+	peer, ok := parseHop(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if !p.Trusted(peer) {
+		p.warnUntrusted(r, peer)
+		return peer.String()
+	}
+
+	hops := forwardedFor(r.Header)
+	if hops == nil {
+		hops = forwardedList(r.Header.Values("X-Forwarded-For"))
+	}
+	if hops == nil {
+		if addr, ok := parseHop(r.Header.Get("X-Real-IP")); ok {
+			return addr.String()
+		}
+		return peer.String()
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseHop(hops[i])
+		if !ok {
+			// Obfuscated or unknown hops hide everything beyond them
+			break
+		}
+		client = addr
+		if !p.Trusted(addr) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// warnUntrusted logs, once, that proxy headers arrived from a peer that is
+// not a trusted proxy. Behind a proxy that is missing from the list, every
+// client resolves to the proxy's address and shares its rate limits,
+// connection caps and bans.
+func (p *TrustedProxies) warnUntrusted(r *http.Request, peer netip.Addr) {
+	if p == nil || (r.Header.Get("Forwarded") == "" && r.Header.Get("X-Forwarded-For") == "" &&
+		r.Header.Get("X-Real-IP") == "") {
+		return
+	}
+	if p.warned.CompareAndSwap(false, true) {
+		slog.Warn("ignoring proxy headers from an untrusted peer; if the server runs behind a proxy, "+
+			"add its addresses to TRUSTED_PROXIES or every client shares its IP", "peer", peer.String())
+	}
+}
+
+// Middleware resolves the client IP once and attaches it to the request
+// context, where ClientIP finds it.
+func (p *TrustedProxies) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithClientIP(r.Context(), p.Resolve(r))))
+	})
+}
+
+// forwardedFor returns the for= parameter of every element of the
+// Forwarded headers, oldest hop first, or nil without the header. Elements
+// without one are returned empty, which stops the walk in Resolve.
+func forwardedFor(h http.Header) []string {
+	var hops []string
+	for _, line := range h.Values("Forwarded") {
+		for _, elem := range strings.Split(line, ",") {
+			hop := ""
+			for _, pair := range strings.Split(elem, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hop = strings.Trim(value, `"`)
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// forwardedList splits X-Forwarded-For headers into hops, oldest first,
+// or returns nil without them.
+func forwardedList(lines []string) []string {
+	var hops []string
+	for _, line := range lines {
+		for _, hop := range strings.Split(line, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// parseHop parses an address with an optional port, as found in
+// RemoteAddr and the proxy headers, including bracketed IPv6.
+func parseHop(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Unmap(), true
+	}
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return ap.Addr().Unmap(), true
+	}
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		if addr, err := netip.ParseAddr(s[1 : len(s)-1]); err == nil {
+			return addr.Unmap(), true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+type clientIPKey struct{}
+
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext returns the client IP resolved by TrustedProxies,
+// if any.
+func ClientIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(clientIPKey{}).(string)
+	return ip, ok && ip != ""
+}
+
+// ClientIP returns the address of the client that sent r: the one
+// resolved by TrustedProxies, or the peer address when the request did
+// not go through it.
+func ClientIP(r *http.Request) string {
+	if ip, ok := ClientIPFromContext(r.Context()); ok {
+		return ip
+	}
+	if addr, ok := parseHop(r.RemoteAddr); ok {
+		return addr.String()
+	}
+	return r.RemoteAddr
+}
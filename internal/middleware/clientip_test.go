@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxies_Resolve(t *testing.T) {
+	proxies, err := NewTrustedProxies([]string{"10.0.0.0/8", "2001:db8::/32", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"untrusted peer", "203.0.113.9:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "203.0.113.9"},
+		{"trusted peer without headers", "10.0.0.2:1234", nil, "10.0.0.2"},
+		{"rightmost untrusted hop", "10.0.0.2:1234",
+			map[string]string{"X-Forwarded-For": "6.6.6.6, 1.2.3.4, 10.0.0.3"}, "1.2.3.4"},
+		{"all hops trusted", "10.0.0.2:1234", map[string]string{"X-Forwarded-For": "192.168.1.1, 10.0.0.3"}, "192.168.1.1"},
+		{"garbage hop", "10.0.0.2:1234", map[string]string{"X-Forwarded-For": "1.2.3.4, nonsense, 10.0.0.3"}, "10.0.0.3"},
+		{"forwarded", "10.0.0.2:1234",
+			map[string]string{"Forwarded": `for=6.6.6.6, for="[2001:db8:cafe::17]:4711";proto=https, for=198.51.100.17;by=10.0.0.2`},
+			"198.51.100.17"},
+		{"forwarded over xff", "10.0.0.2:1234",
+			map[string]string{"Forwarded": "for=198.51.100.17", "X-Forwarded-For": "6.6.6.6"}, "198.51.100.17"},
+		{"forwarded ipv6", "[2001:db8::1]:443",
+			map[string]string{"Forwarded": `for="[2001:db8:cafe::17]:4711"`}, "2001:db8:cafe::17"},
+		{"obfuscated forwarded hop", "10.0.0.2:1234",
+			map[string]string{"Forwarded": "for=198.51.100.17, for=_hidden, for=10.0.0.3"}, "10.0.0.3"},
+		{"x-real-ip from trusted peer", "10.0.0.2:1234", map[string]string{"X-Real-IP": "198.51.100.17"}, "198.51.100.17"},
+		{"ipv4-mapped peer", "[::ffff:10.0.0.2]:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "1.2.3.4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if got := proxies.Resolve(req); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTrustedProxies_WarnsAboutUntrustedHeaders(t *testing.T) {
+	proxies, _ := NewTrustedProxies(nil)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "100.64.0.2:1234"
+	proxies.Resolve(req)
+	if proxies.warned.Load() {
+		t.Error("requests without proxy headers should not warn")
+	}
+
+	req.Header.Set("X-Forwarded-For", "198.51.100.17")
+	if got := proxies.Resolve(req); got != "100.64.0.2" {
+		t.Errorf("expected the peer address, got %s", got)
+	}
+	if !proxies.warned.Load() {
+		t.Error("expected a warning for proxy headers from an untrusted peer")
+	}
+}
+
+func TestTrustedProxies_Invalid(t *testing.T) {
+	if _, err := NewTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("expected an error for an invalid CIDR")
+	}
+	if _, err := NewTrustedProxies([]string{"proxy.local"}); err == nil {
+		t.Error("expected an error for a hostname")
+	}
+}
+
+func TestTrustedProxies_Middleware(t *testing.T) {
+	proxies, _ := NewTrustedProxies([]string{"127.0.0.1"})
+
+	var got string
+	handler := proxies.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ClientIP(r)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.17")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "198.51.100.17" {
+		t.Errorf("expected the resolved IP in the context, got %s", got)
+	}
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/origin"
+)
+
+// CORS lets browsers on allowed origins call the HTTP endpoints, using the
+// same origin patterns as WebSocket upgrades. Requests from other origins
+// are served without CORS headers, so browsers hide the responses, and
+// their preflights are rejected.
+type CORS struct {
+	mu       sync.RWMutex
+	patterns []string
+
+	Methods []string
+	Headers []string // request headers the client may send
+	Expose  []string // response headers the client may read
+	MaxAge  time.Duration
+}
+
+func NewCORS(patterns []string) *CORS {
+	c := &CORS{
+		Methods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		Headers: []string{"Authorization", "Content-Type"},
+		Expose: []string{
+			"RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After",
+		},
+		MaxAge: 10 * time.Minute,
+	}
+	c.SetPatterns(patterns)
+	return c
+}
+
+// SetPatterns replaces the allowed origins while serving.
+func (c *CORS) SetPatterns(patterns []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.patterns = patterns
+}
+
+// allowed reports whether origin o is allowed and, if so, whether
+// credentialed requests are. Those carry the session cookie, so they are
+// only allowed for origins listed exactly, not through * or the wildcard
+// and regular expression patterns, which may match hosts run by others.
+func (c *CORS) allowed(o string) (ok, credentials bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, pattern := range c.patterns {
+		if origin.Match(pattern, o) {
+			ok = true
+			if origin.Exact(pattern) {
+				return true, true
+			}
+		}
+	}
+	return ok, false
+}
+
+func (c *CORS) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		o := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+		}
+		if o == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ok, credentials := c.allowed(o)
+		if !ok {
+			if preflight {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.Set("Access-Control-Allow-Origin", o)
+		if credentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			h.Set("Access-Control-Expose-Headers", strings.Join(c.Expose, ", "))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		method := r.Header.Get("Access-Control-Request-Method")
+		if !slices.Contains(c.Methods, method) && method != http.MethodGet && method != http.MethodHead {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+			header = strings.TrimSpace(header)
+			if header != "" && !slices.ContainsFunc(c.Headers, func(allowed string) bool {
+				return strings.EqualFold(allowed, header)
+			}) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+
+		h.Set("Access-Control-Allow-Methods", strings.Join(c.Methods, ", "))
+		h.Set("Access-Control-Allow-Headers", strings.Join(c.Headers, ", "))
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
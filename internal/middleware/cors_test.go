@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func corsRequest(method, origin string, headers map[string]string) *http.Request {
+	req := httptest.NewRequest(method, "/api/rooms", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return req
+}
+
+func TestCORS(t *testing.T) {
+	cors := NewCORS([]string{"https://*.up.railway.app", "https://chat.example.com"})
+	handler := cors.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// A simple request from an allowed origin
+	rec := serve(corsRequest("GET", "https://chat.example.com", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "https://chat.example.com" ||
+		rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("unexpected response %d %v", rec.Code, rec.Header())
+	}
+
+	// Wildcard patterns allow the origin, but not with credentials
+	rec = serve(corsRequest("GET", "https://pr-1.up.railway.app", nil))
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://pr-1.up.railway.app" ||
+		rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("expected no credentials for a wildcard pattern, got %v", rec.Header())
+	}
+	if rec.Header().Get("Access-Control-Expose-Headers") == "" || rec.Header().Get("Vary") != "Origin" {
+		t.Errorf("expected exposed headers and Vary, got %v", rec.Header())
+	}
+
+	// Other origins are served without CORS headers
+	rec = serve(corsRequest("GET", "https://evil.example", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("unexpected response %d %v", rec.Code, rec.Header())
+	}
+
+	// Preflights are answered without reaching the handler
+	rec = serve(corsRequest("OPTIONS", "https://pr-1.up.railway.app", map[string]string{
+		"Access-Control-Request-Method":  "PATCH",
+		"Access-Control-Request-Headers": "authorization, content-type",
+	}))
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Methods") == "" ||
+		rec.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("unexpected preflight response %d %v", rec.Code, rec.Header())
+	}
+
+	rec = serve(corsRequest("OPTIONS", "https://evil.example", map[string]string{"Access-Control-Request-Method": "POST"}))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a preflight from another origin, got %d", rec.Code)
+	}
+	rec = serve(corsRequest("OPTIONS", "https://pr-1.up.railway.app", map[string]string{
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "X-Secret",
+	}))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for an unlisted request header, got %d", rec.Code)
+	}
+}
+
+func TestCORS_WildcardWithoutCredentials(t *testing.T) {
+	handler := NewCORS([]string{"*"}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, corsRequest("GET", "https://anywhere.example", nil))
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://anywhere.example" {
+		t.Errorf("expected the origin to be allowed, got %v", rec.Header())
+	}
+	if rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Error("credentials must not be allowed for every origin")
+	}
+}
+
+func TestCORS_SetPatterns(t *testing.T) {
+	cors := NewCORS([]string{"*"})
+	handler := cors.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	cors.SetPatterns([]string{"https://example.com"})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, corsRequest("GET", "https://other.com", nil))
+	if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("expected the replaced patterns to reject other origins")
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, corsRequest("GET", "https://example.com", nil))
+	if rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("expected credentials once origins are listed, got %v", rec.Header())
+	}
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"slices"
+)
+
+// API key scopes.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+	ScopeBot   = "bot"
+)
+
+// BotPrefix starts the usernames of bot keys, so that a key named like a
+// user never inherits that user's room roles, ACLs or bans.
+const BotPrefix = "bot:"
+
+// Identity is the authenticated principal behind a request.
+type Identity struct {
+	Username string // empty when the client picks its own name
+	Roles    []string
+	Rooms    []string // rooms the identity may join; empty means any room
+	Scopes   []string // nil for user identities (JWT, SSO)
+	KeyName  string   // API key that authenticated the request, if any
+}
+
+func (id *Identity) HasRole(role string) bool {
+	return slices.Contains(id.Roles, role)
+}
+
+// HasScope reports whether the identity may perform actions of scope. User
+// identities may read and write, and administer with the admin role; API
+// keys are limited to their scopes, where admin implies every other scope
+// and bot implies read and write.
+func (id *Identity) HasScope(scope string) bool {
+	if id.Scopes == nil {
+		return scope == ScopeRead || scope == ScopeWrite || id.HasRole(ScopeAdmin)
+	}
+	if (scope == ScopeRead || scope == ScopeWrite) && id.IsBot() {
+		return true
+	}
+	return slices.Contains(id.Scopes, scope) || slices.Contains(id.Scopes, ScopeAdmin)
+}
+
+// IsBot reports whether the identity is an API key marked as a bot.
+func (id *Identity) IsBot() bool {
+	return slices.Contains(id.Scopes, ScopeBot)
+}
+
+func (id *Identity) CanJoin(room string) bool {
+	return len(id.Rooms) == 0 || slices.Contains(id.Rooms, room)
+}
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext returns the identity attached by Auth, if any.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok && id != nil
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// identityClaims are the JWT claims mapped onto an Identity.
+type identityClaims struct {
+	Username          string   `json:"username"`
+	PreferredUsername string   `json:"preferred_username"`
+	Roles             []string `json:"roles"`
+	Rooms             []string `json:"rooms"`
+	jwt.RegisteredClaims
+}
+
+func (c *identityClaims) identity() (*Identity, error) {
+	username := c.Username
+	if username == "" {
+		username = c.PreferredUsername
+	}
+	if username == "" {
+		username = c.Subject
+	}
+	if username == "" {
+		return nil, errors.New("token has no username claim")
+	}
+	return &Identity{Username: username, Roles: c.Roles, Rooms: c.Rooms}, nil
+}
+
+// JWTValidator authenticates requests carrying a JWT signed with HS256
+// (shared secret) or RS256/ES256 (keys from a local JWKS file).
+type JWTValidator struct {
+	mu       sync.RWMutex
+	secret   []byte
+	jwks     *JWKS
+	methods  []string
+	issuer   string
+	audience string
+}
+
+func NewJWTValidator(secret, jwksFile, issuer, audience string) (*JWTValidator, error) {
+	v := &JWTValidator{issuer: issuer, audience: audience}
+
+	if secret != "" {
+		v.secret = []byte(secret)
+		v.methods = append(v.methods, "HS256")
+	}
+	if jwksFile != "" {
+		jwks, err := LoadJWKSFile(jwksFile)
+		if err != nil {
+			return nil, err
+		}
+		v.jwks = jwks
+		v.methods = append(v.methods, "RS256", "ES256")
+	}
+	if len(v.methods) == 0 {
+		return nil, errors.New("JWT validation needs a secret or a JWKS file")
+	}
+
+	return v, nil
+}
+
+// Reload replaces the secret, the JWKS file (which is read again even if
+// its path is the same), the issuer and the audience while serving.
+// Nothing changes if the new settings are invalid.
+func (v *JWTValidator) Reload(secret, jwksFile, issuer, audience string) error {
+	next, err := NewJWTValidator(secret, jwksFile, issuer, audience)
+	if err != nil {
+		return err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.secret, v.jwks, v.methods = next.secret, next.jwks, next.methods
+	v.issuer, v.audience = next.issuer, next.audience
+	return nil
+}
+
+// Authenticate implements Authenticator.
+func (v *JWTValidator) Authenticate(r *http.Request) (*Identity, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, ErrNoCredentials
+	}
+	return v.Validate(token)
+}
+
+// Validate verifies a raw token and returns the identity in its claims.
+func (v *JWTValidator) Validate(token string) (*Identity, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(v.methods),
+		jwt.WithExpirationRequired(),
+	}
+	if v.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.issuer))
+	}
+	if v.audience != "" {
+		opts = append(opts, jwt.WithAudience(v.audience))
+	}
+
+	claims := &identityClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, v.key, opts...); err != nil {
+		return nil, err
+	}
+	return claims.identity()
+}
+
+// key is called by Validate, which holds v.mu.
+func (v *JWTValidator) key(t *jwt.Token) (any, error) {
+	alg := t.Method.Alg()
+	if alg == "HS256" {
+		return v.secret, nil
+	}
+
+	kid, _ := t.Header["kid"].(string)
+	key, ok := v.jwks.Key(kid, alg)
+	if !ok {
+		return nil, fmt.Errorf("no %s key for kid %q", alg, kid)
+	}
+	return key, nil
+}
@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func signToken(t *testing.T, method jwt.SigningMethod, key any, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":      "user-42",
+		"username": "alice",
+		"roles":    []string{"moderator"},
+		"rooms":    []string{"general", "ops"},
+		"exp":      time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func writeJWKS(t *testing.T, rsaKey *rsa.PublicKey, ecKey *ecdsa.PublicKey) string {
+	t.Helper()
+
+	ecBytes, _ := ecKey.Bytes()
+	keys := map[string]any{"keys": []map[string]string{
+		{
+			"kty": "RSA", "kid": "rsa-1", "use": "sig",
+			"n": b64(rsaKey.N.Bytes()),
+			"e": b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+		},
+		{
+			"kty": "EC", "kid": "ec-1", "crv": "P-256",
+			"x": b64(ecBytes[1:33]),
+			"y": b64(ecBytes[33:]),
+		},
+	}}
+
+	data, _ := json.Marshal(keys)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestJWTValidator_HS256(t *testing.T) {
+	v, err := NewJWTValidator("secret123", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := v.Validate(signToken(t, jwt.SigningMethodHS256, []byte("secret123"), "", validClaims()))
+	if err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	if id.Username != "alice" {
+		t.Errorf("expected username alice, got %s", id.Username)
+	}
+	if !id.HasRole("moderator") {
+		t.Error("expected moderator role")
+	}
+	if !id.CanJoin("ops") || id.CanJoin("random") {
+		t.Errorf("unexpected room access for rooms %v", id.Rooms)
+	}
+
+	// Wrong secret
+	if _, err := v.Validate(signToken(t, jwt.SigningMethodHS256, []byte("wrong"), "", validClaims())); err == nil {
+		t.Error("should reject token signed with another secret")
+	}
+
+	// Expired
+	claims := validClaims()
+	claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	if _, err := v.Validate(signToken(t, jwt.SigningMethodHS256, []byte("secret123"), "", claims)); err == nil {
+		t.Error("should reject expired token")
+	}
+
+	// Missing expiry
+	claims = validClaims()
+	delete(claims, "exp")
+	if _, err := v.Validate(signToken(t, jwt.SigningMethodHS256, []byte("secret123"), "", claims)); err == nil {
+		t.Error("should reject token without expiry")
+	}
+}
+
+func TestJWTValidator_JWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	v, err := NewJWTValidator("", writeJWKS(t, &rsaKey.PublicKey, &ecKey.PublicKey), "https://issuer.test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := validClaims()
+	claims["iss"] = "https://issuer.test"
+
+	if _, err := v.Validate(signToken(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", claims)); err != nil {
+		t.Errorf("valid RS256 token rejected: %v", err)
+	}
+	if _, err := v.Validate(signToken(t, jwt.SigningMethodES256, ecKey, "ec-1", claims)); err != nil {
+		t.Errorf("valid ES256 token rejected: %v", err)
+	}
+
+	// HS256 is not accepted without a configured secret
+	if _, err := v.Validate(signToken(t, jwt.SigningMethodHS256, []byte("anything"), "", claims)); err == nil {
+		t.Error("should reject HS256 when no secret is configured")
+	}
+
+	// Unknown signer
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if _, err := v.Validate(signToken(t, jwt.SigningMethodRS256, otherKey, "rsa-1", claims)); err == nil {
+		t.Error("should reject token signed by an unknown key")
+	}
+
+	// Wrong issuer
+	claims["iss"] = "https://evil.test"
+	if _, err := v.Validate(signToken(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", claims)); err == nil {
+		t.Error("should reject token from another issuer")
+	}
+}
+
+func TestAuth_JWTIdentityInContext(t *testing.T) {
+	v, _ := NewJWTValidator("secret123", "", "", "")
+	auth := NewAuth("", v)
+
+	var got *Identity
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = IdentityFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/ws?username=mallory", nil)
+	req.Header.Set("Authorization", "Bearer "+signToken(t, jwt.SigningMethodHS256, []byte("secret123"), "", validClaims()))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if got == nil || got.Username != "alice" {
+		t.Errorf("expected identity alice in context, got %+v", got)
+	}
+
+	// A request without a token is rejected
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/ws", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", rec.Code)
+	}
+}
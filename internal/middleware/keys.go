@@ -0,0 +1,229 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+)
+
+const (
+	keyPrefix       = "ck_"
+	keyCacheRefresh = 30 * time.Second
+)
+
+var ValidScopes = []string{ScopeRead, ScopeWrite, ScopeAdmin, ScopeBot}
+
+// KeyRegistry authenticates requests against the API keys in a KeyStore.
+// Keys are cached in memory and reloaded periodically, so a key revoked on
+// another replica stops working within keyCacheRefresh.
+type KeyRegistry struct {
+	store   store.KeyStore
+	mu      sync.RWMutex
+	keys    []store.APIKey
+	loaded  time.Time
+	refresh time.Duration
+}
+
+func NewKeyRegistry(s store.KeyStore) *KeyRegistry {
+	return &KeyRegistry{store: s, refresh: keyCacheRefresh}
+}
+
+// Authenticate implements Authenticator.
+func (kr *KeyRegistry) Authenticate(r *http.Request) (*Identity, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, ErrNoCredentials
+	}
+
+	key, ok := kr.lookup(r.Context(), token)
+	if !ok {
+		return nil, errors.New("unknown API key")
+	}
+	if key.Expired(time.Now()) {
+		return nil, fmt.Errorf("API key %q expired", key.Name)
+	}
+
+	id := &Identity{Rooms: key.Rooms, Scopes: key.Scopes, KeyName: key.Name}
+	if slices.Contains(key.Scopes, ScopeBot) {
+		id.Username = BotPrefix + key.Name
+	}
+	return id, nil
+}
+
+// lookup compares the token's hash against every key without stopping at
+// the first match, so the time taken does not depend on which key matched.
+func (kr *KeyRegistry) lookup(ctx context.Context, token string) (store.APIKey, bool) {
+	sum := sha256.Sum256([]byte(token))
+	hash := []byte(hex.EncodeToString(sum[:]))
+
+	var match store.APIKey
+	found := 0
+	for _, key := range kr.cached(ctx) {
+		if subtle.ConstantTimeCompare(hash, []byte(key.Hash)) == 1 {
+			match = key
+			found = 1
+		}
+	}
+	return match, found == 1
+}
+
+func (kr *KeyRegistry) cached(ctx context.Context) []store.APIKey {
+	kr.mu.RLock()
+	keys, fresh := kr.keys, time.Since(kr.loaded) < kr.refresh
+	kr.mu.RUnlock()
+
+	if fresh {
+		return keys
+	}
+	if err := kr.Reload(ctx); err != nil {
+		slog.Warn("failed to reload API keys, using cached keys", "error", err)
+		return keys
+	}
+
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.keys
+}
+
+// Reload reads the keys from the store now rather than when the cache
+// expires, for instance after the key file was edited.
+func (kr *KeyRegistry) Reload(ctx context.Context) error {
+	keys, err := kr.store.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	kr.mu.Lock()
+	kr.keys = keys
+	kr.loaded = time.Now()
+	kr.mu.Unlock()
+	return nil
+}
+
+// Create stores a new key and returns its secret, which cannot be
+// recovered later. A zero ttl creates a key that never expires.
+func (kr *KeyRegistry) Create(ctx context.Context, name string, scopes, rooms []string, ttl time.Duration) (string, store.APIKey, error) {
+	if name == "" {
+		return "", store.APIKey{}, errors.New("key name is required")
+	}
+	if len(scopes) == 0 {
+		return "", store.APIKey{}, errors.New("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(ValidScopes, scope) {
+			return "", store.APIKey{}, fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+
+	existing, err := kr.store.ListKeys(ctx)
+	if err != nil {
+		return "", store.APIKey{}, err
+	}
+	for _, k := range existing {
+		if k.Name == name {
+			return "", store.APIKey{}, fmt.Errorf("key %q already exists", name)
+		}
+	}
+
+	b := make([]byte, 32)
+	rand.Read(b)
+	secret := keyPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	key := store.APIKey{
+		Name:      name,
+		Hash:      hashKey(secret),
+		Scopes:    scopes,
+		Rooms:     rooms,
+		CreatedAt: time.Now().UTC(),
+	}
+	if ttl > 0 {
+		key.ExpiresAt = key.CreatedAt.Add(ttl)
+	}
+
+	if err := kr.store.PutKey(ctx, key); err != nil {
+		return "", store.APIKey{}, err
+	}
+	slog.Info("API key created", "name", name, "scopes", scopes)
+	return secret, key, kr.Reload(ctx)
+}
+
+func (kr *KeyRegistry) List(ctx context.Context) ([]store.APIKey, error) {
+	return kr.store.ListKeys(ctx)
+}
+
+func (kr *KeyRegistry) Revoke(ctx context.Context, name string) error {
+	if err := kr.store.DeleteKey(ctx, name); err != nil {
+		return err
+	}
+	slog.Info("API key revoked", "name", name)
+	return kr.Reload(ctx)
+}
+
+func hashKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// legacyToken authenticates a static bootstrap credential as a key with
+// fixed scopes: AUTH_TOKEN, shared by every chat client, may only read and
+// write, and ADMIN_TOKEN administers.
+type legacyToken struct {
+	name   string
+	scopes []string
+	hash   atomic.Pointer[[]byte]
+}
+
+func newLegacyToken(name, token string, scopes ...string) *legacyToken {
+	t := &legacyToken{name: name, scopes: scopes}
+	t.set(token)
+	return t
+}
+
+// NewAdminToken returns an Authenticator accepting token (ADMIN_TOKEN) as
+// a key with the admin scope, to bootstrap API keys and reach /admin.
+func NewAdminToken(token string) Authenticator {
+	return newLegacyToken("ADMIN_TOKEN", token, ScopeAdmin)
+}
+
+func (t *legacyToken) set(token string) {
+	hash := []byte(hashKey(token))
+	t.hash.Store(&hash)
+}
+
+func (t *legacyToken) Authenticate(r *http.Request) (*Identity, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, ErrNoCredentials
+	}
+	if subtle.ConstantTimeCompare(*t.hash.Load(), []byte(hashKey(token))) != 1 {
+		return nil, ErrNoCredentials
+	}
+	return &Identity{Scopes: t.scopes, KeyName: t.name}, nil
+}
+
+// RequireScope rejects requests whose identity lacks scope. It must run
+// after Auth.
+func RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := IdentityFromContext(r.Context())
+		if !ok || !id.HasScope(scope) {
+			slog.Warn("forbidden request", "ip", ClientIP(r), "path", r.URL.Path, "scope", scope)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+)
+
+func TestKeyRegistry_CreateAndAuthenticate(t *testing.T) {
+	kr := NewKeyRegistry(store.NewMemoryKeyStore())
+	ctx := context.Background()
+
+	secret, key, err := kr.Create(ctx, "ci", []string{ScopeWrite}, []string{"deploys"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Hash == "" || key.Hash == secret {
+		t.Error("only the hash of the secret should be stored")
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+secret)
+	id, err := kr.Authenticate(req)
+	if err != nil {
+		t.Fatalf("valid key rejected: %v", err)
+	}
+	if id.KeyName != "ci" {
+		t.Errorf("expected key name ci, got %s", id.KeyName)
+	}
+	if !id.HasScope(ScopeWrite) || id.HasScope(ScopeRead) || id.HasScope(ScopeAdmin) {
+		t.Errorf("unexpected scopes %v", id.Scopes)
+	}
+	if !id.CanJoin("deploys") || id.CanJoin("general") {
+		t.Errorf("unexpected rooms %v", id.Rooms)
+	}
+
+	// Unknown key
+	req = httptest.NewRequest("GET", "/?token=ck_unknown", nil)
+	if _, err := kr.Authenticate(req); err == nil {
+		t.Error("should reject unknown key")
+	}
+
+	// Duplicate name
+	if _, _, err := kr.Create(ctx, "ci", []string{ScopeRead}, nil, 0); err == nil {
+		t.Error("should reject duplicate key name")
+	}
+
+	// Unknown scope
+	if _, _, err := kr.Create(ctx, "other", []string{"root"}, nil, 0); err == nil {
+		t.Error("should reject unknown scope")
+	}
+}
+
+func TestKeyRegistry_ExpiryAndRevocation(t *testing.T) {
+	ks := store.NewMemoryKeyStore()
+	kr := NewKeyRegistry(ks)
+	ctx := context.Background()
+
+	secret, _, _ := kr.Create(ctx, "old", []string{ScopeRead}, nil, time.Hour)
+
+	req := httptest.NewRequest("GET", "/?token="+secret, nil)
+	if _, err := kr.Authenticate(req); err != nil {
+		t.Fatalf("valid key rejected: %v", err)
+	}
+
+	// Expire the key in the store
+	keys, _ := ks.ListKeys(ctx)
+	keys[0].ExpiresAt = time.Now().Add(-time.Minute)
+	ks.PutKey(ctx, keys[0])
+	kr.Reload(ctx)
+
+	if _, err := kr.Authenticate(req); err == nil {
+		t.Error("should reject expired key")
+	}
+
+	if err := kr.Revoke(ctx, "old"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kr.Authenticate(req); err == nil {
+		t.Error("should reject revoked key")
+	}
+	if err := kr.Revoke(ctx, "old"); err != store.ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestKeyRegistry_BotKeyNamesIdentity(t *testing.T) {
+	kr := NewKeyRegistry(store.NewMemoryKeyStore())
+	secret, _, _ := kr.Create(context.Background(), "deploy-bot", []string{ScopeRead, ScopeWrite, ScopeBot}, nil, 0)
+
+	id, err := kr.Authenticate(httptest.NewRequest("GET", "/?token="+secret, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Username != "bot:deploy-bot" {
+		t.Errorf("bot keys should authenticate as their prefixed name, got %q", id.Username)
+	}
+	if !id.IsBot() || !id.HasScope(ScopeRead) || !id.HasScope(ScopeWrite) || id.HasScope(ScopeAdmin) {
+		t.Errorf("bot keys should read and write as bots, got %v", id.Scopes)
+	}
+}
+
+func TestKeyRegistry_BotKeyDoesNotActAsUser(t *testing.T) {
+	kr := NewKeyRegistry(store.NewMemoryKeyStore())
+	secret, _, _ := kr.Create(context.Background(), "alice", []string{ScopeBot}, nil, 0)
+
+	id, err := kr.Authenticate(httptest.NewRequest("GET", "/?token="+secret, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Username == "alice" {
+		t.Error("a bot key named alice must not authenticate as the user alice")
+	}
+}
+
+func TestAuth_LegacyTokenIsNotAdmin(t *testing.T) {
+	auth := NewAuth("secret123", NewAdminToken("admin123"))
+
+	id, ok := auth.Authenticate(httptest.NewRequest("GET", "/?token=secret123", nil))
+	if !ok || id == nil {
+		t.Fatal("AUTH_TOKEN should authenticate")
+	}
+	if id.KeyName != "AUTH_TOKEN" || !id.HasScope(ScopeWrite) || id.HasScope(ScopeAdmin) || id.IsBot() {
+		t.Errorf("AUTH_TOKEN is shared by chat clients and must not administer, got %+v", id)
+	}
+
+	id, ok = auth.Authenticate(httptest.NewRequest("GET", "/?token=admin123", nil))
+	if !ok || id == nil || id.KeyName != "ADMIN_TOKEN" || !id.HasScope(ScopeAdmin) {
+		t.Errorf("ADMIN_TOKEN should authenticate as an admin key, got %+v", id)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	handler := RequireScope(ScopeAdmin, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cases := []struct {
+		name string
+		id   *Identity
+		want int
+	}{
+		{"no identity", nil, http.StatusForbidden},
+		{"read key", &Identity{Scopes: []string{ScopeRead}}, http.StatusForbidden},
+		{"admin key", &Identity{Scopes: []string{ScopeAdmin}}, http.StatusOK},
+		{"user", &Identity{Username: "alice"}, http.StatusForbidden},
+		{"admin user", &Identity{Username: "alice", Roles: []string{"admin"}}, http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest("GET", "/admin/keys", nil)
+		if tc.id != nil {
+			req = req.WithContext(WithIdentity(req.Context(), tc.id))
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"sync"
+)
+
+// NetworkPolicy admits requests by client IP. Denied addresses are always
+// rejected; when the allow list is not empty, only addresses on it are
+// admitted. The lists may be reloaded while serving.
+type NetworkPolicy struct {
+	mu                  sync.RWMutex
+	allow, deny         []netip.Prefix
+	allowList, denyList []string // in CIDR notation, for display
+}
+
+func NewNetworkPolicy(allow, deny []string) (*NetworkPolicy, error) {
+	p := &NetworkPolicy{}
+	if err := p.Reload(allow, deny); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload replaces both lists. Nothing changes unless both parse.
+func (p *NetworkPolicy) Reload(allow, deny []string) error {
+	allowPrefixes, err := parsePrefixes(allow)
+	if err != nil {
+		return fmt.Errorf("invalid allow list: %w", err)
+	}
+	denyPrefixes, err := parsePrefixes(deny)
+	if err != nil {
+		return fmt.Errorf("invalid deny list: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.allow, p.deny = allowPrefixes, denyPrefixes
+	p.allowList, p.denyList = prefixStrings(allowPrefixes), prefixStrings(denyPrefixes)
+	return nil
+}
+
+func prefixStrings(prefixes []netip.Prefix) []string {
+	list := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		list[i] = prefix.String()
+	}
+	return list
+}
+
+// Lists returns the allow and deny lists in CIDR notation.
+func (p *NetworkPolicy) Lists() (allow, deny []string) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]string{}, p.allowList...), append([]string{}, p.denyList...)
+}
+
+// Allowed reports whether requests from ip are admitted. Addresses that do
+// not parse are only admitted when there are no lists at all.
+func (p *NetworkPolicy) Allowed(ip string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	addr, ok := parseHop(ip)
+	if !ok {
+		return len(p.allow) == 0 && len(p.deny) == 0
+	}
+	if containsAddr(p.deny, addr) {
+		return false
+	}
+	return len(p.allow) == 0 || containsAddr(p.allow, addr)
+}
+
+// Middleware rejects requests from addresses the policy does not admit
+// with 403 Forbidden. It must run after TrustedProxies.Middleware so that
+// it sees the resolved client IP.
+func (p *NetworkPolicy) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := ClientIP(r)
+		if !p.Allowed(ip) {
+			slog.Warn("request rejected by network policy", "ip", ip, "path", r.URL.Path)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNetworkPolicy_Allowed(t *testing.T) {
+	p, err := NewNetworkPolicy([]string{"10.0.0.0/8", "2001:db8::/32"}, []string{"10.6.6.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]bool{
+		"10.1.2.3":        true,
+		"10.6.6.6":        false, // denied within the allowed range
+		"192.168.1.1":     false, // not on the allow list
+		"2001:db8::1":     true,
+		"::ffff:10.0.0.1": true,
+		"garbage":         false,
+	}
+	for ip, want := range tests {
+		if got := p.Allowed(ip); got != want {
+			t.Errorf("Allowed(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	// Without an allow list, everything but the deny list is admitted
+	if err := p.Reload(nil, []string{"203.0.113.7"}); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Allowed("192.168.1.1") || p.Allowed("203.0.113.7") {
+		t.Error("expected only the denied address to be rejected after reload")
+	}
+}
+
+func TestNetworkPolicy_ReloadIsAtomic(t *testing.T) {
+	p, _ := NewNetworkPolicy(nil, []string{"203.0.113.7"})
+
+	if err := p.Reload([]string{"10.0.0.0/8"}, []string{"not-a-cidr"}); err == nil {
+		t.Fatal("expected an error for an invalid deny list")
+	}
+	allow, deny := p.Lists()
+	if len(allow) != 0 || len(deny) != 1 || deny[0] != "203.0.113.7/32" {
+		t.Errorf("a failed reload should keep the old lists, got %v %v", allow, deny)
+	}
+}
+
+func TestNetworkPolicy_Middleware(t *testing.T) {
+	p, _ := NewNetworkPolicy(nil, []string{"203.0.113.0/24"})
+	handler := p.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req = req.WithContext(WithClientIP(req.Context(), "203.0.113.7"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/ws", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rec.Code)
+	}
+}
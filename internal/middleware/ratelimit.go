@@ -1,45 +1,134 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
-	"net"
+	"math"
 	"net/http"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/metrics"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+)
+
+// Route classes that get their own rate-limit policy.
+const (
+	PolicyWebSocket = "ws"
+	PolicyStatic    = "static"
+	PolicyAPI       = "api"
 )
 
-type visitor struct {
-	count    int
+// Policy is a token bucket: Limit requests per Period are sustained, and
+// up to Burst requests may be made at once by a client that has been idle.
+type Policy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+	Burst  int // defaults to Limit
+}
+
+// interval is the time it takes to earn one request.
+func (p Policy) interval() time.Duration {
+	return p.Period / time.Duration(p.Limit)
+}
+
+// header describes the policy in the RateLimit-Policy format.
+func (p Policy) header() string {
+	return fmt.Sprintf("%d;w=%d;burst=%d", p.Limit, int(p.Period.Seconds()), p.Burst)
+}
+
+// Decision is the outcome of taking a token for one request.
+type Decision struct {
+	Allowed    bool
+	Limit      int           // the bucket's capacity
+	Remaining  int           // requests that can be made right now
+	RetryAfter time.Duration // until the next request is allowed, when denied
+	Reset      time.Duration // until the bucket is full again
+}
+
+// bucket is a client's state under the GCRA formulation of a token
+// bucket, which keeps only the theoretical arrival time: the bucket is
+// full once tat is in the past and each request pushes tat one interval
+// further.
+type bucket struct {
+	tat      time.Time
 	lastSeen time.Time
+	requests int
+	rejected int
 }
 
+// Shared buckets are abandoned for sharedRetry after a Redis failure, so
+// that an outage costs one timeout rather than one per request.
+const (
+	sharedTimeout = 250 * time.Millisecond
+	sharedRetry   = 5 * time.Second
+)
+
+// RateLimiter limits requests per client IP with a token bucket. Buckets
+// are local to the process unless a shared store is set, in which case
+// local buckets mirror the shared ones and take over while it is down.
 type RateLimiter struct {
-	visitors map[string]*visitor
-	mu       sync.RWMutex
-	limit    int
-	window   time.Duration
+	policy  atomic.Pointer[Policy]
+	mu      sync.Mutex
+	buckets map[string]*bucket
+
+	shared     store.RateLimitStore
+	sharedDown atomic.Int64 // unix nanoseconds until which shared is skipped
 }
 
+// NewRateLimiter allows requestsPerMinute requests per client, all of which
+// may be made at once.
 func NewRateLimiter(requestsPerMinute int) *RateLimiter {
-	rl := &RateLimiter{
-		visitors: make(map[string]*visitor),
-		limit:    requestsPerMinute,
-		window:   time.Minute,
-	}
+	return NewPolicyLimiter(Policy{Name: "default", Limit: requestsPerMinute, Period: time.Minute})
+}
+
+func NewPolicyLimiter(p Policy) *RateLimiter {
+	rl := &RateLimiter{buckets: make(map[string]*bucket)}
+	rl.SetPolicy(p)
 
-	// Cleanup old entries every minute
+	// Cleanup full buckets every minute
 	go rl.cleanup()
 
 	return rl
 }
 
+func (rl *RateLimiter) Policy() Policy {
+	return *rl.policy.Load()
+}
+
+// SetPolicy replaces the policy while serving. Buckets are kept, so
+// clients carry their debt over to the new limits.
+func (rl *RateLimiter) SetPolicy(p Policy) {
+	if p.Limit <= 0 {
+		p.Limit = 1
+	}
+	if p.Period <= 0 {
+		p.Period = time.Minute
+	}
+	if p.Burst <= 0 {
+		p.Burst = p.Limit
+	}
+	rl.policy.Store(&p)
+}
+
+// SetStore shares the buckets with every replica using s.
+func (rl *RateLimiter) SetStore(s store.RateLimitStore) {
+	rl.shared = s
+}
+
 func (rl *RateLimiter) cleanup() {
 	ticker := time.NewTicker(time.Minute)
 	for range ticker.C {
+		now := time.Now()
 		rl.mu.Lock()
-		for ip, v := range rl.visitors {
-			if time.Since(v.lastSeen) > rl.window*2 {
-				delete(rl.visitors, ip)
+		for ip, b := range rl.buckets {
+			if b.tat.Before(now) {
+				delete(rl.buckets, ip)
 			}
 		}
 		rl.mu.Unlock()
@@ -47,82 +136,210 @@ func (rl *RateLimiter) cleanup() {
 }
 
 func (rl *RateLimiter) getIP(r *http.Request) string {
-	// Check X-Forwarded-For header (for proxies/load balancers)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		// Take the first IP in the chain
-		if idx := len(xff); idx > 0 {
-			for i, c := range xff {
-				if c == ',' {
-					return xff[:i]
-				}
-			}
-			return xff
+	return ClientIP(r)
+}
+
+// Allow takes a token for a request from ip and reports whether the
+// request may proceed.
+func (rl *RateLimiter) Allow(ip string) bool {
+	return rl.Take(ip).Allowed
+}
+
+// Take takes a token for a request from ip.
+func (rl *RateLimiter) Take(ip string) Decision {
+	return rl.take(context.Background(), ip)
+}
+
+func (rl *RateLimiter) take(ctx context.Context, ip string) Decision {
+	if rl.shared != nil {
+		if d, ok := rl.takeShared(ctx, ip); ok {
+			return d
 		}
 	}
 
-	// Check X-Real-IP header
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	b := rl.bucket(ip, now)
+	d := rl.Policy().Take(b.tat, now)
+	if d.Allowed {
+		b.tat = now.Add(d.Reset)
+	} else {
+		b.rejected++
+	}
+	return d
+}
+
+// bucket returns the local bucket of ip, counting a request. The caller
+// holds rl.mu.
+func (rl *RateLimiter) bucket(ip string, now time.Time) *bucket {
+	b, ok := rl.buckets[ip]
+	if !ok {
+		b = &bucket{tat: now}
+		rl.buckets[ip] = b
+	}
+	b.lastSeen = now
+	b.requests++
+	return b
+}
+
+// takeShared takes a token from the shared bucket of ip and reports
+// whether the store answered.
+func (rl *RateLimiter) takeShared(ctx context.Context, ip string) (Decision, bool) {
+	if until := rl.sharedDown.Load(); until != 0 && time.Now().UnixNano() < until {
+		return Decision{}, false
 	}
 
-	// Fall back to RemoteAddr
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	policy := rl.Policy()
+	ctx, cancel := context.WithTimeout(ctx, sharedTimeout)
+	interval := policy.interval()
+	res, err := rl.shared.TakeToken(ctx, policy.Name+":"+ip, interval, time.Duration(policy.Burst)*interval)
+	cancel()
 	if err != nil {
-		return r.RemoteAddr
+		if rl.sharedDown.Swap(time.Now().Add(sharedRetry).UnixNano()) == 0 {
+			slog.Warn("shared rate limiting unavailable, limiting locally", "error", err, "policy", policy.Name)
+		}
+		return Decision{}, false
+	}
+	if rl.sharedDown.Swap(0) != 0 {
+		slog.Info("shared rate limiting restored", "policy", policy.Name)
 	}
-	return ip
-}
 
-func (rl *RateLimiter) Allow(ip string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+	d := Decision{Allowed: res.Allowed, Limit: policy.Burst, Reset: res.Reset, RetryAfter: res.RetryAfter}
 
-	v, exists := rl.visitors[ip]
+	// Mirror the shared bucket locally, for Visitors and for a fallback
+	// that starts where the shared bucket left off
+	rl.mu.Lock()
 	now := time.Now()
+	b := rl.bucket(ip, now)
+	b.tat = now.Add(res.Reset)
+	if res.Allowed {
+		d.Remaining = policy.remaining(b, now)
+	} else {
+		b.rejected++
+	}
+	rl.mu.Unlock()
+	return d, true
+}
 
-	if !exists {
-		rl.visitors[ip] = &visitor{count: 1, lastSeen: now}
-		return true
+// Take applies GCRA to a bucket with the theoretical arrival time tat.
+// When the request is allowed, the new tat is now plus the returned
+// Reset.
+func (p Policy) Take(tat, now time.Time) Decision {
+	interval := p.interval()
+	capacity := time.Duration(p.Burst) * interval
+
+	if tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(interval)
+	d := Decision{Limit: p.Burst}
+
+	// The request fits if the bucket would hold at most Burst requests
+	if allowAt := next.Add(-capacity); now.Before(allowAt) {
+		d.RetryAfter = allowAt.Sub(now)
+		d.Reset = tat.Sub(now)
+		return d
 	}
 
-	// Reset counter if window has passed
-	if now.Sub(v.lastSeen) > rl.window {
-		v.count = 1
-		v.lastSeen = now
+	d.Allowed = true
+	d.Reset = next.Sub(now)
+	d.Remaining = int((capacity - d.Reset) / interval)
+	return d
+}
+
+// remaining returns the requests b allows at now without taking any.
+func (p Policy) remaining(b *bucket, now time.Time) int {
+	used := b.tat.Sub(now)
+	if used < 0 {
+		used = 0
+	}
+	return int((time.Duration(p.Burst)*p.interval() - used) / p.interval())
+}
+
+// Visitor is a client address tracked by the rate limiter.
+type Visitor struct {
+	IP        string    `json:"ip"`
+	Policy    string    `json:"policy"`
+	Requests  int       `json:"requests"`
+	Rejected  int       `json:"rejected"`
+	Remaining int       `json:"remaining"`
+	LastSeen  time.Time `json:"last_seen"`
+	Limited   bool      `json:"limited"` // no requests remain right now
+}
+
+// Visitors returns the tracked visitors, busiest first.
+func (rl *RateLimiter) Visitors() []Visitor {
+	rl.mu.Lock()
+	visitors := make([]Visitor, 0, len(rl.buckets))
+	now := time.Now()
+	policy := rl.Policy()
+	for ip, b := range rl.buckets {
+		remaining := policy.remaining(b, now)
+		visitors = append(visitors, Visitor{
+			IP:        ip,
+			Policy:    policy.Name,
+			Requests:  b.requests,
+			Rejected:  b.rejected,
+			Remaining: remaining,
+			LastSeen:  b.lastSeen,
+			Limited:   remaining < 1,
+		})
+	}
+	rl.mu.Unlock()
+
+	sort.Slice(visitors, func(i, j int) bool {
+		if visitors[i].Requests != visitors[j].Requests {
+			return visitors[i].Requests > visitors[j].Requests
+		}
+		return visitors[i].IP < visitors[j].IP
+	})
+	return visitors
+}
+
+// limit takes a token for r, sets the RateLimit headers and, when the
+// request is denied, writes a 429 with Retry-After and returns false.
+func (rl *RateLimiter) limit(w http.ResponseWriter, r *http.Request) bool {
+	ip := rl.getIP(r)
+	policy := rl.Policy()
+	d := rl.take(r.Context(), ip)
+
+	h := w.Header()
+	h.Set("RateLimit-Policy", policy.header())
+	h.Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	h.Set("RateLimit-Reset", seconds(d.Reset))
+	if d.Allowed {
 		return true
 	}
 
-	v.lastSeen = now
-	v.count++
+	metrics.RateLimited.WithLabelValues(policy.Name).Inc()
+	slog.Warn("rate limit exceeded", "ip", ip, "path", r.URL.Path, "policy", policy.Name)
+	h.Set("Retry-After", seconds(d.RetryAfter))
+	http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+	return false
+}
 
-	return v.count <= rl.limit
+// seconds formats d as whole seconds, rounded up so that clients do not
+// retry too early.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
 }
 
 func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := rl.getIP(r)
-
-		if !rl.Allow(ip) {
-			slog.Warn("rate limit exceeded", "ip", ip, "path", r.URL.Path)
-			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
-			return
+		if rl.limit(w, r) {
+			next.ServeHTTP(w, r)
 		}
-
-		next.ServeHTTP(w, r)
 	})
 }
 
 // MiddlewareFunc returns middleware compatible with gorilla/mux
 func (rl *RateLimiter) MiddlewareFunc(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ip := rl.getIP(r)
-
-		if !rl.Allow(ip) {
-			slog.Warn("rate limit exceeded", "ip", ip, "path", r.URL.Path)
-			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
-			return
+		if rl.limit(w, r) {
+			next(w, r)
 		}
-
-		next(w, r)
 	}
 }
@@ -4,6 +4,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/metrics"
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestRateLimiter_Allow(t *testing.T) {
@@ -42,6 +48,7 @@ func TestRateLimiter_DifferentIPs(t *testing.T) {
 
 func TestRateLimiter_Middleware(t *testing.T) {
 	rl := NewRateLimiter(2)
+	rejected := testutil.ToFloat64(metrics.RateLimited.WithLabelValues("default"))
 
 	handler := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -69,30 +76,169 @@ func TestRateLimiter_Middleware(t *testing.T) {
 	if rec.Code != http.StatusTooManyRequests {
 		t.Errorf("expected 429, got %d", rec.Code)
 	}
+	if got := testutil.ToFloat64(metrics.RateLimited.WithLabelValues("default")); got != rejected+1 {
+		t.Errorf("expected one rate-limit rejection to be counted, got %v", got-rejected)
+	}
 }
 
-func TestRateLimiter_XForwardedFor(t *testing.T) {
+func TestRateLimiter_IgnoresUntrustedProxyHeaders(t *testing.T) {
 	rl := NewRateLimiter(1)
 
 	req := httptest.NewRequest("GET", "/", nil)
 	req.Header.Set("X-Forwarded-For", "10.0.0.1, 192.168.1.1")
+	req.Header.Set("X-Real-IP", "10.0.0.1")
 	req.RemoteAddr = "127.0.0.1:12345"
 
-	ip := rl.getIP(req)
-	if ip != "10.0.0.1" {
-		t.Errorf("expected IP from X-Forwarded-For, got %s", ip)
+	if ip := rl.getIP(req); ip != "127.0.0.1" {
+		t.Errorf("expected the peer address, got %s", ip)
 	}
 }
 
-func TestRateLimiter_XRealIP(t *testing.T) {
+func TestRateLimiter_UsesResolvedClientIP(t *testing.T) {
 	rl := NewRateLimiter(1)
 
 	req := httptest.NewRequest("GET", "/", nil)
-	req.Header.Set("X-Real-IP", "10.0.0.1")
 	req.RemoteAddr = "127.0.0.1:12345"
+	req = req.WithContext(WithClientIP(req.Context(), "10.0.0.1"))
+
+	if ip := rl.getIP(req); ip != "10.0.0.1" {
+		t.Errorf("expected IP from the request context, got %s", ip)
+	}
+}
+
+func TestRateLimiter_Visitors(t *testing.T) {
+	rl := NewRateLimiter(2)
+	rl.Allow("10.0.0.1")
+	for range 3 {
+		rl.Allow("10.0.0.2")
+	}
+
+	visitors := rl.Visitors()
+	if len(visitors) != 2 {
+		t.Fatalf("expected 2 visitors, got %d", len(visitors))
+	}
+	if visitors[0].IP != "10.0.0.2" || visitors[0].Requests != 3 || !visitors[0].Limited {
+		t.Errorf("expected the limited visitor first, got %+v", visitors[0])
+	}
+	if visitors[1].Limited || visitors[1].LastSeen.IsZero() {
+		t.Errorf("unexpected visitor %+v", visitors[1])
+	}
+}
+
+func TestPolicy_TokenBucket(t *testing.T) {
+	p := Policy{Limit: 60, Period: time.Minute, Burst: 3}
+	b := &bucket{}
+	now := time.Now()
+
+	take := func(at time.Time) Decision {
+		d := p.Take(b.tat, at)
+		if d.Allowed {
+			b.tat = at.Add(d.Reset)
+		}
+		return d
+	}
+
+	// An idle client may burst up to the capacity
+	for i, want := range []int{2, 1, 0} {
+		if d := take(now); !d.Allowed || d.Remaining != want {
+			t.Fatalf("request %d: expected allowed with %d remaining, got %+v", i+1, want, d)
+		}
+	}
+	d := take(now)
+	if d.Allowed || d.RetryAfter != time.Second || d.Reset != 3*time.Second {
+		t.Fatalf("expected a one-second retry, got %+v", d)
+	}
+
+	// Tokens come back at the sustained rate, however often the client
+	// keeps trying
+	if d := take(now.Add(500 * time.Millisecond)); d.Allowed {
+		t.Error("no token should be available yet")
+	}
+	if d := take(now.Add(time.Second)); !d.Allowed || d.Remaining != 0 {
+		t.Errorf("expected one token after a second, got %+v", d)
+	}
+	if d := take(now.Add(10 * time.Second)); !d.Allowed || d.Remaining != 2 {
+		t.Errorf("expected a full bucket after idling, got %+v", d)
+	}
+}
+
+func TestRateLimiter_Headers(t *testing.T) {
+	rl := NewPolicyLimiter(Policy{Name: PolicyAPI, Limit: 60, Period: time.Minute, Burst: 2})
+	handler := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.168.1.1:12345"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send()
+	if rec.Header().Get("RateLimit-Limit") != "2" || rec.Header().Get("RateLimit-Remaining") != "1" ||
+		rec.Header().Get("RateLimit-Reset") != "1" || rec.Header().Get("RateLimit-Policy") != "60;w=60;burst=2" {
+		t.Errorf("unexpected headers %v", rec.Header())
+	}
+	if rec.Header().Get("Retry-After") != "" {
+		t.Error("allowed requests should not have Retry-After")
+	}
+
+	send()
+	rec = send()
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" ||
+		rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("expected 429 with Retry-After, got %d %v", rec.Code, rec.Header())
+	}
+}
+
+func TestRateLimiter_SharedStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s, err := store.NewRedisStore("redis://"+mr.Addr(), 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Two replicas share one bucket per client
+	policy := Policy{Name: PolicyAPI, Limit: 60, Period: time.Minute, Burst: 2}
+	replica1, replica2 := NewPolicyLimiter(policy), NewPolicyLimiter(policy)
+	replica1.SetStore(s)
+	replica2.SetStore(s)
+
+	if !replica1.Allow("10.0.0.1") || !replica2.Allow("10.0.0.1") {
+		t.Fatal("the first two requests should be allowed")
+	}
+	d := replica1.Take("10.0.0.1")
+	if d.Allowed || d.RetryAfter <= 0 {
+		t.Errorf("the shared burst should be used up, got %+v", d)
+	}
+	if v := replica1.Visitors(); len(v) != 1 || v[0].Requests != 2 || !v[0].Limited {
+		t.Errorf("expected the local view to mirror the shared bucket, got %+v", v)
+	}
+
+	// Without Redis each replica falls back to its own bucket
+	mr.Close()
+	if !replica2.Allow("10.0.0.2") || !replica2.Allow("10.0.0.2") || replica2.Allow("10.0.0.2") {
+		t.Error("expected local limiting while Redis is down")
+	}
+	if replica2.sharedDown.Load() == 0 {
+		t.Error("the shared store should be skipped after a failure")
+	}
+}
 
-	ip := rl.getIP(req)
-	if ip != "10.0.0.1" {
-		t.Errorf("expected IP from X-Real-IP, got %s", ip)
+func TestRateLimiter_SetPolicy(t *testing.T) {
+	rl := NewRateLimiter(2)
+	rl.SetPolicy(Policy{Name: PolicyAPI, Limit: 60, Burst: 5})
+
+	if p := rl.Policy(); p.Name != PolicyAPI || p.Period != time.Minute || p.Burst != 5 {
+		t.Errorf("unexpected policy %+v", p)
+	}
+	for i := 0; i < 5; i++ {
+		if !rl.Allow("192.168.1.1") {
+			t.Errorf("request %d should be allowed by the new burst", i+1)
+		}
+	}
+	if rl.Allow("192.168.1.1") {
+		t.Error("6th request should be rate limited")
 	}
 }
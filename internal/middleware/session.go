@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+const SessionCookie = "chat_session"
+
+type sessionPayload struct {
+	Username string   `json:"u"`
+	Roles    []string `json:"r,omitempty"`
+	Rooms    []string `json:"m,omitempty"`
+	Expires  int64    `json:"exp"`
+}
+
+// Sessions issues and validates signed session cookies carrying an
+// Identity, so that browser clients logged in through SSO can connect
+// without handling tokens themselves.
+type Sessions struct {
+	signer *Signer
+	ttl    time.Duration
+	secure bool
+}
+
+// NewSessions returns Sessions that seal cookies with a key derived from
+// signer for sessions only.
+func NewSessions(signer *Signer, ttl time.Duration, secure bool) *Sessions {
+	return &Sessions{signer: signer.Purpose("session"), ttl: ttl, secure: secure}
+}
+
+// Issue sets a session cookie for id on w.
+func (s *Sessions) Issue(w http.ResponseWriter, id *Identity) error {
+	expires := time.Now().Add(s.ttl)
+	value, err := s.signer.Seal(sessionPayload{
+		Username: id.Username,
+		Roles:    id.Roles,
+		Rooms:    id.Rooms,
+		Expires:  expires.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   s.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func (s *Sessions) Clear(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   s.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Authenticate implements Authenticator.
+func (s *Sessions) Authenticate(r *http.Request) (*Identity, error) {
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil || cookie.Value == "" {
+		return nil, ErrNoCredentials
+	}
+
+	var p sessionPayload
+	if err := s.signer.Unseal(cookie.Value, &p); err != nil {
+		return nil, err
+	}
+	if time.Now().Unix() > p.Expires {
+		return nil, errors.New("session expired")
+	}
+	if p.Username == "" {
+		return nil, errors.New("session has no username")
+	}
+
+	return &Identity{Username: p.Username, Roles: p.Roles, Rooms: p.Rooms}, nil
+}
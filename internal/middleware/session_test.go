@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// withCookie returns a request carrying value as the session cookie.
+func withCookie(value string) *http.Request {
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req.AddCookie(&http.Cookie{Name: SessionCookie, Value: value})
+	return req
+}
+
+func TestSessions_IssueAndAuthenticate(t *testing.T) {
+	sessions := NewSessions(NewSigner("test-secret"), time.Hour, false)
+
+	rec := httptest.NewRecorder()
+	if err := sessions.Issue(rec, &Identity{Username: "alice", Roles: []string{"admin"}}); err != nil {
+		t.Fatal(err)
+	}
+	cookie := rec.Result().Cookies()[0]
+	if !cookie.HttpOnly || cookie.Name != SessionCookie {
+		t.Errorf("unexpected cookie %+v", cookie)
+	}
+
+	id, err := sessions.Authenticate(withCookie(cookie.Value))
+	if err != nil || id.Username != "alice" || !id.HasRole("admin") {
+		t.Errorf("unexpected identity %+v (err %v)", id, err)
+	}
+
+	if _, err := sessions.Authenticate(httptest.NewRequest("GET", "/ws", nil)); err != ErrNoCredentials {
+		t.Errorf("expected ErrNoCredentials without a cookie, got %v", err)
+	}
+}
+
+func TestSessions_RejectsForgedCookies(t *testing.T) {
+	signer := NewSigner("test-secret")
+	sessions := NewSessions(signer, time.Hour, false)
+	forge := func(s *Signer, v any) string {
+		t.Helper()
+		value, err := s.Seal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+	future := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"tampered", forge(signer.Purpose("session"), sessionPayload{Username: "alice", Expires: future}) + "x"},
+		{"other secret", forge(NewSigner("other-secret").Purpose("session"), sessionPayload{Username: "alice", Expires: future})},
+		{"expired", forge(signer.Purpose("session"), sessionPayload{Username: "alice", Expires: time.Now().Add(-time.Minute).Unix()})},
+		{"no username", forge(signer.Purpose("session"), sessionPayload{Expires: future})},
+		// Tokens of other features signed with the same secret
+		{"unbound signer", forge(signer, sessionPayload{Username: "alice", Expires: future})},
+		{"oidc flow", forge(signer.Purpose("oidc-flow"), map[string]any{"s": "state", "n": "nonce", "v": "verifier", "exp": future})},
+		{"invite", forge(signer.Purpose("invite"), map[string]any{"id": "abc", "room": "ops", "exp": future})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if id, err := sessions.Authenticate(withCookie(tt.value)); err == nil {
+				t.Errorf("expected the cookie to be rejected, got %+v", id)
+			}
+		})
+	}
+}
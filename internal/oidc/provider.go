@@ -0,0 +1,341 @@
+// Package oidc implements the OpenID Connect authorization-code flow with
+// PKCE for the web client. A successful login is turned into a session
+// cookie that middleware.Auth accepts on /ws.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	flowCookie = "chat_oidc_flow"
+	flowTTL    = 10 * time.Minute
+)
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // empty for public clients
+	RedirectURL  string
+	Scopes       []string
+	AfterLogin   string // where the browser goes once logged in
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// flowState is kept in a signed cookie between /auth/login and the callback.
+type flowState struct {
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	Expires  int64  `json:"exp"`
+}
+
+type idTokenClaims struct {
+	Nonce             string   `json:"nonce"`
+	PreferredUsername string   `json:"preferred_username"`
+	Name              string   `json:"name"`
+	Email             string   `json:"email"`
+	Roles             []string `json:"roles"`
+	Rooms             []string `json:"rooms"`
+	jwt.RegisteredClaims
+}
+
+type Provider struct {
+	cfg      Config
+	meta     discovery
+	client   *http.Client
+	signer   *middleware.Signer
+	sessions *middleware.Sessions
+
+	mu   sync.Mutex
+	jwks *middleware.JWKS
+}
+
+// NewProvider fetches the issuer's discovery document. The flow cookie is
+// sealed with a key derived from signer for that purpose, so it may share
+// the sessions' signer.
+func NewProvider(ctx context.Context, cfg Config, signer *middleware.Signer, sessions *middleware.Sessions) (*Provider, error) {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	if cfg.AfterLogin == "" {
+		cfg.AfterLogin = "/chat.html"
+	}
+
+	p := &Provider{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		signer:   signer.Purpose("oidc-flow"),
+		sessions: sessions,
+	}
+
+	wellKnown := strings.TrimSuffix(cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &p.meta); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if p.meta.Issuer != cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer mismatch %q", p.meta.Issuer)
+	}
+
+	slog.Info("OIDC login enabled", "issuer", cfg.Issuer)
+	return p, nil
+}
+
+// Login redirects the browser to the provider's authorization endpoint.
+func (p *Provider) Login(w http.ResponseWriter, r *http.Request) {
+	flow := flowState{
+		State:    randomString(),
+		Nonce:    randomString(),
+		Verifier: randomString() + randomString(),
+		Expires:  time.Now().Add(flowTTL).Unix(),
+	}
+	value, err := p.signer.Seal(flow)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     flowCookie,
+		Value:    value,
+		Path:     "/auth/",
+		MaxAge:   int(flowTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(p.cfg.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	challenge := sha256.Sum256([]byte(flow.Verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {flow.State},
+		"nonce":                 {flow.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	http.Redirect(w, r, p.meta.AuthorizationEndpoint+"?"+q.Encode(), http.StatusFound)
+}
+
+// Callback completes the login: it exchanges the code, verifies the ID
+// token and issues the session cookie.
+func (p *Provider) Callback(w http.ResponseWriter, r *http.Request) {
+	var flow flowState
+	cookie, err := r.Cookie(flowCookie)
+	if err != nil || p.signer.Unseal(cookie.Value, &flow) != nil || time.Now().Unix() > flow.Expires {
+		http.Error(w, "Login session expired, please try again", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: flowCookie, Path: "/auth/", MaxAge: -1})
+
+	if e := r.URL.Query().Get("error"); e != "" {
+		slog.Warn("OIDC login failed", "error", e, "description", r.URL.Query().Get("error_description"))
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Query().Get("state") != flow.State {
+		http.Error(w, "Invalid state", http.StatusBadRequest)
+		return
+	}
+
+	rawIDToken, err := p.exchange(r.Context(), r.URL.Query().Get("code"), flow.Verifier)
+	if err != nil {
+		slog.Warn("OIDC code exchange failed", "error", err)
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := p.verify(r.Context(), rawIDToken, flow.Nonce)
+	if err != nil {
+		slog.Warn("OIDC ID token rejected", "error", err)
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+
+	if err := p.sessions.Issue(w, id); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("OIDC login", "username", id.Username)
+	http.Redirect(w, r, p.cfg.AfterLogin, http.StatusFound)
+}
+
+func (p *Provider) Logout(w http.ResponseWriter, r *http.Request) {
+	p.sessions.Clear(w)
+	http.Redirect(w, r, p.cfg.AfterLogin, http.StatusFound)
+}
+
+// Me returns the identity of the current session, or 401 with sso=true so
+// the web client knows to offer the login button.
+func (p *Provider) Me(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	id, err := p.sessions.Authenticate(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"sso": true})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"username": id.Username,
+		"roles":    id.Roles,
+		"rooms":    id.Rooms,
+	})
+}
+
+func (p *Provider) exchange(ctx context.Context, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, body)
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.IDToken == "" {
+		return "", errors.New("token response has no id_token")
+	}
+	return token.IDToken, nil
+}
+
+func (p *Provider) verify(ctx context.Context, raw, nonce string) (*middleware.Identity, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (any, error) {
+		return p.key(ctx, t)
+	},
+		jwt.WithValidMethods([]string{"RS256", "ES256"}),
+		jwt.WithIssuer(p.meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("nonce mismatch")
+	}
+
+	username := claims.PreferredUsername
+	for _, alt := range []string{claims.Name, claims.Email, claims.Subject} {
+		if username == "" {
+			username = alt
+		}
+	}
+
+	return &middleware.Identity{Username: username, Roles: claims.Roles, Rooms: claims.Rooms}, nil
+}
+
+// key looks up the signing key, refetching the provider's JWKS once when
+// the key id is unknown so that key rotation is picked up.
+func (p *Provider) key(ctx context.Context, t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	alg := t.Method.Alg()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.jwks != nil {
+		if key, ok := p.jwks.Key(kid, alg); ok {
+			return key, nil
+		}
+	}
+
+	resp, err := p.get(ctx, p.meta.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	jwks, err := middleware.ParseJWKS(resp)
+	if err != nil {
+		return nil, err
+	}
+	p.jwks = jwks
+
+	if key, ok := jwks.Key(kid, alg); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("no %s key for kid %q", alg, kid)
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v any) error {
+	data, err := p.get(ctx, url)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (p *Provider) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
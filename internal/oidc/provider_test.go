@@ -0,0 +1,220 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/middleware"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockProvider is a minimal OpenID provider that issues a code for every
+// authorization request and checks the PKCE verifier on exchange.
+type mockProvider struct {
+	t        *testing.T
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	challenge string
+	nonce     string
+	badNonce  bool
+}
+
+func newMockProvider(t *testing.T, clientID string) *mockProvider {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	m := &mockProvider{t: t, key: key, clientID: clientID}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("code_challenge_method") != "S256" {
+			t.Errorf("expected S256 challenge, got %q", q.Get("code_challenge_method"))
+		}
+		m.challenge = q.Get("code_challenge")
+		m.nonce = q.Get("nonce")
+
+		redirect, _ := url.Parse(q.Get("redirect_uri"))
+		redirect.RawQuery = url.Values{"code": {"auth-code"}, "state": {q.Get("state")}}.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Get("code") != "auth-code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		nonce := m.nonce
+		if m.badNonce {
+			nonce = "replayed"
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":                m.server.URL,
+			"aud":                m.clientID,
+			"sub":                "user-42",
+			"preferred_username": "alice",
+			"roles":              []string{"admin"},
+			"nonce":              nonce,
+			"exp":                time.Now().Add(time.Hour).Unix(),
+		})
+		token.Header["kid"] = "mock-1"
+		signed, _ := token.SignedString(m.key)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "mock-1", "alg": "RS256", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}}})
+	})
+
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func newTestProvider(t *testing.T, m *mockProvider) (*Provider, *middleware.Sessions) {
+	signer := middleware.NewSigner("test-secret")
+	sessions := middleware.NewSessions(signer, time.Hour, false)
+
+	p, err := NewProvider(context.Background(), Config{
+		Issuer:      m.server.URL,
+		ClientID:    m.clientID,
+		RedirectURL: "http://chat.test/auth/callback",
+	}, signer, sessions)
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+	return p, sessions
+}
+
+// login runs the browser side of the flow and returns the callback response.
+func login(t *testing.T, p *Provider, m *mockProvider) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	p.Login(rec, httptest.NewRequest("GET", "/auth/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("expected redirect to provider, got %d", rec.Code)
+	}
+	flow := rec.Result().Cookies()[0]
+
+	// Follow the redirect to the mock authorization endpoint
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	callback := httptest.NewRequest("GET", resp.Header.Get("Location"), nil)
+	callback.AddCookie(flow)
+	rec = httptest.NewRecorder()
+	p.Callback(rec, callback)
+	return rec
+}
+
+func TestProvider_LoginFlow(t *testing.T) {
+	m := newMockProvider(t, "chat-web")
+	p, sessions := newTestProvider(t, m)
+
+	rec := login(t, p, m)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/chat.html" {
+		t.Fatalf("expected redirect to /chat.html, got %d %s", rec.Code, rec.Header().Get("Location"))
+	}
+
+	var session *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == middleware.SessionCookie {
+			session = c
+		}
+	}
+	if session == nil {
+		t.Fatal("expected a session cookie")
+	}
+
+	// The session authenticates the WebSocket handshake
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req.AddCookie(session)
+	id, err := sessions.Authenticate(req)
+	if err != nil {
+		t.Fatalf("session rejected: %v", err)
+	}
+	if id.Username != "alice" || !id.HasRole("admin") {
+		t.Errorf("unexpected identity %+v", id)
+	}
+
+	// /auth/me reports the identity
+	rec = httptest.NewRecorder()
+	p.Me(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200 from /auth/me, got %d", rec.Code)
+	}
+}
+
+func TestProvider_RejectsNonceMismatch(t *testing.T) {
+	m := newMockProvider(t, "chat-web")
+	m.badNonce = true
+	p, _ := newTestProvider(t, m)
+
+	rec := login(t, p, m)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", rec.Code)
+	}
+}
+
+func TestProvider_RejectsForgedState(t *testing.T) {
+	m := newMockProvider(t, "chat-web")
+	p, _ := newTestProvider(t, m)
+
+	rec := httptest.NewRecorder()
+	p.Login(rec, httptest.NewRequest("GET", "/auth/login", nil))
+	flow := rec.Result().Cookies()[0]
+
+	callback := httptest.NewRequest("GET", "/auth/callback?code=auth-code&state=forged", nil)
+	callback.AddCookie(flow)
+	rec = httptest.NewRecorder()
+	p.Callback(rec, callback)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestProvider_MeWithoutSession(t *testing.T) {
+	m := newMockProvider(t, "chat-web")
+	p, _ := newTestProvider(t, m)
+
+	rec := httptest.NewRecorder()
+	p.Me(rec, httptest.NewRequest("GET", "/auth/me", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,184 @@
+// Package origin matches browser origins against the allowed-origin
+// patterns of the configuration. A pattern of "*" allows any origin;
+// otherwise patterns look like:
+//
+//	https://chat.example.com   exactly this origin, on the default port
+//	https://*.up.railway.app   any subdomain, but not the domain itself
+//	http://localhost:*         any port
+//	example.com                either scheme, on its default port
+//	re:^https://pr-\d+\.example\.com$
+//	                           a regular expression on the whole origin
+//
+// Schemes and hosts are compared case-insensitively, and a port equal to
+// the scheme's default is the same as no port.
+package origin
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const regexPrefix = "re:"
+
+var defaultPorts = map[string]string{"http": "80", "https": "443", "ws": "80", "wss": "443"}
+
+// Allowed reports whether origin matches any of patterns.
+func Allowed(patterns []string, origin string) bool {
+	for _, pattern := range patterns {
+		if Match(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether origin matches pattern. Invalid patterns match
+// nothing; Validate reports them.
+func Match(pattern, origin string) bool {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "*" {
+		return true
+	}
+	if expr, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+		re, err := compile(expr)
+		return err == nil && re.MatchString(origin)
+	}
+
+	p, err := parsePattern(pattern)
+	if err != nil {
+		return false
+	}
+	o, ok := parseOrigin(origin)
+	if !ok {
+		return false
+	}
+
+	if p.scheme != "" && p.scheme != o.scheme {
+		return false
+	}
+	if p.subdomains {
+		if !strings.HasSuffix(o.host, "."+p.host) {
+			return false
+		}
+	} else if o.host != p.host {
+		return false
+	}
+	switch p.port {
+	case "*":
+		return true
+	case "":
+		return o.port == defaultPorts[o.scheme]
+	default:
+		return o.port == p.port
+	}
+}
+
+// Exact reports whether pattern names a single origin: a scheme and a host
+// without wildcards, on a given or the default port. Only such origins may
+// be trusted with credentials.
+func Exact(pattern string) bool {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "*" || strings.HasPrefix(pattern, regexPrefix) {
+		return false
+	}
+	p, err := parsePattern(pattern)
+	return err == nil && p.scheme != "" && !p.subdomains && p.port != "*"
+}
+
+// Validate returns an error when pattern cannot match any origin.
+func Validate(pattern string) error {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "*" {
+		return nil
+	}
+	if expr, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+		if _, err := compile(expr); err != nil {
+			return fmt.Errorf("origin pattern %q: %w", pattern, err)
+		}
+		return nil
+	}
+	if _, err := parsePattern(pattern); err != nil {
+		return fmt.Errorf("origin pattern %q: %w", pattern, err)
+	}
+	return nil
+}
+
+type hostPattern struct {
+	scheme     string // "" matches any scheme
+	host       string
+	subdomains bool   // host was given as *.host
+	port       string // "" is the scheme's default, "*" any port
+}
+
+func parsePattern(pattern string) (hostPattern, error) {
+	var p hostPattern
+	rest := strings.ToLower(pattern)
+	if scheme, hostport, ok := strings.Cut(rest, "://"); ok {
+		if _, known := defaultPorts[scheme]; !known {
+			return p, fmt.Errorf("unsupported scheme %q", scheme)
+		}
+		p.scheme, rest = scheme, hostport
+	}
+	if strings.ContainsAny(rest, "/?#") {
+		return p, fmt.Errorf("origins have no path")
+	}
+
+	host, port := rest, ""
+	if h, pt, err := net.SplitHostPort(rest); err == nil {
+		host, port = h, pt
+	}
+	if port != "" && port != "*" && port == defaultPorts[p.scheme] {
+		port = ""
+	}
+	p.port = port
+
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if h, ok := strings.CutPrefix(host, "*."); ok {
+		host, p.subdomains = h, true
+	}
+	if host == "" || strings.Contains(host, "*") {
+		return p, fmt.Errorf("wildcards are only allowed as a leading *. or as the port")
+	}
+	p.host = host
+	return p, nil
+}
+
+type parsedOrigin struct {
+	scheme, host, port string
+}
+
+func parseOrigin(origin string) (parsedOrigin, bool) {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return parsedOrigin{}, false
+	}
+	o := parsedOrigin{
+		scheme: strings.ToLower(u.Scheme),
+		host:   strings.ToLower(u.Hostname()),
+		port:   u.Port(),
+	}
+	if o.port == "" {
+		o.port = defaultPorts[o.scheme]
+	}
+	return o, true
+}
+
+// Regular expressions are compiled once; patterns come from the
+// configuration, so the cache stays small.
+var regexps sync.Map // string -> *regexp.Regexp
+
+func compile(expr string) (*regexp.Regexp, error) {
+	if re, ok := regexps.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, err
+	}
+	regexps.Store(expr, re)
+	return re, nil
+}
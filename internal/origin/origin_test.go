@@ -0,0 +1,64 @@
+package origin
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, origin string
+		want            bool
+	}{
+		{"*", "https://anything.example", true},
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "https://EXAMPLE.com:443", true},
+		{"https://example.com", "http://example.com", false},
+		{"https://example.com", "https://example.com:8443", false},
+		{"https://example.com:443", "https://example.com", true},
+		{"https://*.up.railway.app", "https://pr-12.up.railway.app", true},
+		{"https://*.up.railway.app", "https://a.b.up.railway.app", true},
+		{"https://*.up.railway.app", "https://up.railway.app", false},
+		{"https://*.up.railway.app", "https://evilup.railway.app", false},
+		{"https://*.up.railway.app", "https://up.railway.app.evil.com", false},
+		{"http://localhost:*", "http://localhost:3000", true},
+		{"http://localhost:*", "https://localhost:3000", false},
+		{"http://localhost:3000", "http://localhost:3001", false},
+		{"example.com", "http://example.com", true},
+		{"example.com", "https://example.com", true},
+		{"example.com", "https://example.com:8443", false},
+		{"http://[::1]:*", "http://[::1]:8080", true},
+		{`re:https://pr-\d+\.example\.com`, "https://pr-7.example.com", true},
+		{`re:https://pr-\d+\.example\.com`, "https://pr-7.example.com.evil.com", false},
+		{"https://example.com", "null", false},
+		{"https://exa*mple.com", "https://example.com", false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.origin); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, pattern := range []string{"*", "https://*.example.com", "http://localhost:*", "example.com", `re:^https://.*$`} {
+		if err := Validate(pattern); err != nil {
+			t.Errorf("Validate(%q): %v", pattern, err)
+		}
+	}
+	for _, pattern := range []string{"ftp://example.com", "https://example.com/path", "https://exa*mple.com", "re:(", "https://"} {
+		if err := Validate(pattern); err == nil {
+			t.Errorf("Validate(%q) should fail", pattern)
+		}
+	}
+}
+
+func TestExact(t *testing.T) {
+	for _, pattern := range []string{"https://chat.example.com", "http://localhost:8080", "HTTPS://Example.com:443"} {
+		if !Exact(pattern) {
+			t.Errorf("Exact(%q) should hold", pattern)
+		}
+	}
+	for _, pattern := range []string{"*", "https://*.example.com", "http://localhost:*", "example.com", `re:^https://a\.com$`, "ftp://a.com"} {
+		if Exact(pattern) {
+			t.Errorf("Exact(%q) should not hold", pattern)
+		}
+	}
+}
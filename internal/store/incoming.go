@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// IncomingWebhook lets an external system post into a room. Only the hash
+// of its token is stored.
+type IncomingWebhook struct {
+	ID        string    `json:"id"`
+	Room      string    `json:"room"`
+	Name      string    `json:"name"` // display name of the messages
+	TokenHash string    `json:"token_hash"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type IncomingWebhookStore interface {
+	ListIncomingWebhooks(ctx context.Context, room string) ([]IncomingWebhook, error)
+	GetIncomingWebhook(ctx context.Context, id string) (*IncomingWebhook, error)
+	PutIncomingWebhook(ctx context.Context, w IncomingWebhook) error
+	DeleteIncomingWebhook(ctx context.Context, id string) error
+}
+
+func (s *RedisStore) incomingWebhooksKey() string {
+	return "chat:webhooks:incoming"
+}
+
+func (s *RedisStore) ListIncomingWebhooks(ctx context.Context, room string) ([]IncomingWebhook, error) {
+	data, err := s.client.HGetAll(ctx, s.incomingWebhooksKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var hooks []IncomingWebhook
+	for _, v := range data {
+		var w IncomingWebhook
+		if err := json.Unmarshal([]byte(v), &w); err != nil || w.Room != room {
+			continue
+		}
+		hooks = append(hooks, w)
+	}
+	sortIncomingWebhooks(hooks)
+	return hooks, nil
+}
+
+func (s *RedisStore) GetIncomingWebhook(ctx context.Context, id string) (*IncomingWebhook, error) {
+	data, err := s.client.HGet(ctx, s.incomingWebhooksKey(), id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var w IncomingWebhook
+	if err := json.Unmarshal(data, &w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (s *RedisStore) PutIncomingWebhook(ctx context.Context, w IncomingWebhook) error {
+	data, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, s.incomingWebhooksKey(), w.ID, data).Err()
+}
+
+func (s *RedisStore) DeleteIncomingWebhook(ctx context.Context, id string) error {
+	n, err := s.client.HDel(ctx, s.incomingWebhooksKey(), id).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func sortIncomingWebhooks(hooks []IncomingWebhook) {
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].CreatedAt.Before(hooks[j].CreatedAt) })
+}
@@ -0,0 +1,191 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrInviteExpired   = errors.New("invite expired")
+	ErrInviteRevoked   = errors.New("invite revoked")
+	ErrInviteExhausted = errors.New("invite has no uses left")
+	ErrInviteUsed      = errors.New("invite already redeemed")
+)
+
+// Invite is the server-side record of an invite link. The link itself is a
+// signed token naming the invite; uses and revocation are tracked here.
+type Invite struct {
+	ID        string      `json:"id"`
+	Room      string      `json:"room"`
+	CreatedBy string      `json:"created_by"`
+	MaxUses   int         `json:"max_uses"` // 0 means unlimited
+	Uses      []InviteUse `json:"uses"`
+	Revoked   bool        `json:"revoked"`
+	ExpiresAt time.Time   `json:"expires_at"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type InviteUse struct {
+	Username string    `json:"username"`
+	At       time.Time `json:"at"`
+}
+
+// UsedBy reports whether username has already redeemed the invite.
+func (inv *Invite) UsedBy(username string) bool {
+	for _, u := range inv.Uses {
+		if u.Username == username {
+			return true
+		}
+	}
+	return false
+}
+
+// use records a redemption by username. Revoked and expired invites fail
+// for everyone; a repeat redemption by the same user is not counted and
+// returns ErrInviteUsed, so that a member who was removed from the room
+// cannot rejoin with the link they already used.
+func (inv *Invite) use(username string, now time.Time) error {
+	switch {
+	case inv.Revoked:
+		return ErrInviteRevoked
+	case now.After(inv.ExpiresAt):
+		return ErrInviteExpired
+	case inv.UsedBy(username):
+		return ErrInviteUsed
+	case inv.MaxUses > 0 && len(inv.Uses) >= inv.MaxUses:
+		return ErrInviteExhausted
+	}
+	inv.Uses = append(inv.Uses, InviteUse{Username: username, At: now})
+	return nil
+}
+
+type InviteStore interface {
+	CreateInvite(ctx context.Context, inv *Invite) error
+	GetInvite(ctx context.Context, id string) (*Invite, error)
+	ListInvites(ctx context.Context, room string) ([]*Invite, error)
+	RevokeInvite(ctx context.Context, id string) error
+	// UseInvite atomically checks the invite and records a use by username.
+	UseInvite(ctx context.Context, id, username string, now time.Time) (*Invite, error)
+}
+
+func (s *RedisStore) invitesKey() string {
+	return "chat:invites"
+}
+
+func (s *RedisStore) CreateInvite(ctx context.Context, inv *Invite) error {
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	ok, err := s.client.HSetNX(ctx, s.invitesKey(), inv.ID, data).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrExists
+	}
+	return nil
+}
+
+func (s *RedisStore) GetInvite(ctx context.Context, id string) (*Invite, error) {
+	data, err := s.client.HGet(ctx, s.invitesKey(), id).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var inv Invite
+	if err := json.Unmarshal([]byte(data), &inv); err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+func (s *RedisStore) ListInvites(ctx context.Context, room string) ([]*Invite, error) {
+	data, err := s.client.HGetAll(ctx, s.invitesKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	invites := make([]*Invite, 0)
+	for _, v := range data {
+		var inv Invite
+		if err := json.Unmarshal([]byte(v), &inv); err != nil || inv.Room != room {
+			continue
+		}
+		invites = append(invites, &inv)
+	}
+	sortInvites(invites)
+	return invites, nil
+}
+
+func (s *RedisStore) RevokeInvite(ctx context.Context, id string) error {
+	return s.updateInvite(ctx, id, func(inv *Invite) error {
+		inv.Revoked = true
+		return nil
+	})
+}
+
+func (s *RedisStore) UseInvite(ctx context.Context, id, username string, now time.Time) (*Invite, error) {
+	var used *Invite
+	err := s.updateInvite(ctx, id, func(inv *Invite) error {
+		used = inv
+		return inv.use(username, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return used, nil
+}
+
+// updateInvite applies fn to the stored invite inside an optimistic
+// transaction, retrying when a concurrent update wins the race.
+func (s *RedisStore) updateInvite(ctx context.Context, id string, fn func(*Invite) error) error {
+	key := s.invitesKey()
+	txf := func(tx *redis.Tx) error {
+		data, err := tx.HGet(ctx, key, id).Result()
+		if errors.Is(err, redis.Nil) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var inv Invite
+		if err := json.Unmarshal([]byte(data), &inv); err != nil {
+			return err
+		}
+		if err := fn(&inv); err != nil {
+			return err
+		}
+		updated, err := json.Marshal(&inv)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key, id, updated)
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < 10; i++ {
+		err := s.client.Watch(ctx, txf, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return redis.TxFailedErr
+}
+
+func sortInvites(invites []*Invite) {
+	sort.Slice(invites, func(i, j int) bool { return invites[i].CreatedAt.Before(invites[j].CreatedAt) })
+}
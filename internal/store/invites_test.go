@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestRedisStore(t *testing.T) *RedisStore {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	s, err := NewRedisStore("redis://"+mr.Addr(), 1, 10)
+	if err != nil {
+		t.Fatalf("NewRedisStore failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func testInviteStore(t *testing.T, s InviteStore) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	inv := &Invite{ID: "abc", Room: "ops", MaxUses: 2, ExpiresAt: now.Add(time.Hour), CreatedAt: now}
+	if err := s.CreateInvite(ctx, inv); err != nil {
+		t.Fatalf("CreateInvite failed: %v", err)
+	}
+	if err := s.CreateInvite(ctx, inv); !errors.Is(err, ErrExists) {
+		t.Errorf("expected ErrExists, got %v", err)
+	}
+
+	if _, err := s.UseInvite(ctx, "abc", "alice", now); err != nil {
+		t.Fatalf("first use failed: %v", err)
+	}
+	// Reusing the invite as the same user does not count again
+	if _, err := s.UseInvite(ctx, "abc", "alice", now); !errors.Is(err, ErrInviteUsed) {
+		t.Errorf("expected ErrInviteUsed, got %v", err)
+	}
+	if _, err := s.UseInvite(ctx, "abc", "bob", now); err != nil {
+		t.Fatalf("second use failed: %v", err)
+	}
+	if _, err := s.UseInvite(ctx, "abc", "carol", now); !errors.Is(err, ErrInviteExhausted) {
+		t.Errorf("expected ErrInviteExhausted, got %v", err)
+	}
+
+	got, err := s.GetInvite(ctx, "abc")
+	if err != nil || len(got.Uses) != 2 || !got.UsedBy("bob") {
+		t.Errorf("unexpected invite %+v (err %v)", got, err)
+	}
+
+	if _, err := s.UseInvite(ctx, "abc", "dave", now.Add(2*time.Hour)); !errors.Is(err, ErrInviteExpired) &&
+		!errors.Is(err, ErrInviteExhausted) {
+		t.Errorf("expected the invite to be unusable, got %v", err)
+	}
+
+	other := &Invite{ID: "def", Room: "ops", ExpiresAt: now.Add(time.Hour), CreatedAt: now.Add(time.Second)}
+	s.CreateInvite(ctx, other)
+	if err := s.RevokeInvite(ctx, "def"); err != nil {
+		t.Fatalf("RevokeInvite failed: %v", err)
+	}
+	if _, err := s.UseInvite(ctx, "def", "erin", now); !errors.Is(err, ErrInviteRevoked) {
+		t.Errorf("expected ErrInviteRevoked, got %v", err)
+	}
+	// Earlier redemptions do not outlive the invite
+	if _, err := s.UseInvite(ctx, "abc", "alice", now.Add(2*time.Hour)); !errors.Is(err, ErrInviteExpired) {
+		t.Errorf("expected ErrInviteExpired for a past user, got %v", err)
+	}
+	if err := s.RevokeInvite(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	list, err := s.ListInvites(ctx, "ops")
+	if err != nil || len(list) != 2 || list[0].ID != "abc" {
+		t.Errorf("unexpected invite list %+v (err %v)", list, err)
+	}
+	if list, _ := s.ListInvites(ctx, "general"); len(list) != 0 {
+		t.Errorf("expected no invites for general, got %d", len(list))
+	}
+}
+
+func TestMemoryStore_Invites(t *testing.T) {
+	testInviteStore(t, NewMemoryStore())
+}
+
+func TestRedisStore_Invites(t *testing.T) {
+	testInviteStore(t, newTestRedisStore(t))
+}
+
+func TestRedisStore_UseInviteConcurrent(t *testing.T) {
+	s := newTestRedisStore(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	s.CreateInvite(ctx, &Invite{ID: "race", Room: "ops", MaxUses: 3, ExpiresAt: now.Add(time.Hour)})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := s.UseInvite(ctx, "race", "user"+string(rune('a'+i)), now); err == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if accepted != 3 {
+		t.Errorf("expected exactly 3 uses, got %d", accepted)
+	}
+}
@@ -0,0 +1,214 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// APIKey is a named credential. Only the SHA-256 hash of the secret is
+// stored; the secret itself is shown once when the key is created.
+type APIKey struct {
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	Scopes    []string  `json:"scopes"`
+	Rooms     []string  `json:"rooms,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"` // zero means the key never expires
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (k APIKey) Expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && now.After(k.ExpiresAt)
+}
+
+type KeyStore interface {
+	ListKeys(ctx context.Context) ([]APIKey, error)
+	PutKey(ctx context.Context, key APIKey) error
+	DeleteKey(ctx context.Context, name string) error
+}
+
+func (s *RedisStore) keysKey() string {
+	return "chat:apikeys"
+}
+
+func (s *RedisStore) ListKeys(ctx context.Context) ([]APIKey, error) {
+	data, err := s.client.HGetAll(ctx, s.keysKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]APIKey, 0, len(data))
+	for _, v := range data {
+		var key APIKey
+		if err := json.Unmarshal([]byte(v), &key); err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sortKeys(keys)
+	return keys, nil
+}
+
+func (s *RedisStore) PutKey(ctx context.Context, key APIKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, s.keysKey(), key.Name, data).Err()
+}
+
+func (s *RedisStore) DeleteKey(ctx context.Context, name string) error {
+	n, err := s.client.HDel(ctx, s.keysKey(), name).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// FileKeyStore keeps API keys in a JSON file, rewritten atomically on
+// every change.
+type FileKeyStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileKeyStore(path string) *FileKeyStore {
+	return &FileKeyStore{path: path}
+}
+
+func (s *FileKeyStore) ListKeys(ctx context.Context) ([]APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read()
+}
+
+func (s *FileKeyStore) PutKey(ctx context.Context, key APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, err := s.read()
+	if err != nil {
+		return err
+	}
+	keys = append(removeKey(keys, key.Name), key)
+	return s.write(keys)
+}
+
+func (s *FileKeyStore) DeleteKey(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, err := s.read()
+	if err != nil {
+		return err
+	}
+	remaining := removeKey(keys, name)
+	if len(remaining) == len(keys) {
+		return ErrNotFound
+	}
+	return s.write(remaining)
+}
+
+func (s *FileKeyStore) read() ([]APIKey, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+	sortKeys(keys)
+	return keys, nil
+}
+
+func (s *FileKeyStore) write(keys []APIKey) error {
+	sortKeys(keys)
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".apikeys-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// MemoryKeyStore keeps API keys in memory only; keys created at runtime
+// are lost on restart.
+type MemoryKeyStore struct {
+	mu   sync.Mutex
+	keys []APIKey
+}
+
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{}
+}
+
+func (s *MemoryKeyStore) ListKeys(ctx context.Context) ([]APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]APIKey(nil), s.keys...), nil
+}
+
+func (s *MemoryKeyStore) PutKey(ctx context.Context, key APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(removeKey(s.keys, key.Name), key)
+	sortKeys(s.keys)
+	return nil
+}
+
+func (s *MemoryKeyStore) DeleteKey(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	remaining := removeKey(s.keys, name)
+	if len(remaining) == len(s.keys) {
+		return ErrNotFound
+	}
+	s.keys = remaining
+	return nil
+}
+
+func removeKey(keys []APIKey, name string) []APIKey {
+	out := make([]APIKey, 0, len(keys))
+	for _, k := range keys {
+		if k.Name != name {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+func sortKeys(keys []APIKey) {
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	s := NewFileKeyStore(path)
+	ctx := context.Background()
+
+	// Missing file means no keys
+	keys, err := s.ListKeys(ctx)
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("expected no keys, got %v (%v)", keys, err)
+	}
+
+	s.PutKey(ctx, APIKey{Name: "b", Hash: "h2", Scopes: []string{"read"}, CreatedAt: time.Now()})
+	s.PutKey(ctx, APIKey{Name: "a", Hash: "h1", Scopes: []string{"admin"}, CreatedAt: time.Now()})
+
+	// A fresh store reads what was persisted
+	keys, err = NewFileKeyStore(path).ListKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].Name != "a" || keys[1].Name != "b" {
+		t.Fatalf("unexpected keys %+v", keys)
+	}
+
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("key file should not be world readable, got %v", info.Mode().Perm())
+	}
+
+	if err := s.DeleteKey(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteKey(ctx, "a"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	keys, _ = s.ListKeys(ctx)
+	if len(keys) != 1 {
+		t.Errorf("expected 1 key, got %d", len(keys))
+	}
+}
+
+func TestAPIKey_Expired(t *testing.T) {
+	now := time.Now()
+
+	if (APIKey{}).Expired(now) {
+		t.Error("key without expiry should never expire")
+	}
+	if !(APIKey{ExpiresAt: now.Add(-time.Second)}).Expired(now) {
+		t.Error("key past its expiry should be expired")
+	}
+}
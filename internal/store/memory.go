@@ -0,0 +1,374 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps room metadata, invites, moderation state and webhooks in
+// memory.
+// It is used when Redis is not configured; everything is lost on restart.
+// Values are stored encoded so that callers never share mutable state with
+// the store, as with Redis.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	rooms   map[string][]byte
+	invites map[string][]byte
+
+	sanctions map[string]Sanction
+	audit     []AuditEntry
+
+	webhooks    map[string]Webhook
+	deliveries  map[string][]Delivery
+	deadLetters map[string]DeadLetter
+	incoming    map[string]IncomingWebhook
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		rooms:   make(map[string][]byte),
+		invites: make(map[string][]byte),
+
+		sanctions: make(map[string]Sanction),
+
+		webhooks:    make(map[string]Webhook),
+		deliveries:  make(map[string][]Delivery),
+		deadLetters: make(map[string]DeadLetter),
+		incoming:    make(map[string]IncomingWebhook),
+	}
+}
+
+func (s *MemoryStore) GetRoom(ctx context.Context, name string) (*Room, error) {
+	s.mu.RLock()
+	data, ok := s.rooms[name]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	var room Room
+	if err := json.Unmarshal(data, &room); err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+func (s *MemoryStore) ListRooms(ctx context.Context) ([]*Room, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rooms := make([]*Room, 0, len(s.rooms))
+	for _, data := range s.rooms {
+		var room Room
+		if err := json.Unmarshal(data, &room); err != nil {
+			continue
+		}
+		rooms = append(rooms, &room)
+	}
+	sortRooms(rooms)
+	return rooms, nil
+}
+
+func (s *MemoryStore) CreateRoom(ctx context.Context, room *Room) error {
+	data, err := json.Marshal(room)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[room.Name]; ok {
+		return ErrExists
+	}
+	s.rooms[room.Name] = data
+	return nil
+}
+
+func (s *MemoryStore) PutRoom(ctx context.Context, room *Room) error {
+	data, err := json.Marshal(room)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.rooms[room.Name] = data
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) DeleteRoom(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[name]; !ok {
+		return ErrNotFound
+	}
+	delete(s.rooms, name)
+	return nil
+}
+
+func (s *MemoryStore) CreateInvite(ctx context.Context, inv *Invite) error {
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.invites[inv.ID]; ok {
+		return ErrExists
+	}
+	s.invites[inv.ID] = data
+	return nil
+}
+
+func (s *MemoryStore) GetInvite(ctx context.Context, id string) (*Invite, error) {
+	s.mu.RLock()
+	data, ok := s.invites[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	var inv Invite
+	if err := json.Unmarshal(data, &inv); err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+func (s *MemoryStore) ListInvites(ctx context.Context, room string) ([]*Invite, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invites := make([]*Invite, 0)
+	for _, data := range s.invites {
+		var inv Invite
+		if err := json.Unmarshal(data, &inv); err != nil || inv.Room != room {
+			continue
+		}
+		invites = append(invites, &inv)
+	}
+	sortInvites(invites)
+	return invites, nil
+}
+
+func (s *MemoryStore) RevokeInvite(ctx context.Context, id string) error {
+	_, err := s.updateInvite(id, func(inv *Invite) error {
+		inv.Revoked = true
+		return nil
+	})
+	return err
+}
+
+func (s *MemoryStore) UseInvite(ctx context.Context, id, username string, now time.Time) (*Invite, error) {
+	return s.updateInvite(id, func(inv *Invite) error {
+		return inv.use(username, now)
+	})
+}
+
+func (s *MemoryStore) updateInvite(id string, fn func(*Invite) error) (*Invite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.invites[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	var inv Invite
+	if err := json.Unmarshal(data, &inv); err != nil {
+		return nil, err
+	}
+	if err := fn(&inv); err != nil {
+		return nil, err
+	}
+	updated, err := json.Marshal(&inv)
+	if err != nil {
+		return nil, err
+	}
+	s.invites[id] = updated
+	return &inv, nil
+}
+
+func (s *MemoryStore) ListSanctions(ctx context.Context) ([]Sanction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sanctions := make([]Sanction, 0, len(s.sanctions))
+	for _, sanction := range s.sanctions {
+		sanctions = append(sanctions, sanction)
+	}
+	sortSanctions(sanctions)
+	return sanctions, nil
+}
+
+func (s *MemoryStore) PutSanction(ctx context.Context, sanction Sanction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sanctions[sanction.ID] = sanction
+	return nil
+}
+
+func (s *MemoryStore) DeleteSanction(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sanctions[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.sanctions, id)
+	return nil
+}
+
+func (s *MemoryStore) AppendAudit(ctx context.Context, e AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audit = append(s.audit, e)
+	return nil
+}
+
+func (s *MemoryStore) ListAudit(ctx context.Context, limit int) ([]AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start := max(len(s.audit)-limit, 0)
+	return append([]AuditEntry(nil), s.audit[start:]...), nil
+}
+
+func (s *MemoryStore) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hooks := make([]Webhook, 0, len(s.webhooks))
+	for _, w := range s.webhooks {
+		w.Events = slices.Clone(w.Events)
+		hooks = append(hooks, w)
+	}
+	sortWebhooks(hooks)
+	return hooks, nil
+}
+
+func (s *MemoryStore) GetWebhook(ctx context.Context, id string) (*Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	w, ok := s.webhooks[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	w.Events = slices.Clone(w.Events)
+	return &w, nil
+}
+
+func (s *MemoryStore) PutWebhook(ctx context.Context, w Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Events = slices.Clone(w.Events)
+	s.webhooks[w.ID] = w
+	return nil
+}
+
+func (s *MemoryStore) DeleteWebhook(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.webhooks[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.webhooks, id)
+	delete(s.deliveries, id)
+	for key, d := range s.deadLetters {
+		if d.Webhook == id {
+			delete(s.deadLetters, key)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) AppendDelivery(ctx context.Context, d Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	log := append(s.deliveries[d.Webhook], d)
+	s.deliveries[d.Webhook] = log[max(len(log)-MaxDeliveryLog, 0):]
+	return nil
+}
+
+func (s *MemoryStore) ListDeliveries(ctx context.Context, webhook string, limit int) ([]Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	log := s.deliveries[webhook]
+	start := max(len(log)-limit, 0)
+	return append([]Delivery(nil), log[start:]...), nil
+}
+
+func (s *MemoryStore) PutDeadLetter(ctx context.Context, d DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadLetters[d.ID] = d
+	return nil
+}
+
+func (s *MemoryStore) ListDeadLetters(ctx context.Context, webhook string) ([]DeadLetter, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var dead []DeadLetter
+	for _, d := range s.deadLetters {
+		if d.Webhook == webhook {
+			dead = append(dead, d)
+		}
+	}
+	sortDeadLetters(dead)
+	return dead, nil
+}
+
+func (s *MemoryStore) DeleteDeadLetter(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.deadLetters[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.deadLetters, id)
+	return nil
+}
+
+func (s *MemoryStore) ListIncomingWebhooks(ctx context.Context, room string) ([]IncomingWebhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var hooks []IncomingWebhook
+	for _, w := range s.incoming {
+		if w.Room == room {
+			hooks = append(hooks, w)
+		}
+	}
+	sortIncomingWebhooks(hooks)
+	return hooks, nil
+}
+
+func (s *MemoryStore) GetIncomingWebhook(ctx context.Context, id string) (*IncomingWebhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	w, ok := s.incoming[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &w, nil
+}
+
+func (s *MemoryStore) PutIncomingWebhook(ctx context.Context, w IncomingWebhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.incoming[w.ID] = w
+	return nil
+}
+
+func (s *MemoryStore) DeleteIncomingWebhook(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.incoming[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.incoming, id)
+	return nil
+}
@@ -0,0 +1,31 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRedisStore_RecordsMetrics(t *testing.T) {
+	s := newTestRedisStore(t)
+	ctx := context.Background()
+	errors := testutil.ToFloat64(metrics.StoreErrors.WithLabelValues("hget"))
+
+	s.PutRoom(ctx, &Room{Name: "ops", Visibility: VisibilityPublic})
+	s.GetRoom(ctx, "missing") // redis.Nil is not an error
+
+	if testutil.CollectAndCount(metrics.StoreDuration) == 0 {
+		t.Error("expected store latency to be recorded")
+	}
+	if got := testutil.ToFloat64(metrics.StoreErrors.WithLabelValues("hget")); got != errors {
+		t.Errorf("missing keys should not count as errors, got %v more", got-errors)
+	}
+
+	s.Close()
+	s.GetRoom(ctx, "ops")
+	if got := testutil.ToFloat64(metrics.StoreErrors.WithLabelValues("hget")); got != errors+1 {
+		t.Errorf("expected one more error, got %v", got-errors)
+	}
+}
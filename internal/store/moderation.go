@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Sanction kinds.
+const (
+	SanctionBan  = "ban"
+	SanctionMute = "mute"
+)
+
+// Sanction is a ban or mute. It targets a username, an IP address or both,
+// in one room or, when Room is empty, everywhere.
+type Sanction struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Room      string    `json:"room,omitempty"`
+	Username  string    `json:"username,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	By        string    `json:"by"`
+	ExpiresAt time.Time `json:"expires_at"` // zero means the sanction is permanent
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s Sanction) Expired(now time.Time) bool {
+	return !s.ExpiresAt.IsZero() && now.After(s.ExpiresAt)
+}
+
+// Applies reports whether the sanction covers username or ip in room.
+func (s Sanction) Applies(room, username, ip string) bool {
+	if s.Room != "" && s.Room != room {
+		return false
+	}
+	return (s.Username != "" && s.Username == username) || (s.IP != "" && s.IP == ip)
+}
+
+// AuditEntry records one moderation action. Entries are only ever
+// appended.
+type AuditEntry struct {
+	Action    string    `json:"action"` // kick, ban, mute, unban or unmute
+	Actor     string    `json:"actor"`
+	Room      string    `json:"room,omitempty"`
+	Username  string    `json:"username,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Sanction  string    `json:"sanction,omitempty"` // sanction ID for bans and mutes
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	At        time.Time `json:"at"`
+}
+
+// ModerationStore persists sanctions and the moderation audit log. The log
+// has no update or delete operations.
+type ModerationStore interface {
+	ListSanctions(ctx context.Context) ([]Sanction, error)
+	PutSanction(ctx context.Context, s Sanction) error
+	DeleteSanction(ctx context.Context, id string) error
+	AppendAudit(ctx context.Context, e AuditEntry) error
+	// ListAudit returns the newest limit entries, oldest first.
+	ListAudit(ctx context.Context, limit int) ([]AuditEntry, error)
+}
+
+func (s *RedisStore) sanctionsKey() string {
+	return "chat:sanctions"
+}
+
+func (s *RedisStore) auditKey() string {
+	return "chat:audit"
+}
+
+func (s *RedisStore) ListSanctions(ctx context.Context) ([]Sanction, error) {
+	data, err := s.client.HGetAll(ctx, s.sanctionsKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sanctions := make([]Sanction, 0, len(data))
+	for _, v := range data {
+		var sanction Sanction
+		if err := json.Unmarshal([]byte(v), &sanction); err != nil {
+			continue
+		}
+		sanctions = append(sanctions, sanction)
+	}
+	sortSanctions(sanctions)
+	return sanctions, nil
+}
+
+func (s *RedisStore) PutSanction(ctx context.Context, sanction Sanction) error {
+	data, err := json.Marshal(sanction)
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, s.sanctionsKey(), sanction.ID, data).Err()
+}
+
+func (s *RedisStore) DeleteSanction(ctx context.Context, id string) error {
+	n, err := s.client.HDel(ctx, s.sanctionsKey(), id).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *RedisStore) AppendAudit(ctx context.Context, e AuditEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.client.RPush(ctx, s.auditKey(), data).Err()
+}
+
+func (s *RedisStore) ListAudit(ctx context.Context, limit int) ([]AuditEntry, error) {
+	data, err := s.client.LRange(ctx, s.auditKey(), int64(-limit), -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]AuditEntry, 0, len(data))
+	for _, v := range data {
+		var e AuditEntry
+		if err := json.Unmarshal([]byte(v), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func sortSanctions(sanctions []Sanction) {
+	sort.Slice(sanctions, func(i, j int) bool { return sanctions[i].CreatedAt.Before(sanctions[j].CreatedAt) })
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func testModerationStore(t *testing.T, s ModerationStore) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	ban := Sanction{ID: "b1", Kind: SanctionBan, Room: "lobby", Username: "troll", By: "alice", CreatedAt: now}
+	mute := Sanction{ID: "m1", Kind: SanctionMute, Username: "loud", By: "admin", CreatedAt: now.Add(time.Second)}
+	s.PutSanction(ctx, ban)
+	s.PutSanction(ctx, mute)
+
+	list, err := s.ListSanctions(ctx)
+	if err != nil || len(list) != 2 || list[0].ID != "b1" {
+		t.Fatalf("unexpected sanctions %+v (err %v)", list, err)
+	}
+	if err := s.DeleteSanction(ctx, "b1"); err != nil {
+		t.Fatalf("DeleteSanction failed: %v", err)
+	}
+	if err := s.DeleteSanction(ctx, "b1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	for _, action := range []string{"ban", "unban", "mute"} {
+		s.AppendAudit(ctx, AuditEntry{Action: action, Actor: "alice", At: now})
+	}
+	entries, err := s.ListAudit(ctx, 2)
+	if err != nil || len(entries) != 2 || entries[0].Action != "unban" || entries[1].Action != "mute" {
+		t.Errorf("expected the newest two entries oldest first, got %+v (err %v)", entries, err)
+	}
+}
+
+func TestMemoryStore_Moderation(t *testing.T) {
+	testModerationStore(t, NewMemoryStore())
+}
+
+func TestRedisStore_Moderation(t *testing.T) {
+	testModerationStore(t, newTestRedisStore(t))
+}
+
+func TestSanction_Applies(t *testing.T) {
+	room := Sanction{Room: "lobby", Username: "troll"}
+	global := Sanction{IP: "10.0.0.1"}
+
+	if !room.Applies("lobby", "troll", "1.1.1.1") || room.Applies("other", "troll", "1.1.1.1") {
+		t.Error("room sanction should apply to its room only")
+	}
+	if !global.Applies("any", "someone", "10.0.0.1") || global.Applies("any", "someone", "10.0.0.2") {
+		t.Error("IP sanction should match by address in every room")
+	}
+	if !(Sanction{ExpiresAt: time.Now().Add(-time.Second)}).Expired(time.Now()) {
+		t.Error("expected sanction to be expired")
+	}
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimitResult is the outcome of taking a token from a shared bucket.
+type RateLimitResult struct {
+	Allowed    bool
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until a token is available, when denied
+}
+
+// RateLimitStore keeps token buckets shared by every replica.
+type RateLimitStore interface {
+	// TakeToken takes a token from the bucket at key, which earns one
+	// token per interval and holds at most capacity/interval tokens.
+	TakeToken(ctx context.Context, key string, interval, capacity time.Duration) (RateLimitResult, error)
+}
+
+// gcraScript applies GCRA atomically. The bucket is stored as its
+// theoretical arrival time in microseconds of Redis's clock, so replicas
+// with skewed clocks agree, and expires once the bucket is full again.
+var gcraScript = redis.NewScript(`
+local interval = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local tat = tonumber(redis.call('GET', KEYS[1])) or now
+if tat < now then
+	tat = now
+end
+local next = tat + interval
+local allow_at = next - capacity
+if now < allow_at then
+	return {0, tat - now, allow_at - now}
+end
+
+redis.call('SET', KEYS[1], next, 'PX', math.ceil((next - now) / 1000))
+return {1, next - now, 0}
+`)
+
+func (s *RedisStore) rateLimitKey(key string) string {
+	return "chat:ratelimit:" + key
+}
+
+func (s *RedisStore) TakeToken(ctx context.Context, key string, interval, capacity time.Duration) (RateLimitResult, error) {
+	res, err := gcraScript.Run(ctx, s.client, []string{s.rateLimitKey(key)},
+		interval.Microseconds(), capacity.Microseconds()).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return RateLimitResult{
+		Allowed:    res[0] == 1,
+		Reset:      time.Duration(res[1]) * time.Microsecond,
+		RetryAfter: time.Duration(res[2]) * time.Microsecond,
+	}, nil
+}
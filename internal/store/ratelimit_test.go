@@ -0,0 +1,35 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRedisStore_TakeToken(t *testing.T) {
+	s := newTestRedisStore(t)
+	ctx := context.Background()
+
+	for i := range 3 {
+		res, err := s.TakeToken(ctx, "api:10.0.0.1", time.Second, 3*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed || res.Reset <= time.Duration(i)*time.Second {
+			t.Errorf("request %d: unexpected result %+v", i+1, res)
+		}
+	}
+
+	res, err := s.TakeToken(ctx, "api:10.0.0.1", time.Second, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed || res.RetryAfter <= 0 || res.RetryAfter > time.Second {
+		t.Errorf("expected the fourth request to be denied, got %+v", res)
+	}
+
+	// Buckets are per key
+	if res, _ := s.TakeToken(ctx, "api:10.0.0.2", time.Second, 3*time.Second); !res.Allowed {
+		t.Error("another key should have its own bucket")
+	}
+}
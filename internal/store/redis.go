@@ -15,6 +15,8 @@ type Message struct {
 	Content  string `json:"content"`
 	Room     string `json:"room"`
 	Time     string `json:"time"`
+	Bot      bool   `json:"bot,omitempty"`
+	Trace    string `json:"traceparent,omitempty"`
 }
 
 type Store interface {
@@ -37,6 +39,8 @@ func NewRedisStore(redisURL string, ttlHours int, maxMessages int) (*RedisStore,
 	}
 
 	client := redis.NewClient(opt)
+	client.AddHook(metricsHook{})
+	client.AddHook(tracingHook{})
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -54,6 +58,11 @@ func NewRedisStore(redisURL string, ttlHours int, maxMessages int) (*RedisStore,
 	}, nil
 }
 
+// Ping checks that Redis is reachable.
+func (s *RedisStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
 func (s *RedisStore) roomKey(room string) string {
 	return "chat:room:" + room + ":messages"
 }
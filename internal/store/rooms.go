@@ -0,0 +1,164 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Room visibility levels. Rooms without metadata are public.
+const (
+	VisibilityPublic   = "public"   // anyone may join
+	VisibilityPrivate  = "private"  // members only, hidden from listings
+	VisibilityInvite   = "invite"   // members only, listed so people can ask for an invite
+	VisibilityPassword = "password" // anyone with the room password
+)
+
+// Room roles, from most to least privileged.
+const (
+	RoleOwner     = "owner"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+)
+
+// MaxSlowMode is the longest slow mode a room may have, in seconds.
+const MaxSlowMode = 3600
+
+var ErrExists = errors.New("already exists")
+
+// Room is the access-control metadata of a room.
+type Room struct {
+	Name         string            `json:"name"`
+	Visibility   string            `json:"visibility"`
+	PasswordHash string            `json:"password_hash,omitempty"`
+	Topic        string            `json:"topic,omitempty"`
+	SlowMode     int               `json:"slow_mode,omitempty"` // seconds between posts per user; 0 disables
+	Members      map[string]string `json:"members"`             // username -> role
+	CreatedAt    time.Time         `json:"created_at"`
+}
+
+func ValidVisibility(v string) bool {
+	switch v {
+	case VisibilityPublic, VisibilityPrivate, VisibilityInvite, VisibilityPassword:
+		return true
+	}
+	return false
+}
+
+func ValidRole(role string) bool {
+	return role == RoleOwner || role == RoleModerator || role == RoleMember
+}
+
+// Role returns the username's role in the room, or "" for non-members.
+func (r *Room) Role(username string) string {
+	return r.Members[username]
+}
+
+// IsModerator reports whether username is a moderator or the owner.
+func (r *Room) IsModerator(username string) bool {
+	role := r.Role(username)
+	return role == RoleOwner || role == RoleModerator
+}
+
+func (r *Room) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	r.PasswordHash = string(hash)
+	return nil
+}
+
+func (r *Room) CheckPassword(password string) bool {
+	return r.PasswordHash != "" &&
+		bcrypt.CompareHashAndPassword([]byte(r.PasswordHash), []byte(password)) == nil
+}
+
+type RoomStore interface {
+	GetRoom(ctx context.Context, name string) (*Room, error) // ErrNotFound for unclaimed rooms
+	ListRooms(ctx context.Context) ([]*Room, error)
+	CreateRoom(ctx context.Context, room *Room) error // ErrExists if the room is claimed
+	PutRoom(ctx context.Context, room *Room) error
+	DeleteRoom(ctx context.Context, name string) error
+}
+
+func (s *RedisStore) roomsKey() string {
+	return "chat:rooms"
+}
+
+func (s *RedisStore) GetRoom(ctx context.Context, name string) (*Room, error) {
+	data, err := s.client.HGet(ctx, s.roomsKey(), name).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var room Room
+	if err := json.Unmarshal([]byte(data), &room); err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+func (s *RedisStore) ListRooms(ctx context.Context) ([]*Room, error) {
+	data, err := s.client.HGetAll(ctx, s.roomsKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	rooms := make([]*Room, 0, len(data))
+	for _, v := range data {
+		var room Room
+		if err := json.Unmarshal([]byte(v), &room); err != nil {
+			continue
+		}
+		rooms = append(rooms, &room)
+	}
+	sortRooms(rooms)
+	return rooms, nil
+}
+
+func (s *RedisStore) CreateRoom(ctx context.Context, room *Room) error {
+	data, err := json.Marshal(room)
+	if err != nil {
+		return err
+	}
+	ok, err := s.client.HSetNX(ctx, s.roomsKey(), room.Name, data).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrExists
+	}
+	return nil
+}
+
+func (s *RedisStore) PutRoom(ctx context.Context, room *Room) error {
+	data, err := json.Marshal(room)
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, s.roomsKey(), room.Name, data).Err()
+}
+
+func (s *RedisStore) DeleteRoom(ctx context.Context, name string) error {
+	n, err := s.client.HDel(ctx, s.roomsKey(), name).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func sortRooms(rooms []*Room) {
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].Name < rooms[j].Name })
+}
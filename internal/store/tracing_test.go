@@ -0,0 +1,40 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRedisStore_RecordsSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	s := newTestRedisStore(t)
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "save")
+	if err := s.SaveMessage(ctx, Message{Type: "message", Room: "lobby", Content: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	s.GetRoom(ctx, "missing")
+	parent.End()
+
+	var children int
+	for _, span := range recorder.Ended() {
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			continue
+		}
+		children++
+		if span.Status().Code == codes.Error {
+			t.Errorf("%s should not be marked failed", span.Name())
+		}
+	}
+	if children < 2 {
+		t.Errorf("expected redis spans under the caller's span, got %d", children)
+	}
+}
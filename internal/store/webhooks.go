@@ -0,0 +1,239 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Webhook events.
+const (
+	EventMessage    = "message"
+	EventJoin       = "join"
+	EventLeave      = "leave"
+	EventModeration = "moderation"
+)
+
+var WebhookEvents = []string{EventMessage, EventJoin, EventLeave, EventModeration}
+
+// MaxDeliveryLog is the number of delivery attempts kept per webhook.
+const MaxDeliveryLog = 100
+
+// Webhook is an HTTP endpoint notified of events in a room, or in every
+// room when Room is empty.
+type Webhook struct {
+	ID        string    `json:"id"`
+	Room      string    `json:"room,omitempty"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret"` // HMAC key; kept in clear to sign deliveries
+	Events    []string  `json:"events"` // empty subscribes to every event
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Wants reports whether the webhook subscribes to event in room.
+func (w Webhook) Wants(room, event string) bool {
+	if w.Room != "" && w.Room != room {
+		return false
+	}
+	return len(w.Events) == 0 || slices.Contains(w.Events, event)
+}
+
+// Delivery is one attempt to deliver an event to a webhook.
+type Delivery struct {
+	ID         string    `json:"id"` // shared by every attempt of the same event
+	Webhook    string    `json:"webhook"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	Status     string    `json:"status"` // delivered, retrying or dead
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Duration   int64     `json:"duration_ms"`
+	At         time.Time `json:"at"`
+}
+
+// DeadLetter is an event that could not be delivered after every retry.
+type DeadLetter struct {
+	ID        string          `json:"id"` // the delivery ID
+	Webhook   string          `json:"webhook"`
+	Event     string          `json:"event"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error"`
+	At        time.Time       `json:"at"`
+}
+
+// WebhookStore persists webhooks, their delivery log and the dead letters
+// of undeliverable events.
+type WebhookStore interface {
+	ListWebhooks(ctx context.Context) ([]Webhook, error)
+	GetWebhook(ctx context.Context, id string) (*Webhook, error)
+	PutWebhook(ctx context.Context, w Webhook) error
+	// DeleteWebhook also drops the webhook's delivery log and dead letters.
+	DeleteWebhook(ctx context.Context, id string) error
+
+	// AppendDelivery adds to the webhook's log, keeping the newest
+	// MaxDeliveryLog attempts.
+	AppendDelivery(ctx context.Context, d Delivery) error
+	// ListDeliveries returns the newest limit attempts, oldest first.
+	ListDeliveries(ctx context.Context, webhook string, limit int) ([]Delivery, error)
+
+	PutDeadLetter(ctx context.Context, d DeadLetter) error
+	ListDeadLetters(ctx context.Context, webhook string) ([]DeadLetter, error)
+	DeleteDeadLetter(ctx context.Context, id string) error
+}
+
+func (s *RedisStore) webhooksKey() string {
+	return "chat:webhooks"
+}
+
+func (s *RedisStore) deliveriesKey(webhook string) string {
+	return "chat:webhooks:log:" + webhook
+}
+
+func (s *RedisStore) deadLettersKey() string {
+	return "chat:webhooks:dead"
+}
+
+func (s *RedisStore) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	data, err := s.client.HGetAll(ctx, s.webhooksKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	hooks := make([]Webhook, 0, len(data))
+	for _, v := range data {
+		var w Webhook
+		if err := json.Unmarshal([]byte(v), &w); err != nil {
+			continue
+		}
+		hooks = append(hooks, w)
+	}
+	sortWebhooks(hooks)
+	return hooks, nil
+}
+
+func (s *RedisStore) GetWebhook(ctx context.Context, id string) (*Webhook, error) {
+	data, err := s.client.HGet(ctx, s.webhooksKey(), id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var w Webhook
+	if err := json.Unmarshal(data, &w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (s *RedisStore) PutWebhook(ctx context.Context, w Webhook) error {
+	data, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, s.webhooksKey(), w.ID, data).Err()
+}
+
+func (s *RedisStore) DeleteWebhook(ctx context.Context, id string) error {
+	n, err := s.client.HDel(ctx, s.webhooksKey(), id).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	dead, err := s.ListDeadLetters(ctx, id)
+	if err != nil {
+		return err
+	}
+	pipe := s.client.TxPipeline()
+	pipe.Del(ctx, s.deliveriesKey(id))
+	for _, d := range dead {
+		pipe.HDel(ctx, s.deadLettersKey(), d.ID)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisStore) AppendDelivery(ctx context.Context, d Delivery) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	pipe := s.client.TxPipeline()
+	pipe.RPush(ctx, s.deliveriesKey(d.Webhook), data)
+	pipe.LTrim(ctx, s.deliveriesKey(d.Webhook), -MaxDeliveryLog, -1)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisStore) ListDeliveries(ctx context.Context, webhook string, limit int) ([]Delivery, error) {
+	data, err := s.client.LRange(ctx, s.deliveriesKey(webhook), int64(-limit), -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]Delivery, 0, len(data))
+	for _, v := range data {
+		var d Delivery
+		if err := json.Unmarshal([]byte(v), &d); err != nil {
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
+
+func (s *RedisStore) PutDeadLetter(ctx context.Context, d DeadLetter) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, s.deadLettersKey(), d.ID, data).Err()
+}
+
+func (s *RedisStore) ListDeadLetters(ctx context.Context, webhook string) ([]DeadLetter, error) {
+	data, err := s.client.HGetAll(ctx, s.deadLettersKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var dead []DeadLetter
+	for _, v := range data {
+		var d DeadLetter
+		if err := json.Unmarshal([]byte(v), &d); err != nil || d.Webhook != webhook {
+			continue
+		}
+		dead = append(dead, d)
+	}
+	sortDeadLetters(dead)
+	return dead, nil
+}
+
+func (s *RedisStore) DeleteDeadLetter(ctx context.Context, id string) error {
+	n, err := s.client.HDel(ctx, s.deadLettersKey(), id).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func sortWebhooks(hooks []Webhook) {
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].CreatedAt.Before(hooks[j].CreatedAt) })
+}
+
+func sortDeadLetters(dead []DeadLetter) {
+	sort.Slice(dead, func(i, j int) bool { return dead[i].At.Before(dead[j].At) })
+}
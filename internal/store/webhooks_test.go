@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func testWebhookStore(t *testing.T, s WebhookStore) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	s.PutWebhook(ctx, Webhook{ID: "w1", Room: "lobby", URL: "http://a", Events: []string{EventJoin}, CreatedAt: now})
+	s.PutWebhook(ctx, Webhook{ID: "w2", URL: "http://b", CreatedAt: now.Add(time.Second)})
+
+	hooks, err := s.ListWebhooks(ctx)
+	if err != nil || len(hooks) != 2 || hooks[0].ID != "w1" {
+		t.Fatalf("unexpected webhooks %+v (err %v)", hooks, err)
+	}
+	if w, err := s.GetWebhook(ctx, "w1"); err != nil || w.URL != "http://a" {
+		t.Errorf("unexpected webhook %+v (err %v)", w, err)
+	}
+	if _, err := s.GetWebhook(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	for i := range MaxDeliveryLog + 5 {
+		s.AppendDelivery(ctx, Delivery{ID: fmt.Sprint(i), Webhook: "w1", Attempt: 1, At: now})
+	}
+	log, _ := s.ListDeliveries(ctx, "w1", MaxDeliveryLog*2)
+	if len(log) != MaxDeliveryLog || log[len(log)-1].ID != fmt.Sprint(MaxDeliveryLog+4) {
+		t.Errorf("expected the newest %d deliveries, got %d", MaxDeliveryLog, len(log))
+	}
+	log, _ = s.ListDeliveries(ctx, "w1", 2)
+	if len(log) != 2 || log[0].ID != fmt.Sprint(MaxDeliveryLog+3) {
+		t.Errorf("expected the newest two deliveries oldest first, got %+v", log)
+	}
+
+	s.PutDeadLetter(ctx, DeadLetter{ID: "d1", Webhook: "w1", Payload: []byte(`{"a":1}`), At: now})
+	s.PutDeadLetter(ctx, DeadLetter{ID: "d2", Webhook: "w2", Payload: []byte(`{}`), At: now})
+	dead, err := s.ListDeadLetters(ctx, "w1")
+	if err != nil || len(dead) != 1 || string(dead[0].Payload) != `{"a":1}` {
+		t.Errorf("unexpected dead letters %+v (err %v)", dead, err)
+	}
+
+	if err := s.DeleteWebhook(ctx, "w1"); err != nil {
+		t.Fatalf("DeleteWebhook failed: %v", err)
+	}
+	if log, _ := s.ListDeliveries(ctx, "w1", 10); len(log) != 0 {
+		t.Error("deleting a webhook should drop its delivery log")
+	}
+	if dead, _ := s.ListDeadLetters(ctx, "w1"); len(dead) != 0 {
+		t.Error("deleting a webhook should drop its dead letters")
+	}
+	if err := s.DeleteDeadLetter(ctx, "d2"); err != nil {
+		t.Errorf("DeleteDeadLetter failed: %v", err)
+	}
+	if err := s.DeleteWebhook(ctx, "w1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestMemoryStore_Webhooks(t *testing.T) {
+	testWebhookStore(t, NewMemoryStore())
+}
+
+func TestRedisStore_Webhooks(t *testing.T) {
+	testWebhookStore(t, newTestRedisStore(t))
+}
+
+func TestWebhook_Wants(t *testing.T) {
+	room := Webhook{Room: "lobby", Events: []string{EventMessage}}
+	global := Webhook{}
+
+	if !room.Wants("lobby", EventMessage) || room.Wants("lobby", EventJoin) || room.Wants("other", EventMessage) {
+		t.Error("room webhook should match its room and events only")
+	}
+	if !global.Wants("any", EventModeration) {
+		t.Error("webhook without room or events should match everything")
+	}
+}
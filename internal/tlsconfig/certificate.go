@@ -0,0 +1,103 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Certificate serves a key pair from disk and loads it again when the
+// files change, so that renewed certificates are picked up without a
+// restart. Files are polled rather than watched, which also follows the
+// symlink swaps of mounted Kubernetes secrets.
+type Certificate struct {
+	certFile, keyFile string
+	cert              atomic.Pointer[tls.Certificate]
+
+	mu    sync.Mutex
+	stamp string // sizes and modification times of the files last read
+}
+
+func LoadCertificate(certFile, keyFile string) (*Certificate, error) {
+	c := &Certificate{certFile: certFile, keyFile: keyFile}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (c *Certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+// Reload reads the key pair now. The current certificate is kept if the
+// files do not hold a valid pair, for instance halfway through a renewal.
+func (c *Certificate) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stamp = c.currentStamp()
+	return c.load()
+}
+
+// load reads the key pair. The caller holds c.mu.
+func (c *Certificate) load() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("TLS certificate: %w", err)
+	}
+	c.cert.Store(&cert)
+	if cert.Leaf != nil {
+		slog.Info("TLS certificate loaded", "file", c.certFile,
+			"subject", cert.Leaf.Subject.String(), "not_after", cert.Leaf.NotAfter)
+	}
+	return nil
+}
+
+// currentStamp describes both files, so that a change to either shows.
+func (c *Certificate) currentStamp() string {
+	stamp := ""
+	for _, path := range []string{c.certFile, c.keyFile} {
+		if info, err := os.Stat(path); err == nil {
+			stamp += fmt.Sprintf("%d@%d;", info.Size(), info.ModTime().UnixNano())
+		} else {
+			stamp += "missing;"
+		}
+	}
+	return stamp
+}
+
+// Watch reloads the key pair whenever the files change, checking every
+// interval until ctx is done.
+func (c *Certificate) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.check()
+		}
+	}
+}
+
+// check reloads the key pair if the files changed since they were last
+// read. A failed load is retried once the files change again.
+func (c *Certificate) check() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stamp := c.currentStamp()
+	if stamp == c.stamp {
+		return
+	}
+	c.stamp = stamp
+	if err := c.load(); err != nil {
+		slog.Warn("TLS certificate changed but could not be loaded, serving the previous one", "error", err)
+	}
+}
@@ -0,0 +1,157 @@
+// Package tlsconfig builds the server's TLS configuration from the
+// settings: a certificate reloaded when its files change on disk, the
+// minimum protocol version, cipher suites and optional client
+// certificates (mutual TLS).
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Client certificate policies.
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional" // verified when presented
+	ClientAuthRequire  = "require"
+)
+
+type Options struct {
+	CertFile     string
+	KeyFile      string
+	MinVersion   string   // "1.0" to "1.3"
+	CipherSuites []string // crypto/tls names; empty keeps Go's defaults
+	ClientCAFile string   // PEM bundle of the CAs that sign client certificates
+	ClientAuth   string   // ClientAuthNone, ClientAuthOptional or ClientAuthRequire
+}
+
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseVersion parses a protocol version such as "1.2".
+func ParseVersion(s string) (uint16, error) {
+	v, ok := versions[strings.TrimPrefix(strings.ToLower(s), "tls")]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q, use 1.0, 1.1, 1.2 or 1.3", s)
+	}
+	return v, nil
+}
+
+// ParseCipherSuites looks up cipher suites by their crypto/tls names, such
+// as TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256. Insecure suites are refused.
+// Suites only apply up to TLS 1.2; TLS 1.3 suites are not configurable.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	byName := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		byName[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := byName[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ParseClientAuth parses a client certificate policy.
+func ParseClientAuth(s string) (tls.ClientAuthType, error) {
+	switch s {
+	case ClientAuthNone, "":
+		return tls.NoClientCert, nil
+	case ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	}
+	return 0, fmt.Errorf("unknown client auth %q, use none, optional or require", s)
+}
+
+// New returns the TLS configuration for opts and the certificate it
+// serves, which the caller should Watch for changes.
+func New(opts Options) (*tls.Config, *Certificate, error) {
+	minVersion, err := ParseVersion(opts.MinVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	suites, err := ParseCipherSuites(opts.CipherSuites)
+	if err != nil {
+		return nil, nil, err
+	}
+	clientAuth, err := ParseClientAuth(opts.ClientAuth)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := LoadCertificate(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   suites,
+		GetCertificate: cert.GetCertificate,
+		ClientAuth:     clientAuth,
+	}
+	if clientAuth != tls.NoClientCert {
+		if opts.ClientCAFile == "" {
+			return nil, nil, errors.New("client certificates need a CA file")
+		}
+		pool, err := loadCAs(opts.ClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		cfg.ClientCAs = pool
+	}
+	return cfg, cert, nil
+}
+
+func loadCAs(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("client CA file %s has no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+// Redirect returns a handler that sends every request to the same URL
+// over HTTPS on httpsPort, for a plain HTTP listener next to the TLS one.
+// The redirect is permanent and keeps the method and body.
+func Redirect(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		if host == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
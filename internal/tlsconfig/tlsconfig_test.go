@@ -0,0 +1,197 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// issue creates a certificate for name, signed by parent (self-signed when
+// parent is nil), and returns it with its key.
+func issue(t *testing.T, name string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// writePair writes cert and key as PEM files in dir.
+func writePair(t *testing.T, dir string, cert *x509.Certificate, key *ecdsa.PrivateKey) (string, string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writePEM(t, certFile, "CERTIFICATE", cert.Raw)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, path, kind string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseSettings(t *testing.T) {
+	if v, err := ParseVersion("1.3"); err != nil || v != tls.VersionTLS13 {
+		t.Errorf("expected TLS 1.3, got %x %v", v, err)
+	}
+	if _, err := ParseVersion("1.4"); err == nil {
+		t.Error("expected an error for an unknown version")
+	}
+
+	suites, err := ParseCipherSuites([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"})
+	if err != nil || len(suites) != 1 || suites[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("unexpected suites %v %v", suites, err)
+	}
+	if _, err := ParseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"}); err == nil {
+		t.Error("expected insecure suites to be refused")
+	}
+
+	if auth, err := ParseClientAuth(ClientAuthOptional); err != nil || auth != tls.VerifyClientCertIfGiven {
+		t.Errorf("unexpected client auth %v %v", auth, err)
+	}
+	if _, err := ParseClientAuth("always"); err == nil {
+		t.Error("expected an error for an unknown client auth")
+	}
+}
+
+func TestCertificate_ReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	first, firstKey := issue(t, "first.example.com", false, nil, nil)
+	certFile, keyFile := writePair(t, dir, first, firstKey)
+
+	cert, err := LoadCertificate(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("LoadCertificate: %v", err)
+	}
+	served, _ := cert.GetCertificate(nil)
+	if served.Leaf.Subject.CommonName != "first.example.com" {
+		t.Fatalf("unexpected certificate %s", served.Leaf.Subject)
+	}
+
+	// A half-written renewal keeps the previous certificate
+	second, secondKey := issue(t, "second.example.com", false, nil, nil)
+	writePEM(t, certFile, "CERTIFICATE", second.Raw)
+	cert.check()
+	if served, _ := cert.GetCertificate(nil); served.Leaf.Subject.CommonName != "first.example.com" {
+		t.Errorf("expected the previous certificate while the pair mismatches, got %s", served.Leaf.Subject)
+	}
+
+	writePair(t, dir, second, secondKey)
+	os.Chtimes(keyFile, time.Now(), time.Now().Add(time.Second)) // in case the size and mtime did not change
+	cert.check()
+	if served, _ := cert.GetCertificate(nil); served.Leaf.Subject.CommonName != "second.example.com" {
+		t.Errorf("expected the renewed certificate, got %s", served.Leaf.Subject)
+	}
+}
+
+func TestNew_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := issue(t, "Test CA", true, nil, nil)
+	serverCert, serverKey := issue(t, "localhost", false, ca, caKey)
+	certFile, keyFile := writePair(t, dir, serverCert, serverKey)
+	caFile := filepath.Join(dir, "ca.crt")
+	writePEM(t, caFile, "CERTIFICATE", ca.Raw)
+
+	cfg, _, err := New(Options{
+		CertFile: certFile, KeyFile: keyFile, MinVersion: "1.2", ClientCAFile: caFile, ClientAuth: ClientAuthRequire,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = cfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs: roots, ServerName: "localhost", Certificates: certs,
+		}}}
+	}
+
+	if resp, err := client().Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Error("expected a client without a certificate to be rejected")
+	}
+
+	clientCert, clientKey := issue(t, "bot", false, ca, caKey)
+	resp, err := client(tls.Certificate{Certificate: [][]byte{clientCert.Raw}, PrivateKey: clientKey}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("expected a client certificate signed by the CA to be accepted: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestNew_ClientAuthNeedsCA(t *testing.T) {
+	cert, key := issue(t, "localhost", false, nil, nil)
+	certFile, keyFile := writePair(t, t.TempDir(), cert, key)
+	if _, _, err := New(Options{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.2", ClientAuth: ClientAuthRequire}); err == nil {
+		t.Error("expected an error without a client CA file")
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	tests := []struct {
+		host, port, want string
+	}{
+		{"chat.example.com", "443", "https://chat.example.com/room?x=1"},
+		{"chat.example.com:80", "8443", "https://chat.example.com:8443/room?x=1"},
+		{"[::1]:8080", "443", "https://[::1]/room?x=1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/room?x=1", nil)
+		req.Host = tt.host
+		rec := httptest.NewRecorder()
+		Redirect(tt.port).ServeHTTP(rec, req)
+		if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != tt.want {
+			t.Errorf("%s: expected 308 to %s, got %d %s", tt.host, tt.want, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+}
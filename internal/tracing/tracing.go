@@ -0,0 +1,119 @@
+// Package tracing configures OpenTelemetry tracing and carries trace
+// context inside chat messages, so that the span that received a message
+// can be linked to the spans that persisted and delivered it.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentation = "github.com/TrailBlazors/realtime-chat-railway"
+	serviceName     = "realtime-chat"
+)
+
+// Exporters accepted by Setup.
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterNone   = "none"
+)
+
+// traceparent is the header, and message field, holding the trace context.
+const traceparent = "traceparent"
+
+var propagator = propagation.TraceContext{}
+
+// Tracer returns the tracer used by the server. It is looked up on every
+// call so that spans go to whichever provider is currently installed.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Setup installs a global tracer provider that exports spans with the
+// named exporter and returns a function that flushes and stops it. An
+// empty name or ExporterNone leaves tracing disabled. The OTLP exporter is
+// configured with the standard OTEL_EXPORTER_OTLP_* variables.
+func Setup(ctx context.Context, exporter string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+	if exporter == "" || exporter == ExporterNone {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exp, err := newExporter(ctx, exporter, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", serviceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+func newExporter(ctx context.Context, name string, w io.Writer) (sdktrace.SpanExporter, error) {
+	switch name {
+	case ExporterOTLP:
+		return otlptracehttp.New(ctx)
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(w))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", name)
+	}
+}
+
+// Inject returns the W3C traceparent of the span in ctx, the form in which
+// messages carry trace context, or "" when ctx has no valid span.
+func Inject(ctx context.Context) string {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ""
+	}
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier.Get(traceparent)
+}
+
+// Extract returns ctx with the remote span context of a traceparent.
+func Extract(ctx context.Context, parent string) context.Context {
+	if parent == "" {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier{traceparent: parent})
+}
+
+// FromRequest returns the request context with the span context of the
+// caller's traceparent header, if any.
+func FromRequest(r *http.Request) context.Context {
+	return propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+}
+
+// LinkTo returns a link to the span of a traceparent, and false if it is
+// missing or malformed. Links are used instead of parents for context
+// supplied by clients, which is not trusted to start a trace.
+func LinkTo(parent string) (trace.Link, bool) {
+	sc := trace.SpanContextFromContext(Extract(context.Background(), parent))
+	return trace.Link{SpanContext: sc}, sc.IsValid()
+}
@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInjectExtract(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("test").Start(context.Background(), "send")
+	defer span.End()
+
+	parent := Inject(ctx)
+	if !strings.HasPrefix(parent, "00-"+span.SpanContext().TraceID().String()) {
+		t.Fatalf("unexpected traceparent %q", parent)
+	}
+
+	sc := trace.SpanContextFromContext(Extract(context.Background(), parent))
+	if sc.TraceID() != span.SpanContext().TraceID() || sc.SpanID() != span.SpanContext().SpanID() || !sc.IsRemote() {
+		t.Errorf("extracted %+v, want the span of %q", sc, parent)
+	}
+
+	if Inject(context.Background()) != "" {
+		t.Error("a context without a span should not be injected")
+	}
+	if _, ok := LinkTo("garbage"); ok {
+		t.Error("a malformed traceparent should not be linked")
+	}
+	if link, ok := LinkTo(parent); !ok || link.SpanContext.SpanID() != span.SpanContext().SpanID() {
+		t.Error("expected a link to the sending span")
+	}
+}
+
+func TestStdoutExporter(t *testing.T) {
+	var out bytes.Buffer
+	exp, err := newExporter(context.Background(), ExporterStdout, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	_, span := provider.Tracer("test").Start(context.Background(), "chat.receive")
+	span.End()
+	provider.Shutdown(context.Background())
+
+	if !strings.Contains(out.String(), `"Name":"chat.receive"`) {
+		t.Errorf("expected the span on stdout, got %s", out.String())
+	}
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := Setup(context.Background(), "zipkin"); err == nil {
+		t.Error("expected an error for an unknown exporter")
+	}
+}
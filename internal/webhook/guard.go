@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// sharedAddressSpace is the carrier-grade NAT range, which like the private
+// ranges reaches hosts inside the provider's network.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddr reports whether addr is on the public internet. Webhook URLs
+// are chosen by room owners, so deliveries must not reach the server's own
+// network: loopback, private and link-local addresses, which include cloud
+// metadata endpoints such as 169.254.169.254.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// AllowPrivateNetworks lets deliveries reach loopback and private
+// addresses, for receivers on the server's own host or network. It must be
+// called before the dispatcher runs.
+func (d *Dispatcher) AllowPrivateNetworks() {
+	d.allowed = func(netip.Addr) bool { return true }
+}
+
+// newClient returns the HTTP client for deliveries. The destination is
+// checked after name resolution, as every connection is dialed, so that a
+// hostname resolving to an internal address or a redirect to one is
+// refused as well. Proxies are not used, since the check would only see
+// the proxy's address.
+func (d *Dispatcher) newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !d.allowed(ap.Addr()) {
+				return fmt.Errorf("webhook destination %s is not a public address", ap.Addr())
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: 10 * time.Second, Transport: transport}
+}
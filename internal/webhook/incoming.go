@@ -0,0 +1,191 @@
+package webhook
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+)
+
+// MaxPostLength is the longest message, in characters, accepted by an
+// incoming webhook.
+const MaxPostLength = 4000
+
+const maxUsernameLength = 32
+
+var ErrPayload = errors.New("invalid payload")
+
+// Incoming manages incoming webhooks, which let external systems post into
+// a room with a secret URL.
+type Incoming struct {
+	store store.IncomingWebhookStore
+}
+
+func NewIncoming(s store.IncomingWebhookStore) *Incoming {
+	return &Incoming{store: s}
+}
+
+// Create adds an incoming webhook posting to room as name and returns its
+// token, which cannot be recovered later.
+func (in *Incoming) Create(ctx context.Context, room, name, createdBy string) (string, store.IncomingWebhook, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", store.IncomingWebhook{}, fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+
+	token := "wht_" + newID() + newID()
+	w := store.IncomingWebhook{
+		ID:        newID(),
+		Room:      room,
+		Name:      name,
+		TokenHash: hashToken(token),
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := in.store.PutIncomingWebhook(ctx, w); err != nil {
+		return "", w, err
+	}
+	return token, w, nil
+}
+
+func (in *Incoming) List(ctx context.Context, room string) ([]store.IncomingWebhook, error) {
+	return in.store.ListIncomingWebhooks(ctx, room)
+}
+
+func (in *Incoming) Delete(ctx context.Context, room, id string) error {
+	w, err := in.store.GetIncomingWebhook(ctx, id)
+	if err != nil {
+		return err
+	}
+	if w.Room != room {
+		return store.ErrNotFound
+	}
+	return in.store.DeleteIncomingWebhook(ctx, id)
+}
+
+// Authenticate returns the webhook id if token is its token, and
+// store.ErrNotFound otherwise.
+func (in *Incoming) Authenticate(ctx context.Context, id, token string) (*store.IncomingWebhook, error) {
+	w, err := in.store.GetIncomingWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(w.TokenHash), []byte(hashToken(token))) != 1 {
+		return nil, store.ErrNotFound
+	}
+	return w, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Post is a message sent to an incoming webhook.
+type Post struct {
+	Username string // replaces the webhook's display name, with a bot prefix, when set
+	Text     string
+}
+
+// incomingPayload accepts both the simple format, {"content": "..."}, and
+// Slack's {"text": "...", "attachments": [...]}.
+type incomingPayload struct {
+	Content     string       `json:"content"`
+	Text        string       `json:"text"`
+	Username    string       `json:"username"`
+	Attachments []attachment `json:"attachments"`
+}
+
+type attachment struct {
+	Fallback  string `json:"fallback"`
+	Pretext   string `json:"pretext"`
+	Title     string `json:"title"`
+	TitleLink string `json:"title_link"`
+	Text      string `json:"text"`
+	Fields    []struct {
+		Title string `json:"title"`
+		Value string `json:"value"`
+	} `json:"fields"`
+}
+
+// render flattens the attachment into plain text, which is all the chat
+// displays.
+func (a attachment) render() string {
+	var lines []string
+	if a.Pretext != "" {
+		lines = append(lines, a.Pretext)
+	}
+	if a.Title != "" {
+		title := a.Title
+		if a.TitleLink != "" {
+			title += " (" + a.TitleLink + ")"
+		}
+		lines = append(lines, title)
+	}
+	if a.Text != "" {
+		lines = append(lines, a.Text)
+	}
+	for _, f := range a.Fields {
+		lines = append(lines, f.Title+": "+f.Value)
+	}
+	if len(lines) == 0 {
+		return a.Fallback
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ParsePost reads a post from a JSON body or, as Slack also allows, from
+// the payload field of a form.
+func ParsePost(r *http.Request) (Post, error) {
+	var data []byte
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/x-www-form-urlencoded" {
+		if err := r.ParseForm(); err != nil {
+			return Post{}, fmt.Errorf("%w: %v", ErrPayload, err)
+		}
+		data = []byte(r.PostForm.Get("payload"))
+	} else {
+		var err error
+		if data, err = io.ReadAll(r.Body); err != nil {
+			return Post{}, fmt.Errorf("%w: %v", ErrPayload, err)
+		}
+	}
+
+	var p incomingPayload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return Post{}, fmt.Errorf("%w: body is not valid JSON", ErrPayload)
+	}
+
+	parts := []string{p.Content, p.Text}
+	for _, a := range p.Attachments {
+		parts = append(parts, a.render())
+	}
+	var text []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			text = append(text, part)
+		}
+	}
+
+	post := Post{Username: strings.TrimSpace(p.Username), Text: strings.Join(text, "\n")}
+	switch {
+	case post.Text == "":
+		return post, fmt.Errorf("%w: content or text is required", ErrPayload)
+	case utf8.RuneCountInString(post.Text) > MaxPostLength:
+		return post, fmt.Errorf("%w: message is longer than %d characters", ErrPayload, MaxPostLength)
+	case utf8.RuneCountInString(post.Username) > maxUsernameLength:
+		return post, fmt.Errorf("%w: username is longer than %d characters", ErrPayload, maxUsernameLength)
+	}
+	return post, nil
+}
@@ -0,0 +1,90 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+)
+
+func TestIncoming_Authenticate(t *testing.T) {
+	in := NewIncoming(store.NewMemoryStore())
+	ctx := context.Background()
+
+	if _, _, err := in.Create(ctx, "ops", " ", "alice"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected ErrInvalid without a name, got %v", err)
+	}
+	token, hook, err := in.Create(ctx, "ops", "CI", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hook.TokenHash == "" || strings.Contains(hook.TokenHash, token) {
+		t.Error("only the hash of the token should be stored")
+	}
+
+	if w, err := in.Authenticate(ctx, hook.ID, token); err != nil || w.Room != "ops" {
+		t.Errorf("valid token rejected: %v", err)
+	}
+	if _, err := in.Authenticate(ctx, hook.ID, "wht_wrong"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a wrong token, got %v", err)
+	}
+
+	if err := in.Delete(ctx, "other", hook.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Error("webhooks should not be deletable from other rooms")
+	}
+	if err := in.Delete(ctx, "ops", hook.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := in.Authenticate(ctx, hook.ID, token); !errors.Is(err, store.ErrNotFound) {
+		t.Error("deleted webhooks should not authenticate")
+	}
+}
+
+func TestParsePost(t *testing.T) {
+	slack := `{
+		"username": "alertmanager",
+		"text": "1 alert firing",
+		"attachments": [
+			{"title": "HighLatency", "title_link": "https://grafana/d/1", "text": "p99 > 2s",
+			 "fields": [{"title": "severity", "value": "page"}]},
+			{"fallback": "see dashboard"}
+		]
+	}`
+
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+		want        Post
+		wantErr     bool
+	}{
+		{"simple", "application/json", `{"content":"build passed"}`, Post{Text: "build passed"}, false},
+		{"slack", "application/json", slack, Post{
+			Username: "alertmanager",
+			Text:     "1 alert firing\nHighLatency (https://grafana/d/1)\np99 > 2s\nseverity: page\nsee dashboard",
+		}, false},
+		{"slack form", "application/x-www-form-urlencoded",
+			url.Values{"payload": {`{"text":"deployed"}`}}.Encode(), Post{Text: "deployed"}, false},
+		{"empty", "application/json", `{"text":"  "}`, Post{}, true},
+		{"not json", "application/json", `hello`, Post{}, true},
+		{"too long", "application/json", `{"text":"` + strings.Repeat("x", MaxPostLength+1) + `"}`, Post{}, true},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest("POST", "/hooks/id/token", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", tc.contentType)
+		got, err := ParsePost(req)
+		if tc.wantErr {
+			if !errors.Is(err, ErrPayload) {
+				t.Errorf("%s: expected ErrPayload, got %v", tc.name, err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("%s: got %+v (err %v), want %+v", tc.name, got, err, tc.want)
+		}
+	}
+}
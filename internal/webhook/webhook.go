@@ -0,0 +1,460 @@
+// Package webhook notifies HTTP endpoints of room events. Deliveries are
+// signed with the webhook's secret and retried with exponential backoff;
+// events that still cannot be delivered are kept as dead letters until they
+// are redelivered or the webhook is deleted.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+)
+
+// Request headers of a delivery.
+const (
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+)
+
+var (
+	ErrInvalid   = errors.New("invalid webhook")
+	ErrSignature = errors.New("invalid webhook signature")
+)
+
+// Event is something that happened in a room. Data is encoded as JSON in
+// the delivery payload.
+type Event struct {
+	Type string // one of store.WebhookEvents
+	Room string
+	Data any
+}
+
+// payload is the JSON body of a delivery.
+type payload struct {
+	ID    string    `json:"id"`
+	Event string    `json:"event"`
+	Room  string    `json:"room,omitempty"`
+	Time  time.Time `json:"time"`
+	Data  any       `json:"data"`
+}
+
+// delivery is an event queued for one webhook.
+type delivery struct {
+	id      string
+	webhook string
+	event   string
+	body    []byte
+	attempt int
+}
+
+// Dispatcher manages webhooks and delivers events to them. Webhooks are
+// cached and reloaded periodically so that changes made by other instances
+// are picked up.
+type Dispatcher struct {
+	store       store.WebhookStore
+	client      *http.Client
+	workers     int
+	maxAttempts int
+	backoff     time.Duration // delay before the first retry, doubled for each one after
+	maxBackoff  time.Duration
+	refresh     time.Duration
+	allowed     func(netip.Addr) bool // destinations deliveries may connect to
+
+	queue chan *delivery
+
+	mu        sync.RWMutex
+	hooks     []store.Webhook
+	loaded    time.Time
+	reloading atomic.Bool
+}
+
+func NewDispatcher(s store.WebhookStore) *Dispatcher {
+	d := &Dispatcher{
+		store:       s,
+		workers:     4,
+		maxAttempts: 8,
+		backoff:     time.Second,
+		maxBackoff:  10 * time.Minute,
+		refresh:     30 * time.Second,
+		allowed:     publicAddr,
+		queue:       make(chan *delivery, 1024),
+	}
+	d.client = d.newClient()
+	return d
+}
+
+// Run delivers queued events until ctx is done. Retries still waiting for
+// their backoff when the process exits are lost.
+func (d *Dispatcher) Run(ctx context.Context) {
+	if err := d.reload(ctx); err != nil {
+		slog.Warn("failed to load webhooks", "error", err)
+	}
+
+	var wg sync.WaitGroup
+	for range d.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case dl := <-d.queue:
+					d.deliver(ctx, dl)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Publish queues e for every webhook subscribed to it. It does not block,
+// not even on the store, as it is called from the hub loop; events are
+// dropped when the queue is full.
+func (d *Dispatcher) Publish(e Event) {
+	hooks := d.current()
+
+	now := time.Now().UTC()
+	for _, w := range hooks {
+		if !w.Wants(e.Room, e.Type) {
+			continue
+		}
+		id := newID()
+		body, err := json.Marshal(payload{ID: id, Event: e.Type, Room: e.Room, Time: now, Data: e.Data})
+		if err != nil {
+			slog.Error("failed to encode webhook event", "event", e.Type, "error", err)
+			return
+		}
+		d.enqueue(&delivery{id: id, webhook: w.ID, event: e.Type, body: body})
+	}
+}
+
+func (d *Dispatcher) enqueue(dl *delivery) {
+	select {
+	case d.queue <- dl:
+	default:
+		slog.Warn("webhook queue full, dropping event", "webhook", dl.webhook, "event", dl.event)
+	}
+}
+
+// deliver makes one attempt and schedules a retry or dead-letters the
+// event when it fails.
+func (d *Dispatcher) deliver(ctx context.Context, dl *delivery) {
+	hook, ok := d.lookup(ctx, dl.webhook)
+	if !ok {
+		return // deleted since the event was queued
+	}
+
+	dl.attempt++
+	start := time.Now()
+	status, err := d.post(ctx, hook, dl)
+	entry := store.Delivery{
+		ID:         dl.id,
+		Webhook:    dl.webhook,
+		Event:      dl.event,
+		Attempt:    dl.attempt,
+		StatusCode: status,
+		Duration:   time.Since(start).Milliseconds(),
+		At:         start.UTC(),
+	}
+
+	switch {
+	case err == nil:
+		entry.Status = "delivered"
+	case dl.attempt < d.maxAttempts:
+		entry.Status = "retrying"
+		entry.Error = err.Error()
+		time.AfterFunc(d.retryDelay(dl.attempt), func() { d.enqueue(dl) })
+	default:
+		entry.Status = "dead"
+		entry.Error = err.Error()
+		dead := store.DeadLetter{
+			ID:        dl.id,
+			Webhook:   dl.webhook,
+			Event:     dl.event,
+			Payload:   dl.body,
+			Attempts:  dl.attempt,
+			LastError: err.Error(),
+			At:        entry.At,
+		}
+		if err := d.store.PutDeadLetter(ctx, dead); err != nil {
+			slog.Error("failed to store webhook dead letter", "webhook", dl.webhook, "delivery", dl.id, "error", err)
+		}
+		slog.Warn("webhook delivery failed permanently", "webhook", dl.webhook, "delivery", dl.id,
+			"attempts", dl.attempt, "error", entry.Error)
+	}
+
+	if err := d.store.AppendDelivery(ctx, entry); err != nil {
+		slog.Warn("failed to log webhook delivery", "webhook", dl.webhook, "error", err)
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, hook store.Webhook, dl *delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(dl.body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "realtime-chat-webhooks")
+	req.Header.Set(HeaderEvent, dl.event)
+	req.Header.Set(HeaderDelivery, dl.id)
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, time.Now(), dl.body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryDelay returns the backoff after the given attempt, with up to 20%
+// jitter so that retries to a recovering receiver are spread out.
+func (d *Dispatcher) retryDelay(attempt int) time.Duration {
+	delay := d.backoff << (attempt - 1)
+	if delay <= 0 || delay > d.maxBackoff {
+		delay = d.maxBackoff
+	}
+	if jitter := int64(delay / 5); jitter > 0 {
+		delay += time.Duration(rand.Int64N(jitter))
+	}
+	return delay
+}
+
+// Create registers a webhook for room, or for every room when room is
+// empty. The returned webhook carries the generated signing secret.
+func (d *Dispatcher) Create(ctx context.Context, room, rawURL string, events []string, createdBy string) (store.Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return store.Webhook{}, fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalid)
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !d.allowed(addr) {
+		return store.Webhook{}, fmt.Errorf("%w: url must not point to a private or loopback address", ErrInvalid)
+	}
+	for _, e := range events {
+		if !slices.Contains(store.WebhookEvents, e) {
+			return store.Webhook{}, fmt.Errorf("%w: unknown event %q", ErrInvalid, e)
+		}
+	}
+
+	w := store.Webhook{
+		ID:        newID(),
+		Room:      room,
+		URL:       u.String(),
+		Secret:    "whsec_" + newID(),
+		Events:    events,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := d.store.PutWebhook(ctx, w); err != nil {
+		return w, err
+	}
+	d.reload(ctx)
+	return w, nil
+}
+
+// List returns the webhooks of room.
+func (d *Dispatcher) List(ctx context.Context, room string) ([]store.Webhook, error) {
+	hooks, err := d.store.ListWebhooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var list []store.Webhook
+	for _, w := range hooks {
+		if w.Room == room {
+			list = append(list, w)
+		}
+	}
+	return list, nil
+}
+
+// Get returns the webhook id of room, or store.ErrNotFound.
+func (d *Dispatcher) Get(ctx context.Context, room, id string) (*store.Webhook, error) {
+	w, err := d.store.GetWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if w.Room != room {
+		return nil, store.ErrNotFound
+	}
+	return w, nil
+}
+
+func (d *Dispatcher) Delete(ctx context.Context, room, id string) error {
+	if _, err := d.Get(ctx, room, id); err != nil {
+		return err
+	}
+	if err := d.store.DeleteWebhook(ctx, id); err != nil {
+		return err
+	}
+	d.reload(ctx)
+	return nil
+}
+
+// Deliveries returns the newest limit delivery attempts of the webhook.
+func (d *Dispatcher) Deliveries(ctx context.Context, room, id string, limit int) ([]store.Delivery, error) {
+	if _, err := d.Get(ctx, room, id); err != nil {
+		return nil, err
+	}
+	return d.store.ListDeliveries(ctx, id, limit)
+}
+
+// DeadLetters returns the events the webhook could not be sent.
+func (d *Dispatcher) DeadLetters(ctx context.Context, room, id string) ([]store.DeadLetter, error) {
+	if _, err := d.Get(ctx, room, id); err != nil {
+		return nil, err
+	}
+	return d.store.ListDeadLetters(ctx, id)
+}
+
+// Redeliver takes a dead letter off the list and queues it again with a
+// fresh set of retries.
+func (d *Dispatcher) Redeliver(ctx context.Context, room, id, deliveryID string) error {
+	dead, err := d.DeadLetters(ctx, room, id)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(dead, func(dl store.DeadLetter) bool { return dl.ID == deliveryID })
+	if i < 0 {
+		return store.ErrNotFound
+	}
+	if err := d.store.DeleteDeadLetter(ctx, deliveryID); err != nil {
+		return err
+	}
+	dl := dead[i]
+	d.enqueue(&delivery{id: dl.ID, webhook: dl.Webhook, event: dl.Event, body: dl.Payload})
+	return nil
+}
+
+func (d *Dispatcher) lookup(ctx context.Context, id string) (store.Webhook, bool) {
+	for _, w := range d.cached(ctx) {
+		if w.ID == id {
+			return w, true
+		}
+	}
+	return store.Webhook{}, false
+}
+
+// current returns the cached webhooks without waiting for the store. When
+// they are stale, a reload starts in the background for later events.
+func (d *Dispatcher) current() []store.Webhook {
+	d.mu.RLock()
+	hooks, fresh := d.hooks, time.Since(d.loaded) < d.refresh
+	d.mu.RUnlock()
+
+	if !fresh && d.reloading.CompareAndSwap(false, true) {
+		go func() {
+			defer d.reloading.Store(false)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := d.reload(ctx); err != nil {
+				slog.Warn("failed to reload webhooks, using cached webhooks", "error", err)
+			}
+		}()
+	}
+	return hooks
+}
+
+func (d *Dispatcher) cached(ctx context.Context) []store.Webhook {
+	d.mu.RLock()
+	hooks, fresh := d.hooks, time.Since(d.loaded) < d.refresh
+	d.mu.RUnlock()
+
+	if fresh {
+		return hooks
+	}
+	if err := d.reload(ctx); err != nil {
+		slog.Warn("failed to reload webhooks, using cached webhooks", "error", err)
+		return hooks
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.hooks
+}
+
+func (d *Dispatcher) reload(ctx context.Context) error {
+	hooks, err := d.store.ListWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.hooks = hooks
+	d.loaded = time.Now()
+	d.mu.Unlock()
+	return nil
+}
+
+// Sign returns the signature header for body sent at t: the timestamp and
+// the hex HMAC-SHA256 of "<unix seconds>.<body>" keyed with secret.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + mac(secret, ts, body)
+}
+
+// Verify checks a signature header made by Sign and rejects signatures
+// older than tolerance, so that receivers can ignore replayed deliveries.
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return ErrSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(mac(secret, ts, body))) {
+		return ErrSignature
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrSignature)
+	}
+	return nil
+}
+
+func mac(secret, ts string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts + "."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func newID() string {
+	b := make([]byte, 12)
+	crand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,283 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TrailBlazors/realtime-chat-railway/internal/store"
+)
+
+// receiver is an httptest webhook endpoint that checks signatures and fails
+// the first failures requests.
+type receiver struct {
+	*httptest.Server
+	secret   string
+	failures int32
+
+	calls    atomic.Int32
+	mu       sync.Mutex
+	received []payload
+	headers  []http.Header
+}
+
+func newReceiver(t *testing.T, failures int32) *receiver {
+	rc := &receiver{failures: failures}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := Verify(rc.secret, r.Header.Get(HeaderSignature), body, time.Minute); err != nil {
+			t.Errorf("bad signature: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if rc.calls.Add(1) <= rc.failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var p payload
+		json.Unmarshal(body, &p)
+		rc.mu.Lock()
+		rc.received = append(rc.received, p)
+		rc.headers = append(rc.headers, r.Header.Clone())
+		rc.mu.Unlock()
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+func (rc *receiver) payloads() []payload {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]payload(nil), rc.received...)
+}
+
+func newTestDispatcher(t *testing.T) (*Dispatcher, *store.MemoryStore) {
+	s := store.NewMemoryStore()
+	d := NewDispatcher(s)
+	d.backoff = time.Millisecond
+	d.maxAttempts = 3
+	d.AllowPrivateNetworks() // receivers listen on loopback
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go d.Run(ctx)
+	return d, s
+}
+
+// eventually polls cond for up to two seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDispatcher_DeliversSignedEvents(t *testing.T) {
+	d, _ := newTestDispatcher(t)
+	rc := newReceiver(t, 0)
+	ctx := context.Background()
+
+	hook, err := d.Create(ctx, "lobby", rc.URL, []string{store.EventMessage}, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.secret = hook.Secret
+
+	d.Publish(Event{Type: store.EventJoin, Room: "lobby"})    // not subscribed
+	d.Publish(Event{Type: store.EventMessage, Room: "other"}) // other room
+	d.Publish(Event{Type: store.EventMessage, Room: "lobby", Data: map[string]string{"content": "hi"}})
+
+	eventually(t, "delivery", func() bool { return len(rc.payloads()) == 1 })
+	p := rc.payloads()[0]
+	if p.Event != store.EventMessage || p.Room != "lobby" || p.ID == "" {
+		t.Errorf("unexpected payload %+v", p)
+	}
+	if data, _ := p.Data.(map[string]any); data["content"] != "hi" {
+		t.Errorf("unexpected data %v", p.Data)
+	}
+	if rc.headers[0].Get(HeaderDelivery) != p.ID || rc.headers[0].Get(HeaderEvent) != store.EventMessage {
+		t.Errorf("unexpected headers %v", rc.headers[0])
+	}
+
+	eventually(t, "delivery log", func() bool {
+		log, _ := d.Deliveries(ctx, "lobby", hook.ID, 10)
+		return len(log) == 1 && log[0].Status == "delivered" && log[0].StatusCode == http.StatusOK
+	})
+}
+
+func TestDispatcher_RetriesWithBackoff(t *testing.T) {
+	d, _ := newTestDispatcher(t)
+	rc := newReceiver(t, 2)
+	ctx := context.Background()
+
+	hook, _ := d.Create(ctx, "lobby", rc.URL, nil, "alice")
+	rc.secret = hook.Secret
+	d.Publish(Event{Type: store.EventLeave, Room: "lobby"})
+
+	eventually(t, "delivery", func() bool { return len(rc.payloads()) == 1 })
+	eventually(t, "delivery log", func() bool {
+		log, _ := d.Deliveries(ctx, "lobby", hook.ID, 10)
+		return len(log) == 3
+	})
+	log, _ := d.Deliveries(ctx, "lobby", hook.ID, 10)
+	for i, want := range []string{"retrying", "retrying", "delivered"} {
+		if log[i].Status != want || log[i].Attempt != i+1 || log[i].ID != log[0].ID {
+			t.Errorf("attempt %d: unexpected log entry %+v", i+1, log[i])
+		}
+	}
+	if log[0].StatusCode != http.StatusServiceUnavailable || log[0].Error == "" {
+		t.Errorf("failed attempts should record the response, got %+v", log[0])
+	}
+}
+
+func TestDispatcher_DeadLettersAndRedelivery(t *testing.T) {
+	d, _ := newTestDispatcher(t)
+	rc := newReceiver(t, 3) // fails every attempt of the first delivery
+	ctx := context.Background()
+
+	hook, _ := d.Create(ctx, "lobby", rc.URL, nil, "alice")
+	rc.secret = hook.Secret
+	d.Publish(Event{Type: store.EventModeration, Room: "lobby"})
+
+	var dead []store.DeadLetter
+	eventually(t, "dead letter", func() bool {
+		dead, _ = d.DeadLetters(ctx, "lobby", hook.ID)
+		return len(dead) == 1
+	})
+	if dead[0].Attempts != 3 || dead[0].Event != store.EventModeration || len(rc.payloads()) != 0 {
+		t.Errorf("unexpected dead letter %+v", dead[0])
+	}
+
+	if err := d.Redeliver(ctx, "lobby", hook.ID, dead[0].ID); err != nil {
+		t.Fatalf("Redeliver failed: %v", err)
+	}
+	eventually(t, "redelivery", func() bool { return len(rc.payloads()) == 1 })
+	if rc.payloads()[0].ID != dead[0].ID {
+		t.Error("a redelivered event should keep its delivery ID")
+	}
+	if dead, _ := d.DeadLetters(ctx, "lobby", hook.ID); len(dead) != 0 {
+		t.Errorf("redelivered events should leave the dead-letter list, got %+v", dead)
+	}
+	if err := d.Redeliver(ctx, "lobby", hook.ID, dead[0].ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestDispatcher_Create(t *testing.T) {
+	d := NewDispatcher(store.NewMemoryStore())
+	ctx := context.Background()
+
+	for _, url := range []string{"", "ftp://example.com", "/relative", "http://"} {
+		if _, err := d.Create(ctx, "lobby", url, nil, "alice"); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%q: expected ErrInvalid, got %v", url, err)
+		}
+	}
+	if _, err := d.Create(ctx, "lobby", "https://example.com", []string{"typing"}, "alice"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected ErrInvalid for unknown event, got %v", err)
+	}
+
+	for _, url := range []string{"http://127.0.0.1:8080/hook", "http://[::1]/hook", "http://10.1.2.3/hook",
+		"http://169.254.169.254/latest/meta-data", "http://[::ffff:192.168.0.1]/hook"} {
+		if _, err := d.Create(ctx, "lobby", url, nil, "alice"); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%q: expected ErrInvalid for an internal address, got %v", url, err)
+		}
+	}
+
+	hook, err := d.Create(ctx, "lobby", "https://example.com/hook", nil, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Get(ctx, "other", hook.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Error("webhooks should not be visible from other rooms")
+	}
+	if err := d.Delete(ctx, "other", hook.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Error("webhooks should not be deletable from other rooms")
+	}
+}
+
+func TestDispatcher_RefusesInternalDestinations(t *testing.T) {
+	d, s := newTestDispatcher(t)
+	d.allowed = publicAddr
+	rc := newReceiver(t, 0)
+	ctx := context.Background()
+
+	// Registered under a name, the address is only known once resolved
+	hook := store.Webhook{ID: "local", Room: "lobby", URL: strings.Replace(rc.URL, "127.0.0.1", "localhost", 1)}
+	s.PutWebhook(ctx, hook)
+	d.reload(ctx)
+	d.Publish(Event{Type: store.EventJoin, Room: "lobby"})
+
+	eventually(t, "dead letter", func() bool {
+		dead, _ := d.DeadLetters(ctx, "lobby", hook.ID)
+		return len(dead) == 1
+	})
+	if rc.calls.Load() != 0 {
+		t.Error("the receiver on loopback should not have been called")
+	}
+	if dead, _ := d.DeadLetters(ctx, "lobby", hook.ID); !strings.Contains(dead[0].LastError, "not a public address") {
+		t.Errorf("unexpected error %q", dead[0].LastError)
+	}
+}
+
+// slowStore blocks listing webhooks until release is closed.
+type slowStore struct {
+	*store.MemoryStore
+	release chan struct{}
+}
+
+func (s slowStore) ListWebhooks(ctx context.Context) ([]store.Webhook, error) {
+	<-s.release
+	return s.MemoryStore.ListWebhooks(ctx)
+}
+
+func TestDispatcher_PublishDoesNotWaitForTheStore(t *testing.T) {
+	s := slowStore{MemoryStore: store.NewMemoryStore(), release: make(chan struct{})}
+	defer close(s.release)
+	d := NewDispatcher(s)
+
+	done := make(chan struct{})
+	go func() {
+		d.Publish(Event{Type: store.EventJoin, Room: "lobby"})
+		d.Publish(Event{Type: store.EventJoin, Room: "lobby"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish waited for the webhook store")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"event":"join"}`)
+	now := time.Now()
+
+	if err := Verify("s3cret", Sign("s3cret", now, body), body, time.Minute); err != nil {
+		t.Errorf("valid signature rejected: %v", err)
+	}
+	if err := Verify("other", Sign("s3cret", now, body), body, time.Minute); err == nil {
+		t.Error("signature with the wrong secret accepted")
+	}
+	if err := Verify("s3cret", Sign("s3cret", now, body), []byte(`{}`), time.Minute); err == nil {
+		t.Error("signature of a different body accepted")
+	}
+	if err := Verify("s3cret", Sign("s3cret", now.Add(-time.Hour), body), body, time.Minute); err == nil {
+		t.Error("stale signature accepted")
+	}
+	if err := Verify("s3cret", "garbage", body, time.Minute); err == nil {
+		t.Error("malformed header accepted")
+	}
+}